@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// admonitionKinds lists the GitHub alert markers we recognise, mapped to their display title.
+var admonitionKinds = map[string]string{
+	"NOTE":      "Note",
+	"TIP":       "Tip",
+	"IMPORTANT": "Important",
+	"WARNING":   "Warning",
+	"CAUTION":   "Caution",
+}
+
+// KindAdmonition is the node kind for GitHub-style alert blocks.
+var KindAdmonition = ast.NewNodeKind("Admonition")
+
+// Admonition is a blockquote that started with a `[!KIND]` marker line.
+type Admonition struct {
+	ast.BaseBlock
+	AdmonitionKind string
+}
+
+// Kind implements ast.Node.
+func (n *Admonition) Kind() ast.NodeKind {
+	return KindAdmonition
+}
+
+// Dump implements ast.Node.
+func (n *Admonition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"AdmonitionKind": n.AdmonitionKind}, nil)
+}
+
+// admonitionMarker returns the alert kind if the paragraph's first line is exactly `[!KIND]`.
+func admonitionMarker(source []byte, para *ast.Paragraph) (string, bool) {
+	lines := para.Lines()
+	if lines.Len() == 0 {
+		return "", false
+	}
+	line := lines.At(0)
+	first := bytes.TrimSpace(line.Value(source))
+	if len(first) < 4 || !bytes.HasPrefix(first, []byte("[!")) || first[len(first)-1] != ']' {
+		return "", false
+	}
+	kind := strings.ToUpper(string(first[2 : len(first)-1]))
+	if _, ok := admonitionKinds[kind]; !ok {
+		return "", false
+	}
+	return kind, true
+}
+
+type admonitionTransformer struct{}
+
+// Transform replaces `> [!NOTE]`-style blockquotes with Admonition nodes.
+func (t *admonitionTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if bq, ok := n.(*ast.Blockquote); ok {
+			quotes = append(quotes, bq)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, bq := range quotes {
+		para, ok := bq.FirstChild().(*ast.Paragraph)
+		if !ok {
+			continue
+		}
+		kind, ok := admonitionMarker(source, para)
+		if !ok {
+			continue
+		}
+
+		// Drop the inline nodes that belong to the marker line.
+		markerEnd := para.Lines().At(0).Stop
+		for c := para.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			t, isText := c.(*ast.Text)
+			if !isText || t.Segment.Start >= markerEnd {
+				break
+			}
+			para.RemoveChild(para, c)
+			c = next
+		}
+		if para.ChildCount() == 0 {
+			bq.RemoveChild(bq, para)
+		}
+
+		adm := &Admonition{AdmonitionKind: kind}
+		adm.SetLines(bq.Lines())
+		for c := bq.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			adm.AppendChild(adm, c)
+			c = next
+		}
+		bq.Parent().ReplaceChild(bq.Parent(), bq, adm)
+	}
+}
+
+type admonitionRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (r *admonitionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAdmonition, r.renderAdmonition)
+}
+
+func (r *admonitionRenderer) renderAdmonition(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*Admonition)
+	if !entering {
+		_, _ = w.WriteString("</div>\n")
+		return ast.WalkContinue, nil
+	}
+	class := strings.ToLower(n.AdmonitionKind)
+	_, _ = w.WriteString(`<div class="markdown-alert markdown-alert-` + class + `">` + "\n")
+	_, _ = w.WriteString(`<p class="markdown-alert-title">` + admonitionKinds[n.AdmonitionKind] + "</p>\n")
+	return ast.WalkContinue, nil
+}
+
+type admonitionExtension struct{}
+
+// admonitions renders GitHub's `> [!NOTE]` alert syntax as styled callout blocks.
+var admonitions = &admonitionExtension{}
+
+// Extend implements goldmark.Extender.
+func (e *admonitionExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&admonitionTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&admonitionRenderer{}, 500),
+	))
+}
+
+// admonitionCSS lays out alert blocks. Colours come from the --alert-* variables so palettes
+// and mdthemes can restyle them; icons are CSS masks so they follow the title colour.
+const admonitionCSS = `.markdown-alert{margin:0 0 16px 0;padding:8px 16px;border-left:4px solid var(--alert-color);border-radius:0 6px 6px 0;background:var(--alert-bg,transparent)}.markdown-alert>:last-child{margin-bottom:0}.markdown-alert-title{display:flex;align-items:center;gap:8px;margin:0 0 6px 0;font-weight:600;color:var(--alert-color)}.markdown-alert-title::before{content:"";display:inline-block;width:16px;height:16px;flex:none;background-color:currentColor;-webkit-mask:var(--alert-icon) no-repeat center/contain;mask:var(--alert-icon) no-repeat center/contain}` +
+	`.markdown-alert-note{--alert-color:var(--alert-note-color,#0969da);--alert-icon:url("data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'%3E%3Cpath d='M0 8a8 8 0 1 1 16 0A8 8 0 0 1 0 8Zm8-6.5a6.5 6.5 0 1 0 0 13 6.5 6.5 0 0 0 0-13ZM6.5 7.75A.75.75 0 0 1 7.25 7h1a.75.75 0 0 1 .75.75v2.75h.25a.75.75 0 0 1 0 1.5h-2a.75.75 0 0 1 0-1.5h.25v-2h-.25a.75.75 0 0 1-.75-.75ZM8 6a1 1 0 1 1 0-2 1 1 0 0 1 0 2Z'/%3E%3C/svg%3E")}` +
+	`.markdown-alert-tip{--alert-color:var(--alert-tip-color,#1a7f37);--alert-icon:url("data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'%3E%3Cpath d='M8 1.5c-2.363 0-4 1.69-4 3.75 0 .984.424 1.625.984 2.304l.214.253c.223.264.47.556.673.848.284.411.537.896.621 1.49a.75.75 0 0 1-1.484.211c-.04-.282-.163-.547-.37-.847a8.456 8.456 0 0 0-.542-.68c-.084-.1-.173-.205-.268-.32C3.201 7.75 2.5 6.766 2.5 5.25 2.5 2.31 4.863 0 8 0s5.5 2.31 5.5 5.25c0 1.516-.701 2.5-1.328 3.259-.095.115-.184.22-.268.319-.207.245-.383.453-.541.681-.208.3-.33.565-.37.847a.751.751 0 0 1-1.485-.212c.084-.593.337-1.078.621-1.489.203-.292.45-.584.673-.848.075-.088.147-.173.213-.253.561-.679.985-1.32.985-2.304 0-2.06-1.637-3.75-4-3.75ZM5.75 12h4.5a.75.75 0 0 1 0 1.5h-4.5a.75.75 0 0 1 0-1.5ZM6 15.25a.75.75 0 0 1 .75-.75h2.5a.75.75 0 0 1 0 1.5h-2.5a.75.75 0 0 1-.75-.75Z'/%3E%3C/svg%3E")}` +
+	`.markdown-alert-important{--alert-color:var(--alert-important-color,#8250df);--alert-icon:url("data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'%3E%3Cpath d='M0 1.75C0 .784.784 0 1.75 0h12.5C15.216 0 16 .784 16 1.75v9.5A1.75 1.75 0 0 1 14.25 13H8.06l-2.573 2.573A1.458 1.458 0 0 1 3 14.543V13H1.75A1.75 1.75 0 0 1 0 11.25Zm1.75-.25a.25.25 0 0 0-.25.25v9.5c0 .138.112.25.25.25h2a.75.75 0 0 1 .75.75v2.19l2.72-2.72a.749.749 0 0 1 .53-.22h6.5a.25.25 0 0 0 .25-.25v-9.5a.25.25 0 0 0-.25-.25Zm7 2.25v2.5a.75.75 0 0 1-1.5 0v-2.5a.75.75 0 0 1 1.5 0ZM9 9a1 1 0 1 1-2 0 1 1 0 0 1 2 0Z'/%3E%3C/svg%3E")}` +
+	`.markdown-alert-warning{--alert-color:var(--alert-warning-color,#9a6700);--alert-icon:url("data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'%3E%3Cpath d='M6.457 1.047c.659-1.234 2.427-1.234 3.086 0l6.082 11.378A1.75 1.75 0 0 1 14.082 15H1.918a1.75 1.75 0 0 1-1.543-2.575Zm1.763.707a.25.25 0 0 0-.44 0L1.698 13.132a.25.25 0 0 0 .22.368h12.164a.25.25 0 0 0 .22-.368Zm.53 3.996v2.5a.75.75 0 0 1-1.5 0v-2.5a.75.75 0 0 1 1.5 0ZM9 11a1 1 0 1 1-2 0 1 1 0 0 1 2 0Z'/%3E%3C/svg%3E")}` +
+	`.markdown-alert-caution{--alert-color:var(--alert-caution-color,#d1242f);--alert-icon:url("data:image/svg+xml,%3Csvg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'%3E%3Cpath d='M4.47.22A.749.749 0 0 1 5 0h6c.199 0 .389.079.53.22l4.25 4.25c.141.14.22.331.22.53v6a.749.749 0 0 1-.22.53l-4.25 4.25A.749.749 0 0 1 11 16H5a.749.749 0 0 1-.53-.22L.22 11.53A.749.749 0 0 1 0 11V5c0-.199.079-.389.22-.53Zm.84 1.28L1.5 5.31v5.38l3.81 3.81h5.38l3.81-3.81V5.31L10.69 1.5ZM8 4a.75.75 0 0 1 .75.75v3.5a.75.75 0 0 1-1.5 0v-3.5A.75.75 0 0 1 8 4Zm0 8a1 1 0 1 1 0-2 1 1 0 0 1 0 2Z'/%3E%3C/svg%3E")}`
@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -24,8 +27,27 @@ type App struct {
 	watchedFile      string
 	watchedThemeFile string
 	watchedThemeName string
+	watchedThemeDirs []string
 	searchResult     SearchResult
 	currentDocument  string
+	includesFor      string
+	includes         []string
+	shown            shownRender
+	renderGen        int
+	sanitized        []SanitizedBlock
+	ipc              net.Listener
+	launchGoto       *GotoRequest
+}
+
+// shownRender records what the preview currently displays, so the next render of the same
+// file can be sent as a patch.
+type shownRender struct {
+	path      string
+	theme     string
+	palette   string
+	fontScale int
+	scripts   bool
+	blocks    []string
 }
 
 // NewApp creates a new App application struct
@@ -41,20 +63,24 @@ func (a *App) startup(ctx context.Context) {
 	pending := append([]string(nil), a.pendingFileOpens...)
 	a.pendingFileOpens = nil
 	a.mu.Unlock()
-	var args []string
-	for _, raw := range os.Args[1:] {
-		if strings.HasPrefix(raw, "-psn_") {
-			continue
-		}
-		p := normalizePath(raw)
-		if p != "" {
-			args = append(args, p)
-		}
-	}
+	args, target, _ := parseLaunchArgs(os.Args[1:])
 	args = append(args, pending...)
+	if target != nil {
+		target.Line = renderedLine(target.Path, target.Line)
+	}
 	a.mu.Lock()
 	a.launchArgs = args
+	a.launchGoto = target
 	a.mu.Unlock()
+
+	if err := a.listenIPC(); err != nil {
+		println("IPC:", err.Error())
+	}
+}
+
+// shutdown is called when the app is closing.
+func (a *App) shutdown(ctx context.Context) {
+	a.closeIPC()
 }
 
 func (a *App) handleFileOpen(filePaths []string) {
@@ -112,11 +138,36 @@ func (a *App) Greet(name string) string {
 }
 
 type RenderResult struct {
-	Path      string    `json:"path"`
-	HTML      string    `json:"html"`
-	TOC       []TOCItem `json:"toc"`
-	CharCount int       `json:"charCount"`
-	WordCount int       `json:"wordCount"`
+	Path      string           `json:"path"`
+	HTML      string           `json:"html"`
+	TOC       []TOCItem        `json:"toc"`
+	CharCount int              `json:"charCount"`
+	WordCount int              `json:"wordCount"`
+	Includes  []string         `json:"includes"`
+	Partial   bool             `json:"partial"`
+	StreamID  int              `json:"streamId"`
+	Removed   []RemovedContent `json:"removed"`
+	// Title replaces the path in the title bar for virtual documents, which are read-only.
+	Title    string `json:"title,omitempty"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+}
+
+// RenderPatch updates the preview in place. When Full is set, HTML replaces the whole page;
+// otherwise Blocks lists every block in order and carries HTML only for new or changed ones.
+// Changed lists the blocks added or modified since the previous render of the same file.
+type RenderPatch struct {
+	Path      string           `json:"path"`
+	Full      bool             `json:"full"`
+	HTML      string           `json:"html"`
+	Blocks    []RenderedBlock  `json:"blocks"`
+	TOC       []TOCItem        `json:"toc"`
+	CharCount int              `json:"charCount"`
+	WordCount int              `json:"wordCount"`
+	Includes  []string         `json:"includes"`
+	Removed   []RemovedContent `json:"removed"`
+	Changed   []ChangedBlock   `json:"changed"`
+	// Progressive is set instead of the rest for files over `progressiveRenderKB`.
+	Progressive bool `json:"progressive"`
 }
 
 type StatusMessage struct {
@@ -149,6 +200,14 @@ type RecentFile struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+// Backlink is a line in another note that links to the current document
+type Backlink struct {
+	Path    string `json:"path"`
+	Title   string `json:"title"`
+	Line    int    `json:"line"`
+	Context string `json:"context"`
+}
+
 // ReadingProgress represents the reading progress for a file
 type ReadingProgress struct {
 	Path         string `json:"path"`
@@ -172,6 +231,10 @@ func (a *App) SetTheme(theme string) error {
 	if err := setThemeInConfig(theme); err != nil {
 		return err
 	}
+	// Choosing a package again picks up edits made while it wasn't watched.
+	if dir, ok := themePackageDir(theme); ok {
+		invalidateThemePackageCSS(dir)
+	}
 	// If auto-reload is active, refresh the watched theme file.
 	a.refreshThemeWatch(theme)
 	return nil
@@ -233,8 +296,11 @@ func (a *App) SetSearchHighlightColor(color string) error {
 	return setSearchHighlightColorInConfig(color)
 }
 
-func (a *App) ListThemes() ([]string, error) {
-	items := []string{"default"}
+// ListThemes lists the installed themes, "default" first: loose .css files and theme
+// packages, whose manifests are validated. Packages with problems are listed with them so the
+// menu can say what is wrong.
+func (a *App) ListThemes() ([]ThemeInfo, error) {
+	items := []ThemeInfo{cssThemeInfo("default")}
 
 	dir, err := themesDir()
 	if err != nil {
@@ -244,40 +310,37 @@ func (a *App) ListThemes() ([]string, error) {
 	if err != nil {
 		return items, nil
 	}
+	found := map[string]ThemeInfo{}
 	for _, e := range entries {
+		name := e.Name()
 		if e.IsDir() {
+			if isThemePackage(filepath.Join(dir, name)) && name != "default" {
+				found[name] = themeInfo(name, filepath.Join(dir, name))
+			}
 			continue
 		}
-		name := e.Name()
 		if !strings.HasSuffix(strings.ToLower(name), ".css") {
 			continue
 		}
 		name = strings.TrimSuffix(name, filepath.Ext(name))
-		if name == "" {
+		if name == "" || name == "default" {
 			continue
 		}
-		items = append(items, name)
-	}
-
-	seen := map[string]struct{}{}
-	uniq := make([]string, 0, len(items))
-	for _, it := range items {
-		if _, ok := seen[it]; ok {
-			continue
+		// A package takes precedence over a loose file of the same name, as when rendering.
+		if _, ok := found[name]; !ok {
+			found[name] = cssThemeInfo(name)
 		}
-		seen[it] = struct{}{}
-		uniq = append(uniq, it)
 	}
 
-	var defaultFirst []string
-	for _, it := range uniq {
-		if it == "default" {
-			continue
-		}
-		defaultFirst = append(defaultFirst, it)
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		items = append(items, found[id])
 	}
-	sort.Strings(defaultFirst)
-	return append([]string{"default"}, defaultFirst...), nil
+	return items, nil
 }
 
 func (a *App) RenderFile(path string, theme string) (string, error) {
@@ -286,14 +349,23 @@ func (a *App) RenderFile(path string, theme string) (string, error) {
 
 func (a *App) RenderFileWithPalette(path string, theme string, palette string) (string, error) {
 	path = normalizePath(path)
-	if err := enforceFileLimit(path); err != nil {
+	markdown, _, err := readDocument(path)
+	if err != nil {
 		return "", err
 	}
-	data, err := os.ReadFile(path)
+	output, err := RenderDocumentWithTOC(markdown, documentBase(path), theme, palette, getFontScaleFromConfig())
+	return output.HTML, err
+}
+
+// readDocument loads a Markdown file or virtual document with its include directives
+// expanded, returning the text and the files that were included.
+func readDocument(path string) (string, []string, error) {
+	data, base, err := loadDocument(path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return RenderMarkdownToHTMLDocument(string(data), theme, palette, getFontScaleFromConfig())
+	markdown, includes := expandIncludes(data, base)
+	return markdown, includes, nil
 }
 
 // countWords counts the number of words in a string
@@ -306,26 +378,31 @@ func countWords(s string) int {
 	return len(words)
 }
 
-// RenderFileWithPaletteAndTOC renders a file and returns HTML with TOC
+// RenderFileWithPaletteAndTOC renders a file and returns HTML with TOC. Files larger than
+// `progressiveRenderKB` come back Partial, with the rest following as render-chunk events.
 func (a *App) RenderFileWithPaletteAndTOC(path string, theme string, palette string) (RenderResult, error) {
 	path = normalizePath(path)
-	if err := enforceFileLimit(path); err != nil {
-		return RenderResult{}, err
+	gen := a.nextRenderGeneration()
+	if rendersProgressively(path) {
+		return a.renderProgressive(path, theme, palette, gen, a.emitRenderChunk)
 	}
-	data, err := os.ReadFile(path)
+
+	markdown, includes, err := readDocument(path)
 	if err != nil {
 		return RenderResult{}, err
 	}
 
-	markdown := string(data)
-	
 	// Store document content for searching
 	a.SetCurrentDocument(markdown)
-	
-	output, err := RenderMarkdownWithTOC(markdown, theme, palette, getFontScaleFromConfig())
+	a.setIncludes(path, includes)
+
+	fontScale := getFontScaleFromConfig()
+	output, err := RenderDocumentWithTOC(markdown, documentBase(path), theme, palette, fontScale)
 	if err != nil {
 		return RenderResult{}, err
 	}
+	a.setShown(shownRender{path: path, theme: theme, palette: palette, fontScale: fontScale, scripts: output.ClientScripts, blocks: blockIDs(output.Blocks)})
+	a.reportRemoved(output.Removed, output.Sanitized)
 
 	return RenderResult{
 		Path:      path,
@@ -333,12 +410,88 @@ func (a *App) RenderFileWithPaletteAndTOC(path string, theme string, palette str
 		TOC:       output.TOC,
 		CharCount: len(markdown),
 		WordCount: countWords(markdown),
+		Includes:  includes,
+		StreamID:  gen,
+		Removed:   output.Removed,
+		Title:     documentTitle(path),
+		ReadOnly:  isVirtualPath(path),
 	}, nil
 }
 
-func (a *App) OpenAndRender(theme string, palette string) (RenderResult, error) {
-	selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Open Markdown",
+// RenderFilePatch re-renders a file and returns only the blocks that differ from what the
+// preview is showing. It falls back to a full page when the file, theme, palette or font
+// scale differ from the last render, or when the page starts or stops needing scripts.
+// Files rendered progressively aren't patched: the patch only has Progressive set, and the
+// preview reloads them with RenderFileWithPaletteAndTOC.
+func (a *App) RenderFilePatch(path string, theme string, palette string) (RenderPatch, error) {
+	path = normalizePath(path)
+	a.nextRenderGeneration()
+	if rendersProgressively(path) {
+		return RenderPatch{Path: path, Progressive: true}, nil
+	}
+	markdown, includes, err := readDocument(path)
+	if err != nil {
+		return RenderPatch{}, err
+	}
+
+	a.SetCurrentDocument(markdown)
+	a.setIncludes(path, includes)
+
+	fontScale := getFontScaleFromConfig()
+	output, err := RenderDocumentWithTOC(markdown, documentBase(path), theme, palette, fontScale)
+	if err != nil {
+		return RenderPatch{}, err
+	}
+
+	next := shownRender{path: path, theme: theme, palette: palette, fontScale: fontScale, scripts: output.ClientScripts, blocks: blockIDs(output.Blocks)}
+	prev := a.setShown(next)
+	a.reportRemoved(output.Removed, output.Sanitized)
+
+	patch := RenderPatch{
+		Path:      path,
+		TOC:       output.TOC,
+		CharCount: len(markdown),
+		WordCount: countWords(markdown),
+		Includes:  includes,
+		Removed:   output.Removed,
+	}
+	if prev.path == next.path {
+		patch.Changed = changedBlocks(prev.blocks, output.Blocks)
+	}
+	if prev.path != next.path || prev.theme != next.theme || prev.palette != next.palette || prev.fontScale != next.fontScale || prev.scripts != next.scripts {
+		patch.Full = true
+		patch.HTML = output.HTML
+		return patch, nil
+	}
+
+	have := make(map[string]bool, len(prev.blocks))
+	for _, id := range prev.blocks {
+		have[id] = true
+	}
+	patch.Blocks = make([]RenderedBlock, len(output.Blocks))
+	for i, b := range output.Blocks {
+		if have[b.ID] {
+			b.HTML = ""
+		}
+		patch.Blocks[i] = b
+	}
+	return patch, nil
+}
+
+// setShown records the render now in the preview and returns the previous one.
+func (a *App) setShown(s shownRender) shownRender {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prev := a.shown
+	a.shown = s
+	return prev
+}
+
+// ChooseMarkdownFile asks for a Markdown file with the open dialog; it returns "" when the
+// dialog is cancelled.
+func (a *App) ChooseMarkdownFile(title string) (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: title,
 		Filters: []runtime.FileFilter{
 			{
 				DisplayName: "Markdown (*.md;*.markdown)",
@@ -346,6 +499,27 @@ func (a *App) OpenAndRender(theme string, palette string) (RenderResult, error)
 			},
 		},
 	})
+}
+
+// chooseExportFile asks where to export the document at path with the save dialog, offering
+// its name with ext in its folder; it returns "" when the dialog is cancelled.
+func (a *App) chooseExportFile(path, ext, filterName string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ext
+	return runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:            "Export " + name,
+		DefaultDirectory: filepath.Dir(path),
+		DefaultFilename:  name,
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: filterName,
+				Pattern:     "*" + ext,
+			},
+		},
+	})
+}
+
+func (a *App) OpenAndRender(theme string, palette string) (RenderResult, error) {
+	selection, err := a.ChooseMarkdownFile("Open Markdown")
 	if err != nil {
 		return RenderResult{}, err
 	}
@@ -379,6 +553,10 @@ func (a *App) StartWatchingFile(path string) error {
 	if path == "" {
 		return fmt.Errorf("invalid file path")
 	}
+	if isVirtualPath(path) {
+		// Piped text and old revisions never change
+		return nil
+	}
 
 	if _, err := os.Stat(path); err != nil {
 		return err
@@ -399,8 +577,16 @@ func (a *App) StartWatchingFile(path string) error {
 	a.mu.Lock()
 	a.watcher = watcher
 	a.watchedFile = path
+	var includes []string
+	if a.includesFor == path {
+		includes = append(includes, a.includes...)
+	}
 	a.mu.Unlock()
 
+	// Watch the folders of any transcluded files and of the notes its wikilinks resolve to
+	addIncludeWatches(watcher, dir, includes)
+	addDirWatches(watcher, noteWatchDirs(path))
+
 	// Also watch the current theme (if any)
 	a.refreshThemeWatch(getThemeFromConfig())
 
@@ -419,6 +605,7 @@ func (a *App) StopWatchingFile() {
 	a.watchedFile = ""
 	a.watchedThemeFile = ""
 	a.watchedThemeName = ""
+	a.watchedThemeDirs = nil
 	a.mu.Unlock()
 	
 	// Close watcher outside the lock to avoid blocking
@@ -447,13 +634,35 @@ func (a *App) watchLoop(watcher *fsnotify.Watcher, target string) {
 			ctx := a.ctx
 			a.mu.Unlock()
 
-			// Theme file changes
-			if changed == watchedTheme && themeName != "" && (event.Op&(fsnotify.Write|fsnotify.Create) != 0) {
+			// Theme file changes; a theme package is watched as a folder, subfolders included
+			if (changed == watchedTheme || strings.HasPrefix(changed, watchedTheme+string(filepath.Separator))) && themeName != "" && (event.Op&(fsnotify.Write|fsnotify.Create) != 0) {
+				if info, err := os.Stat(changed); err == nil && info.IsDir() {
+					a.addThemeDirWatches(watcher, changed)
+				}
+				invalidateThemePackageCSS(watchedTheme)
 				runtime.EventsEmit(ctx, "theme-changed", themeName)
 				continue
 			}
 
-			if changed != target {
+			// Engines installed or repositories set up since the last change are looked up
+			// again on the next render.
+			keyInputs.invalidate()
+
+			// Notes coming or going change which wikilinks resolve, and so do folders of notes.
+			// A new folder in the vault is watched before the index is dropped, so notes
+			// written into it are either in the rebuilt index or reported by the watch.
+			if event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+				info, err := os.Stat(changed)
+				created := err == nil && info.IsDir()
+				if created && len(noteWatchDirs(changed)) > 0 {
+					addDirWatches(watcher, noteDirsUnder(changed))
+				}
+				if isMarkdownFile(changed) || created || containsString(watcher.WatchList(), changed) {
+					invalidateNoteIndexes(changed)
+				}
+			}
+
+			if changed != target && !a.isWatchedInclude(target, changed) {
 				continue
 			}
 
@@ -500,8 +709,12 @@ func (a *App) refreshThemeWatch(themeName string) {
 	// Remove any previously watched theme file
 	a.mu.Lock()
 	oldThemeFile := a.watchedThemeFile
+	oldThemeDirs := a.watchedThemeDirs
 	a.mu.Unlock()
 	
+	for _, d := range oldThemeDirs {
+		_ = watcher.Remove(d)
+	}
 	if oldThemeFile != "" {
 		_ = watcher.Remove(oldThemeFile)
 		
@@ -509,6 +722,7 @@ func (a *App) refreshThemeWatch(themeName string) {
 		a.mu.Lock()
 		a.watchedThemeFile = ""
 		a.watchedThemeName = ""
+		a.watchedThemeDirs = nil
 		a.mu.Unlock()
 	}
 
@@ -523,11 +737,16 @@ func (a *App) refreshThemeWatch(themeName string) {
 	}
 
 	name := filepath.Base(themeName)
-	if !strings.HasSuffix(strings.ToLower(name), ".css") {
-		name += ".css"
+	p, isPackage := themePackageDir(themeName)
+	if !isPackage {
+		if !strings.HasSuffix(strings.ToLower(name), ".css") {
+			name += ".css"
+		}
+		p = filepath.Join(dir, name)
+		name = strings.TrimSuffix(name, filepath.Ext(name))
 	}
 
-	p := filepath.Clean(filepath.Join(dir, name))
+	p = filepath.Clean(p)
 	if err := watcher.Add(p); err != nil {
 		return
 	}
@@ -535,8 +754,94 @@ func (a *App) refreshThemeWatch(themeName string) {
 	// FIX: Write with mutex protection
 	a.mu.Lock()
 	a.watchedThemeFile = p
-	a.watchedThemeName = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	a.watchedThemeName = name
 	a.mu.Unlock()
+	if isPackage {
+		a.addThemeDirWatches(watcher, p)
+	}
+}
+
+// maxThemeDirs caps how many folders of a theme package are watched.
+const maxThemeDirs = 100
+
+// addThemeDirWatches watches dir and the folders below it in a theme package, where
+// stylesheets, fonts and images are often kept; fsnotify only reports changes one level deep.
+func (a *App) addThemeDirWatches(watcher *fsnotify.Watcher, dir string) {
+	var dirs []string
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if len(dirs) >= maxThemeDirs {
+			return filepath.SkipAll
+		}
+		if watcher.Add(p) == nil {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	a.mu.Lock()
+	a.watchedThemeDirs = append(a.watchedThemeDirs, dirs...)
+	a.mu.Unlock()
+}
+
+// setIncludes records the files transcluded into path by its latest render and, if path is
+// being watched, starts watching their folders as well.
+func (a *App) setIncludes(path string, includes []string) {
+	a.mu.Lock()
+	a.includesFor = path
+	a.includes = append([]string(nil), includes...)
+	watcher := a.watcher
+	watched := a.watchedFile
+	a.mu.Unlock()
+
+	if watcher != nil && watched == path {
+		addIncludeWatches(watcher, filepath.Dir(path), includes)
+		addDirWatches(watcher, noteWatchDirs(path))
+	}
+}
+
+func (a *App) isWatchedInclude(target, changed string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.includesFor != target {
+		return false
+	}
+	for _, p := range a.includes {
+		if p == changed {
+			return true
+		}
+	}
+	return false
+}
+
+// addDirWatches watches the folders in dirs that aren't watched yet.
+func addDirWatches(watcher *fsnotify.Watcher, dirs []string) {
+	watching := map[string]bool{}
+	for _, dir := range watcher.WatchList() {
+		watching[dir] = true
+	}
+	for _, dir := range dirs {
+		if !watching[dir] && watcher.Add(dir) == nil {
+			watching[dir] = true
+		}
+	}
+}
+
+func addIncludeWatches(watcher *fsnotify.Watcher, docDir string, includes []string) {
+	watching := map[string]bool{docDir: true}
+	for _, dir := range watcher.WatchList() {
+		watching[dir] = true
+	}
+	for _, p := range includes {
+		dir := filepath.Dir(p)
+		if watching[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err == nil {
+			watching[dir] = true
+		}
+	}
 }
 
 func enforceFileLimit(path string) error {
@@ -557,6 +862,10 @@ func normalizePath(p string) string {
 		return ""
 	}
 
+	if isVirtualPath(p) {
+		return p
+	}
+
 	p = strings.TrimPrefix(p, "file://")
 
 	if p == "~" || strings.HasPrefix(p, "~/") {
@@ -578,6 +887,48 @@ func normalizePath(p string) string {
 	return filepath.Clean(p)
 }
 
+// GetRenderCacheStats returns render cache hit/miss counters for diagnostics
+func (a *App) GetRenderCacheStats() RenderCacheStats {
+	return sharedRenderer().CacheStats()
+}
+
+// GetBacklinks returns the links in the surrounding notes folder that point at path
+func (a *App) GetBacklinks(path string) ([]Backlink, error) {
+	path = normalizePath(path)
+	if path == "" || isVirtualPath(path) {
+		return []Backlink{}, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	links := findBacklinks(path)
+	if links == nil {
+		links = []Backlink{}
+	}
+	return links, nil
+}
+
+// ResolveLink turns a relative link in the rendered document at fromPath into an absolute path
+func (a *App) ResolveLink(fromPath string, href string) (string, error) {
+	fromPath = documentBase(normalizePath(fromPath))
+	if fromPath == "" {
+		return "", fmt.Errorf("no document loaded")
+	}
+	dest, _, _ := strings.Cut(href, "#")
+	dest, err := url.PathUnescape(dest)
+	if err != nil {
+		return "", err
+	}
+	if dest == "" || strings.Contains(dest, "://") {
+		return "", fmt.Errorf("not a local link: %s", href)
+	}
+	p := filepath.Clean(filepath.Join(filepath.Dir(fromPath), filepath.FromSlash(dest)))
+	if _, err := os.Stat(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
 // SearchDocument searches for text in the current document
 func (a *App) SearchDocument(query string, caseSensitive bool) (SearchResult, error) {
 	a.mu.Lock()
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// RenderedBlock is one top-level block of a rendered document. ID is derived from the block's
+// HTML, so it stays the same across renders for as long as the block does not change.
+// Line and EndLine are the 1-based source lines the block spans.
+type RenderedBlock struct {
+	ID      string `json:"id"`
+	HTML    string `json:"html"`
+	Line    int    `json:"line"`
+	EndLine int    `json:"endLine"`
+}
+
+// blockCSS keeps the per-block wrappers out of the layout, and briefly highlights the blocks
+// that changed when a file reloads.
+const blockCSS = `.mdr-block{display:contents}` +
+	`.mdr-changed>*{animation:mdr-changed 2.5s ease-out}` +
+	`@keyframes mdr-changed{from{background-color:rgba(255,200,0,.35);box-shadow:-6px 0 0 rgba(255,200,0,.8)}to{background-color:transparent;box-shadow:-6px 0 0 transparent}}`
+
+var (
+	htmlTagPattern        = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)[^>]*?(/?)>`)
+	diagramIDAttrPattern  = regexp.MustCompile(`id="mdr-diagram-\d+"`)
+	sourceLineAttrPattern = regexp.MustCompile(`data-source-line="(\d+)"`)
+	setextUnderline       = regexp.MustCompile(`^ {0,3}(?:=+|-+)[ \t]*\r?\n?$`)
+)
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlTagBalance returns how many more elements raw opens than it closes.
+func htmlTagBalance(raw string) int {
+	depth := 0
+	for _, m := range htmlTagPattern.FindAllStringSubmatch(raw, -1) {
+		switch {
+		case voidElements[strings.ToLower(m[2])] || m[3] == "/":
+		case m[1] == "/":
+			depth--
+		default:
+			depth++
+		}
+	}
+	return depth
+}
+
+// blockGroups splits the document's top-level blocks into the units that are rendered and
+// patched independently. Raw HTML such as `<details>` that stays open across several
+// Markdown blocks keeps them together so each unit is well-formed on its own.
+func blockGroups(doc ast.Node, source []byte) [][]ast.Node {
+	var groups [][]ast.Node
+	depth := 0
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		if depth > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], n)
+		} else {
+			groups = append(groups, []ast.Node{n})
+		}
+		if hb, ok := n.(*ast.HTMLBlock); ok {
+			var raw strings.Builder
+			lines := hb.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				raw.Write(line.Value(source))
+			}
+			if hb.HasClosure() {
+				closure := hb.ClosureLine
+				raw.Write(closure.Value(source))
+			}
+			if depth += htmlTagBalance(raw.String()); depth < 0 {
+				depth = 0
+			}
+		}
+	}
+	return groups
+}
+
+// blockID hashes a block's final HTML. Diagram placeholder IDs are numbered by position, so
+// they are left out to keep a diagram's block ID stable when others are added above it, and
+// source lines are taken relative to the block's first line for the same reason.
+// Repeated identical blocks are told apart by their occurrence count.
+func blockID(html string, line int, seen map[string]int) string {
+	html = diagramIDAttrPattern.ReplaceAllString(html, `id="mdr-diagram"`)
+	html = sourceLineAttrPattern.ReplaceAllStringFunc(html, func(attr string) string {
+		n, _ := strconv.Atoi(sourceLineAttrPattern.FindStringSubmatch(attr)[1])
+		return sourceLineAttr + `="` + strconv.Itoa(n-line) + `"`
+	})
+	sum := sha256.Sum256([]byte(html))
+	id := "b" + hex.EncodeToString(sum[:6])
+	seen[id]++
+	if n := seen[id]; n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+// wrapBlock marks a block in the page so the preview can patch it in place and map it back
+// to its source lines.
+func wrapBlock(b RenderedBlock) string {
+	return `<div class="mdr-block" data-block="` + b.ID + `" data-source-line="` + strconv.Itoa(b.Line) +
+		`" data-source-end="` + strconv.Itoa(b.EndLine) + `">` + b.HTML + `</div>`
+}
+
+// lineIndex maps byte offsets in a document to 1-based line numbers.
+type lineIndex struct {
+	source []byte
+	starts []int
+}
+
+func newLineIndex(source []byte) *lineIndex {
+	starts := []int{0}
+	for i, c := range source {
+		if c == '\n' && i+1 < len(source) {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineIndex{source: source, starts: starts}
+}
+
+// line returns the line holding offset.
+func (li *lineIndex) line(offset int) int {
+	return sort.Search(len(li.starts), func(i int) bool { return li.starts[i] > offset })
+}
+
+// nextNonBlank returns the first line at or after line that has any text, or line itself
+// when the rest of the document is blank.
+func (li *lineIndex) nextNonBlank(line int) int {
+	for l := line; l <= len(li.starts); l++ {
+		if len(bytes.TrimSpace(li.text(l))) > 0 {
+			return l
+		}
+	}
+	return line
+}
+
+// segmentBounds returns the smallest start and largest stop offsets of the source segments
+// under n, or -1, -1 when n has none (thematic breaks, for example).
+func segmentBounds(n ast.Node) (int, int) {
+	lo, hi := -1, -1
+	widen := func(start, stop int) {
+		if lo < 0 || start < lo {
+			lo = start
+		}
+		if stop > hi {
+			hi = stop
+		}
+	}
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			widen(c.Segment.Start, c.Segment.Stop)
+		case *ast.HTMLBlock:
+			if c.HasClosure() {
+				widen(c.ClosureLine.Start, c.ClosureLine.Stop)
+			}
+		}
+		if c.Type() == ast.TypeBlock {
+			if lines := c.Lines(); lines.Len() > 0 {
+				widen(lines.At(0).Start, lines.At(lines.Len()-1).Stop)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return lo, hi
+}
+
+// groupLines returns the source lines a block group spans. prevEnd is the last line of the
+// previous group. Fenced code and the diagrams made from it are found by scanning, since
+// their segments leave out the fences.
+func groupLines(group []ast.Node, li *lineIndex, prevEnd int) (int, int) {
+	lo, hi := -1, -1
+	for _, n := range group {
+		start, stop := segmentBounds(n)
+		if start < 0 {
+			continue
+		}
+		if lo < 0 || start < lo {
+			lo = start
+		}
+		if stop > hi {
+			hi = stop
+		}
+	}
+
+	first := li.nextNonBlank(prevEnd + 1)
+	if !isFenced(group[0]) && lo >= 0 {
+		first = li.line(lo)
+	}
+	last := first
+	if hi > lo {
+		last = max(li.line(hi-1), first)
+	}
+	switch group[len(group)-1].(type) {
+	case *ast.FencedCodeBlock, *Diagram:
+		last++ // the closing fence
+	case *ast.Heading:
+		atx := bytes.HasPrefix(bytes.TrimLeft(li.text(first), " "), []byte("#"))
+		if !atx && setextUnderline.Match(li.text(last+1)) {
+			last++
+		}
+	}
+	return first, last
+}
+
+// isFenced reports whether n is a fenced code block or a diagram rendered from one.
+func isFenced(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.FencedCodeBlock, *Diagram:
+		return true
+	}
+	return false
+}
+
+// text returns the content of a line, or nil past the end of the document.
+func (li *lineIndex) text(line int) []byte {
+	if line < 1 || line > len(li.starts) {
+		return nil
+	}
+	end := len(li.source)
+	if line < len(li.starts) {
+		end = li.starts[line]
+	}
+	return li.source[li.starts[line-1]:end]
+}
+
+// blockIDs lists the IDs of blocks in order.
+func blockIDs(blocks []RenderedBlock) []string {
+	ids := make([]string, len(blocks))
+	for i, b := range blocks {
+		ids[i] = b.ID
+	}
+	return ids
+}
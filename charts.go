@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// chartColors is the series palette for embedded charts; it reads well on light and dark.
+var chartColors = []string{"#4e79a7", "#f28e2b", "#59a14f", "#e15759", "#76b7b2", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+type chartPoint struct {
+	label string
+	value float64
+}
+
+type chartSpec struct {
+	kind   string
+	title  string
+	points []chartPoint
+}
+
+// parseChart reads the `chart` block format: optional `type:` (bar, line or pie) and
+// `title:` lines followed by one `label: value` line per data point.
+func parseChart(source []byte) (chartSpec, error) {
+	spec := chartSpec{kind: "bar"}
+	for i, raw := range strings.Split(string(source), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndex(line, ":")
+		if idx < 0 {
+			return spec, fmt.Errorf("line %d: expected `label: value`", i+1)
+		}
+		k := strings.TrimSpace(line[:idx])
+		v := strings.TrimSpace(line[idx+1:])
+		switch strings.ToLower(k) {
+		case "type":
+			spec.kind = strings.ToLower(v)
+			if spec.kind != "bar" && spec.kind != "line" && spec.kind != "pie" {
+				return spec, fmt.Errorf("line %d: unknown chart type %q (use bar, line or pie)", i+1, v)
+			}
+			continue
+		case "title":
+			spec.title = v
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		// ParseFloat accepts "NaN" and "Inf", which can't be drawn.
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return spec, fmt.Errorf("line %d: %q is not a number", i+1, v)
+		}
+		spec.points = append(spec.points, chartPoint{label: k, value: n})
+	}
+	if len(spec.points) == 0 {
+		return spec, fmt.Errorf("chart has no data points")
+	}
+	return spec, nil
+}
+
+// chartRenderer draws simple bar, line and pie charts without any external engine.
+type chartRenderer struct{}
+
+func (r *chartRenderer) Name() string {
+	return "built-in chart renderer"
+}
+
+func (r *chartRenderer) Available() bool {
+	return true
+}
+
+func (r *chartRenderer) Render(source []byte) ([]byte, error) {
+	spec, err := parseChart(source)
+	if err != nil {
+		return nil, err
+	}
+	const width, height = 640, 360
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" font-family="sans-serif" font-size="12" role="img">`, width, height, width, height)
+	top := 20.0
+	if spec.title != "" {
+		fmt.Fprintf(&b, `<text x="%d" y="22" text-anchor="middle" font-size="16" font-weight="600" fill="currentColor">%s</text>`, width/2, html.EscapeString(spec.title))
+		top = 44
+	}
+	switch spec.kind {
+	case "pie":
+		drawPie(&b, spec.points, width, height, top)
+	default:
+		drawAxisChart(&b, spec, width, height, top)
+	}
+	b.WriteString(`</svg>`)
+	return b.Bytes(), nil
+}
+
+func drawAxisChart(b *bytes.Buffer, spec chartSpec, width, height int, top float64) {
+	left, right, bottom := 56.0, 16.0, 48.0
+	plotW := float64(width) - left - right
+	plotH := float64(height) - top - bottom
+
+	lo, hi := 0.0, 0.0
+	for _, p := range spec.points {
+		lo = math.Min(lo, p.value)
+		hi = math.Max(hi, p.value)
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+	y := func(v float64) float64 { return top + plotH - (v-lo)/(hi-lo)*plotH }
+
+	// Axes and gridlines
+	for i := 0; i <= 4; i++ {
+		v := lo + (hi-lo)*float64(i)/4
+		fmt.Fprintf(b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="currentColor" stroke-opacity="0.15"/>`, left, y(v), left+plotW, y(v))
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="end" dominant-baseline="middle" fill="currentColor">%s</text>`, left-6, y(v), strconv.FormatFloat(v, 'g', 4, 64))
+	}
+	fmt.Fprintf(b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="currentColor" stroke-opacity="0.6"/>`, left, y(0), left+plotW, y(0))
+
+	step := plotW / float64(len(spec.points))
+	var pts []string
+	for i, p := range spec.points {
+		cx := left + step*(float64(i)+0.5)
+		if spec.kind == "line" {
+			pts = append(pts, fmt.Sprintf("%.1f,%.1f", cx, y(p.value)))
+		} else {
+			barW := step * 0.7
+			y0, y1 := y(0), y(p.value)
+			fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+				cx-barW/2, math.Min(y0, y1), barW, math.Abs(y0-y1), chartColors[i%len(chartColors)],
+				html.EscapeString(p.label), strconv.FormatFloat(p.value, 'g', -1, 64))
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="currentColor">%s</text>`, cx, top+plotH+18, html.EscapeString(p.label))
+	}
+	if spec.kind == "line" {
+		fmt.Fprintf(b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(pts, " "), chartColors[0])
+		for i, p := range spec.points {
+			cx := left + step*(float64(i)+0.5)
+			fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="3.5" fill="%s"><title>%s: %s</title></circle>`,
+				cx, y(p.value), chartColors[0], html.EscapeString(p.label), strconv.FormatFloat(p.value, 'g', -1, 64))
+		}
+	}
+}
+
+func drawPie(b *bytes.Buffer, points []chartPoint, width, height int, top float64) {
+	total := 0.0
+	for _, p := range points {
+		if p.value > 0 {
+			total += p.value
+		}
+	}
+	if total == 0 {
+		return
+	}
+	radius := math.Min(float64(height)-top-20, float64(width)/2) / 2
+	cx, cy := float64(width)/3, top+(float64(height)-top)/2
+	angle := -math.Pi / 2
+	for i, p := range points {
+		if p.value <= 0 {
+			continue
+		}
+		sweep := p.value / total * 2 * math.Pi
+		color := chartColors[i%len(chartColors)]
+		title := fmt.Sprintf("%s: %s", html.EscapeString(p.label), strconv.FormatFloat(p.value, 'g', -1, 64))
+		if sweep >= 2*math.Pi-1e-9 {
+			fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"><title>%s</title></circle>`, cx, cy, radius, color, title)
+		} else {
+			x0, y0 := cx+radius*math.Cos(angle), cy+radius*math.Sin(angle)
+			x1, y1 := cx+radius*math.Cos(angle+sweep), cy+radius*math.Sin(angle+sweep)
+			large := 0
+			if sweep > math.Pi {
+				large = 1
+			}
+			fmt.Fprintf(b, `<path d="M%.1f,%.1f L%.1f,%.1f A%.1f,%.1f 0 %d 1 %.1f,%.1f Z" fill="%s"><title>%s</title></path>`,
+				cx, cy, x0, y0, radius, radius, large, x1, y1, color, title)
+		}
+		angle += sweep
+
+		// Legend
+		ly := top + 10 + float64(i)*20
+		lx := float64(width)*2/3 - 20
+		fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s"/>`, lx, ly, color)
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" dominant-baseline="middle" fill="currentColor">%s (%.0f%%)</text>`, lx+18, ly+6, html.EscapeString(p.label), p.value/total*100)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/yuin/goldmark/ast"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// clipboardFont is the font stack of copied HTML, matching the preview's.
+const clipboardFont = `-apple-system,BlinkMacSystemFont,Segoe UI,Roboto,Helvetica Neue,Arial,sans-serif`
+
+// clipboardMono is the font stack of copied code.
+const clipboardMono = `ui-monospace,SFMono-Regular,Menlo,Consolas,monospace`
+
+// clipboardStyles are the inline styles copied HTML gets per element, in the light palette,
+// since mail and chat clients drop stylesheets.
+var clipboardStyles = map[string]string{
+	"h1":         "font-size:2em;font-weight:600;margin:24px 0 16px;padding-bottom:.3em;border-bottom:1px solid #d0d7de",
+	"h2":         "font-size:1.5em;font-weight:600;margin:24px 0 16px;padding-bottom:.3em;border-bottom:1px solid #d0d7de",
+	"h3":         "font-size:1.25em;font-weight:600;margin:24px 0 16px",
+	"h4":         "font-size:1em;font-weight:600;margin:24px 0 16px",
+	"h5":         "font-size:.875em;font-weight:600;margin:24px 0 16px",
+	"h6":         "font-size:.85em;font-weight:600;margin:24px 0 16px;color:#57606a",
+	"p":          "margin:0 0 16px",
+	"a":          "color:#0969da",
+	"code":       "font-family:" + clipboardMono + ";font-size:85%;background:#f6f8fa;padding:2px 4px;border-radius:6px",
+	"pre":        "font-family:" + clipboardMono + ";font-size:85%;background:#f6f8fa;padding:12px;border-radius:8px;overflow:auto;margin:0 0 16px",
+	"blockquote": "margin:0 0 16px;padding:0 14px;color:#57606a;border-left:4px solid #d0d7de",
+	"table":      "border-collapse:collapse;margin:0 0 16px",
+	"th":         "border:1px solid #d0d7de;padding:6px 10px;font-weight:600",
+	"td":         "border:1px solid #d0d7de;padding:6px 10px",
+	"hr":         "border:0;border-top:1px solid #d0d7de;margin:24px 0",
+	"img":        "max-width:100%",
+	"ul":         "padding-left:2em;margin:0 0 16px",
+	"ol":         "padding-left:2em;margin:0 0 16px",
+}
+
+// whitespaceRun matches the whitespace plain text copies collapse to one space.
+var whitespaceRun = regexp.MustCompile(`\s+`)
+
+// clipboardTextBlocks are the elements plain text copies start on a line of their own.
+var clipboardTextBlocks = map[string]int{
+	"p": 2, "h1": 2, "h2": 2, "h3": 2, "h4": 2, "h5": 2, "h6": 2, "pre": 2, "blockquote": 2,
+	"ul": 2, "ol": 2, "table": 2, "hr": 2, "div": 1, "li": 1, "tr": 1, "figure": 2, "dl": 2, "dt": 1, "dd": 1,
+}
+
+// ClipboardContent is what a copy put on the clipboard. Text is the plain text, the Markdown
+// or, for HTML copies, the plain-text fallback; HTML is only set for HTML copies, for the
+// frontend to add as rich text.
+type ClipboardContent struct {
+	Format string `json:"format"`
+	HTML   string `json:"html"`
+	Text   string `json:"text"`
+}
+
+// CopySection copies the section under the heading headingID, or the whole document when it
+// is empty, as "html" (rendered with inline styles), "text" or "markdown" (the section's
+// exact source).
+func (a *App) CopySection(path string, headingID string, format string) (ClipboardContent, error) {
+	path = normalizePath(path)
+	markdown, _, err := readDocument(path)
+	if err != nil {
+		return ClipboardContent{}, err
+	}
+	content, err := sharedRenderer().SectionContent(markdown, documentBase(path), headingID, format)
+	if err != nil {
+		return ClipboardContent{}, err
+	}
+	if err := runtime.ClipboardSetText(a.ctx, content.Text); err != nil {
+		return ClipboardContent{}, err
+	}
+	return content, nil
+}
+
+// SectionContent returns the section under headingID, or the whole document when it is
+// empty, in format.
+func (r *Renderer) SectionContent(markdown, docPath, headingID, format string) (ClipboardContent, error) {
+	source, line, err := r.sectionSource(markdown, docPath, headingID)
+	if err != nil {
+		return ClipboardContent{}, err
+	}
+	content := ClipboardContent{Format: format}
+	if format == "markdown" {
+		content.Text = source
+		return content, nil
+	}
+	if format != "html" && format != "text" {
+		return ClipboardContent{}, fmt.Errorf("unknown copy format %q", format)
+	}
+
+	st := r.newRenderState(htmlProfileForPath(docPath))
+	st.lineOffset = line
+	_, blocks, _, err := r.renderBody(source, docPath, st)
+	if err != nil {
+		return ClipboardContent{}, err
+	}
+	var fragment strings.Builder
+	for _, block := range blocks {
+		fragment.WriteString(block.HTML)
+	}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(fragment.String()), &xhtml.Node{Type: xhtml.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return ClipboardContent{}, err
+	}
+	content.Text = clipboardText(nodes)
+	if format == "html" {
+		content.HTML = clipboardHTML(nodes, filepath.Dir(docPath))
+	}
+	return content, nil
+}
+
+// sectionSource returns the Markdown of the section under headingID, from its heading's line
+// to the next heading of the same or a higher level, and the number of lines before it. An
+// empty headingID selects the whole document.
+func (r *Renderer) sectionSource(markdown, docPath, id string) (string, int, error) {
+	if id == "" {
+		return markdown, 0, nil
+	}
+	source := []byte(markdown)
+	doc := r.parse(source, docPath, newLineIndex(source), nil)
+	extractTOC(source, doc, map[string]int{})
+
+	start, end, level := -1, len(source), 0
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !entering || !ok || h.Lines().Len() == 0 {
+			return ast.WalkContinue, nil
+		}
+		lineStart := h.Lines().At(0).Start
+		for lineStart > 0 && source[lineStart-1] != '\n' {
+			lineStart--
+		}
+		switch {
+		case start < 0 && headingID(h) == id:
+			start, level = lineStart, h.Level
+		case start >= 0 && h.Level <= level:
+			end = lineStart
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if start < 0 {
+		return "", 0, fmt.Errorf("no section %q in this document", id)
+	}
+	section := strings.TrimRight(string(source[start:end]), " \t\r\n") + "\n"
+	return section, strings.Count(markdown[:start], "\n"), nil
+}
+
+// clipboardHTML renders nodes with inline styles, without scripts or the preview's data
+// attributes, and with local images embedded as data URLs so they survive pasting.
+func clipboardHTML(nodes []*xhtml.Node, dir string) string {
+	var b strings.Builder
+	b.WriteString(`<div style="font-family:` + clipboardFont + `;line-height:1.55;color:#1f2328">`)
+	for _, n := range nodes {
+		styleForClipboard(n, dir)
+		if n.Type == xhtml.ElementNode && n.Data == "script" {
+			continue
+		}
+		xhtml.Render(&b, n)
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
+
+// styleForClipboard prepares n and its descendants for clipboardHTML.
+func styleForClipboard(n *xhtml.Node, dir string) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == xhtml.ElementNode && c.Data == "script" || c.Type == xhtml.CommentNode {
+			n.RemoveChild(c)
+		} else {
+			styleForClipboard(c, dir)
+		}
+		c = next
+	}
+	if n.Type != xhtml.ElementNode || n.Namespace != "" {
+		return
+	}
+	attrs := n.Attr[:0]
+	style := clipboardStyles[n.Data]
+	if n.Data == "code" && n.Parent != nil && n.Parent.Data == "pre" {
+		style = "font-family:" + clipboardMono
+	}
+	for _, a := range n.Attr {
+		switch {
+		case strings.HasPrefix(a.Key, "data-"):
+			continue
+		case a.Key == "style":
+			style = strings.TrimSuffix(style+";"+a.Val, ";")
+			continue
+		case a.Key == "src" && n.Data == "img":
+			a.Val = clipboardImageSrc(a.Val, dir)
+		}
+		attrs = append(attrs, a)
+	}
+	if style = strings.TrimPrefix(style, ";"); style != "" {
+		attrs = append(attrs, xhtml.Attribute{Key: "style", Val: style})
+	}
+	n.Attr = attrs
+}
+
+// clipboardImageSrc returns a local image as a data URL, and any other src unchanged.
+func clipboardImageSrc(src, dir string) string {
+	p, ok := localImagePath(src, dir)
+	if !ok {
+		return src
+	}
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(strings.ToLower(filepath.Ext(p))), ";")
+	if !strings.HasPrefix(mediaType, "image/") || enforceFileLimit(p) != nil {
+		return src
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return src
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// textWriter builds the plain text of rendered HTML, separating blocks with newlines.
+type textWriter struct {
+	b       bytes.Buffer
+	pending int
+	pre     int
+	// lists holds the next number of each open list, 0 for bullet lists.
+	lists []int
+}
+
+// breakLine asks for at least n newlines before the next text.
+func (t *textWriter) breakLine(n int) {
+	if t.b.Len() > 0 && n > t.pending {
+		t.pending = n
+	}
+}
+
+// write writes text, collapsing its whitespace outside code blocks and dropping it at the
+// start of lines.
+func (t *textWriter) write(s string) {
+	if t.pre == 0 {
+		s = whitespaceRun.ReplaceAllString(s, " ")
+		text := t.b.Bytes()
+		if t.pending > 0 || len(text) == 0 || strings.ContainsRune("\n\t ", rune(text[len(text)-1])) {
+			s = strings.TrimLeft(s, " ")
+		}
+		if s == "" {
+			return
+		}
+	}
+	t.raw(s)
+}
+
+// raw writes s as it is, after any pending newlines. Spaces before a line break or tab are
+// dropped.
+func (t *textWriter) raw(s string) {
+	if t.pending > 0 || strings.HasPrefix(s, "\n") || strings.HasPrefix(s, "\t") {
+		t.b.Truncate(len(bytes.TrimRight(t.b.Bytes(), " ")))
+	}
+	if t.pending > 0 {
+		written := len(t.b.Bytes()) - len(bytes.TrimRight(t.b.Bytes(), "\n"))
+		t.b.WriteString(strings.Repeat("\n", max(t.pending-written, 0)))
+		t.pending = 0
+	}
+	t.b.WriteString(s)
+}
+
+// clipboardText returns the plain text of nodes: blocks on lines of their own, list items
+// marked, table cells separated by tabs, code kept as it is.
+func clipboardText(nodes []*xhtml.Node) string {
+	t := &textWriter{}
+	for _, n := range nodes {
+		t.node(n)
+	}
+	return strings.TrimSpace(t.b.String()) + "\n"
+}
+
+func (t *textWriter) node(n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		t.write(n.Data)
+		return
+	case xhtml.ElementNode:
+	default:
+		return
+	}
+	switch n.Data {
+	case "script", "style":
+		return
+	case "br":
+		t.raw("\n")
+		return
+	case "img":
+		t.write(attrValue(n.Attr, "alt"))
+		return
+	case "input":
+		box := "[ ] "
+		for _, a := range n.Attr {
+			if a.Key == "checked" {
+				box = "[x] "
+			}
+		}
+		t.raw(box)
+		return
+	case "td", "th":
+		for prev := n.PrevSibling; prev != nil; prev = prev.PrevSibling {
+			if prev.Type == xhtml.ElementNode {
+				t.raw("\t")
+				break
+			}
+		}
+	case "ul", "ol":
+		next := 0
+		if n.Data == "ol" {
+			next = 1
+			if start, err := strconv.Atoi(attrValue(n.Attr, "start")); err == nil {
+				next = start
+			}
+		}
+		t.lists = append(t.lists, next)
+		defer func() { t.lists = t.lists[:len(t.lists)-1] }()
+	case "pre":
+		t.pre++
+		defer func() { t.pre-- }()
+	}
+
+	lines, block := clipboardTextBlocks[n.Data]
+	if block && len(t.lists) > 0 && n.Data != "pre" && n.Data != "table" {
+		// Keep list items and the paragraphs and lists inside them together.
+		lines = 1
+	}
+	if block {
+		t.breakLine(lines)
+	}
+	if n.Data == "li" && len(t.lists) > 0 {
+		depth := len(t.lists) - 1
+		marker := "- "
+		if num := t.lists[depth]; num > 0 {
+			marker = strconv.Itoa(num) + ". "
+			t.lists[depth]++
+		}
+		t.raw(strings.Repeat("  ", depth) + marker)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.node(c)
+	}
+	if block {
+		t.breakLine(lines)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -418,7 +419,7 @@ func setRecentFilesInConfig(files []RecentFile) error {
 
 func addRecentFile(path string) error {
 	path = normalizePath(path)
-	if path == "" {
+	if path == "" || isVirtualPath(path) {
 		return nil
 	}
 
@@ -571,3 +572,157 @@ func setReadingProgressInConfig(path string, scrollPosition int) error {
 	cfg["readingProgress"] = strings.Join(entries, ",")
 	return writeConfig(cfg)
 }
+
+// getRepoBaseURLFromConfig returns the repository web URL used for issue, mention and
+// commit autolinks (e.g. https://github.com/owner/repo), or "" to auto-detect from git.
+func getRepoBaseURLFromConfig() string {
+	cfg, err := readConfig()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(strings.TrimSpace(cfg["repoBaseURL"]), "/")
+}
+
+// getDiagramBinDirsFromConfig returns extra directories to search for diagram engines
+// (dot, plantuml, mmdc, ...), from the colon- or semicolon-separated `diagramBinDirs` key.
+func getDiagramBinDirsFromConfig() []string {
+	cfg, err := readConfig()
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, d := range strings.FieldsFunc(cfg["diagramBinDirs"], func(r rune) bool { return r == ':' || r == ';' }) {
+		if d = strings.TrimSpace(d); d != "" {
+			dirs = append(dirs, normalizePath(d))
+		}
+	}
+	return dirs
+}
+
+// getProgressiveRenderBytesFromConfig returns the file size above which documents are
+// rendered progressively (`progressiveRenderKB`, default 1024). 0 turns progressive
+// rendering off.
+func getProgressiveRenderBytesFromConfig() int64 {
+	cfg, err := readConfig()
+	if err != nil {
+		return 1024 * 1024
+	}
+
+	v := strings.TrimSpace(cfg["progressiveRenderKB"])
+	if v == "" {
+		return 1024 * 1024
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 1024 * 1024
+	}
+	return int64(n) * 1024
+}
+
+// getSingleInstanceFromConfig reports whether launching mdr while it is already running
+// hands the files to the running instance (`singleInstance`, default true).
+func getSingleInstanceFromConfig() bool {
+	cfg, err := readConfig()
+	if err != nil {
+		return true
+	}
+
+	v := strings.TrimSpace(cfg["singleInstance"])
+	return v != "false" && v != "0" && v != "no"
+}
+
+// slideSplits are the ways slides mode cuts a document: at `---` only ("hr"), or also before
+// every heading up to a level ("h1" to "h3").
+var slideSplits = []string{"hr", "h1", "h2", "h3"}
+
+func getSlideSplitFromConfig() string {
+	cfg, err := readConfig()
+	if err != nil {
+		return "hr"
+	}
+
+	v := strings.TrimSpace(cfg["slideSplit"])
+	if containsString(slideSplits, v) {
+		return v
+	}
+	return "hr"
+}
+
+func setSlideSplitInConfig(split string) error {
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	split = strings.TrimSpace(split)
+	if !containsString(slideSplits, split) {
+		split = "hr"
+	}
+	cfg["slideSplit"] = split
+	return writeConfig(cfg)
+}
+
+// htmlPolicySettings is the HTML sanitisation config: the default profile (`htmlPolicy`),
+// per-directory overrides and custom profile definitions.
+type htmlPolicySettings struct {
+	Default string
+	Dirs    map[string]string
+	Custom  map[string]htmlProfile
+}
+
+// getHTMLPolicySettingsFromConfig reads the sanitisation settings:
+//
+//	htmlPolicy=standard
+//	htmlPolicyDirs=~/src/ourteam|trusted,~/Downloads|strict
+//	htmlPolicy.docs.base=strict
+//	htmlPolicy.docs.elements=kbd,sub,sup
+//	htmlPolicy.docs.attrs=lang align@p,div
+func getHTMLPolicySettingsFromConfig() htmlPolicySettings {
+	settings := htmlPolicySettings{
+		Default: htmlProfileStandard,
+		Dirs:    map[string]string{},
+		Custom:  map[string]htmlProfile{},
+	}
+	cfg, err := readConfig()
+	if err != nil {
+		return settings
+	}
+
+	if v := strings.TrimSpace(cfg["htmlPolicy"]); v != "" {
+		settings.Default = strings.ToLower(v)
+	}
+	for _, entry := range strings.Split(cfg["htmlPolicyDirs"], ",") {
+		dir, profile, ok := strings.Cut(entry, "|")
+		if !ok || strings.TrimSpace(dir) == "" || strings.TrimSpace(profile) == "" {
+			continue
+		}
+		settings.Dirs[normalizePath(dir)] = strings.ToLower(strings.TrimSpace(profile))
+	}
+	for k, v := range cfg {
+		rest, ok := strings.CutPrefix(k, "htmlPolicy.")
+		if !ok {
+			continue
+		}
+		name, field, ok := strings.Cut(rest, ".")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			continue
+		}
+		p, exists := settings.Custom[name]
+		if !exists {
+			p = htmlProfile{Name: name, Base: htmlProfileStrict}
+		}
+		switch field {
+		case "base":
+			if b := strings.ToLower(v); b == htmlProfileStrict || b == htmlProfileStandard || b == htmlProfileTrusted {
+				p.Base = b
+			}
+		case "elements":
+			p.Elements = splitList(v)
+		case "attrs":
+			p.Attrs = parseHTMLAttrRules(v)
+		}
+		settings.Custom[name] = p
+	}
+	return settings
+}
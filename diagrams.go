@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// DiagramRenderer turns the body of a fenced code block into SVG.
+type DiagramRenderer interface {
+	// Name identifies the engine in error messages, e.g. "Graphviz (dot)".
+	Name() string
+	// Available reports whether the engine can run on this machine.
+	Available() bool
+	// Render returns an SVG document for the diagram source.
+	Render(source []byte) ([]byte, error)
+}
+
+// errDiagramUnavailable is returned when a diagram's engine isn't installed.
+var errDiagramUnavailable = errors.New("diagram engine not available")
+
+// diagramRenderers maps fenced-code languages to the engine that renders them.
+var diagramRenderers = map[string]DiagramRenderer{}
+
+// clientSideDiagrams lists languages that fall back to the in-page script when their
+// engine is missing, instead of showing an error.
+var clientSideDiagrams = map[string]bool{"mermaid": true}
+
+func registerDiagramRenderer(r DiagramRenderer, languages ...string) {
+	for _, lang := range languages {
+		diagramRenderers[strings.ToLower(lang)] = r
+	}
+	keyInputs.invalidate()
+}
+
+func init() {
+	registerDiagramRenderer(&commandDiagramRenderer{
+		name:   "Graphviz (dot)",
+		binary: "dot",
+		args:   []string{"-Tsvg"},
+	}, "dot", "graphviz")
+	registerDiagramRenderer(&commandDiagramRenderer{
+		name:   "PlantUML",
+		binary: "plantuml",
+		args:   []string{"-tsvg", "-pipe"},
+	}, "plantuml", "puml")
+	registerDiagramRenderer(&commandDiagramRenderer{
+		name:   "Vega-Lite (vl2svg)",
+		binary: "vl2svg",
+	}, "vega-lite", "vegalite")
+	registerDiagramRenderer(&commandDiagramRenderer{
+		name:   "Mermaid CLI (mmdc)",
+		binary: "mmdc",
+		args:   []string{"-i", "{in}", "-o", "{out}", "-b", "transparent"},
+		inExt:  ".mmd",
+	}, "mermaid")
+	registerDiagramRenderer(&chartRenderer{}, "chart")
+}
+
+// diagramTimeout bounds how long an external engine may run for one block.
+const diagramTimeout = 10 * time.Second
+
+// commandDiagramRenderer pipes the diagram through a locally installed binary. When args
+// contain `{in}`/`{out}`, the source and result go through temporary files instead of
+// stdin/stdout.
+type commandDiagramRenderer struct {
+	name   string
+	binary string
+	args   []string
+	inExt  string
+}
+
+func (r *commandDiagramRenderer) Name() string {
+	return r.name
+}
+
+func (r *commandDiagramRenderer) Available() bool {
+	return findDiagramBinary(r.binary) != ""
+}
+
+func (r *commandDiagramRenderer) Render(source []byte) ([]byte, error) {
+	bin := findDiagramBinary(r.binary)
+	if bin == "" {
+		return nil, errDiagramUnavailable
+	}
+
+	args := append([]string(nil), r.args...)
+	var inPath, outPath string
+	for i, a := range args {
+		if a != "{in}" && a != "{out}" {
+			continue
+		}
+		if inPath == "" {
+			dir, err := os.MkdirTemp("", "mdr-diagram-")
+			if err != nil {
+				return nil, err
+			}
+			defer os.RemoveAll(dir)
+			inPath = filepath.Join(dir, "diagram"+r.inExt)
+			outPath = filepath.Join(dir, "diagram.svg")
+			if err := os.WriteFile(inPath, source, 0o600); err != nil {
+				return nil, err
+			}
+		}
+		if a == "{in}" {
+			args[i] = inPath
+		} else {
+			args[i] = outPath
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, args...)
+	if inPath == "" {
+		cmd.Stdin = bytes.NewReader(source)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("%s failed: %s", r.binary, msg)
+	}
+	if outPath != "" {
+		return os.ReadFile(outPath)
+	}
+	return stdout.Bytes(), nil
+}
+
+// toolDirs are the usual package-manager locations, which GUI launches often leave off PATH.
+var toolDirs = []string{"/opt/homebrew/bin", "/usr/local/bin", "/usr/bin"}
+
+// findTool looks for a command-line tool such as git on PATH, then in toolDirs.
+func findTool(name string) string {
+	if p, err := exec.LookPath(name); err == nil {
+		return p
+	}
+	return findExecutable(name, toolDirs)
+}
+
+// findDiagramBinary looks for a diagram engine like findTool, but searches `diagramBinDirs`
+// from the config before toolDirs.
+func findDiagramBinary(name string) string {
+	if p, err := exec.LookPath(name); err == nil {
+		return p
+	}
+	return findExecutable(name, append(getDiagramBinDirsFromConfig(), toolDirs...))
+}
+
+// findExecutable returns the first executable file called name in dirs.
+func findExecutable(name string, dirs []string) string {
+	for _, dir := range dirs {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return p
+		}
+	}
+	return ""
+}
+
+// diagramCache keeps rendered SVG by language and source so re-renders don't re-run engines.
+var diagramCache = struct {
+	sync.Mutex
+	entries map[[32]byte][]byte
+}{entries: map[[32]byte][]byte{}}
+
+const maxDiagramCacheEntries = 256
+
+func renderDiagram(lang string, source []byte) ([]byte, error) {
+	r, ok := diagramRenderers[lang]
+	if !ok {
+		return nil, errDiagramUnavailable
+	}
+	key := sha256.Sum256(append([]byte(lang+"\x00"), source...))
+	diagramCache.Lock()
+	svg, hit := diagramCache.entries[key]
+	diagramCache.Unlock()
+	if hit {
+		return svg, nil
+	}
+
+	if !r.Available() {
+		return nil, errDiagramUnavailable
+	}
+	svg, err := r.Render(source)
+	if err != nil {
+		return nil, err
+	}
+	svg = diagramSVGPolicy().SanitizeBytes(extractSVG(svg))
+	if len(bytes.TrimSpace(svg)) == 0 {
+		return nil, fmt.Errorf("%s produced no SVG output", r.Name())
+	}
+
+	diagramCache.Lock()
+	if len(diagramCache.entries) >= maxDiagramCacheEntries {
+		diagramCache.entries = map[[32]byte][]byte{}
+	}
+	diagramCache.entries[key] = svg
+	diagramCache.Unlock()
+	return svg, nil
+}
+
+var svgStart = regexp.MustCompile(`(?i)<svg[\s>]`)
+
+// extractSVG drops XML declarations, doctypes and comments that engines emit before <svg>.
+func extractSVG(out []byte) []byte {
+	loc := svgStart.FindIndex(out)
+	if loc == nil {
+		return nil
+	}
+	out = out[loc[0]:]
+	if end := bytes.LastIndex(out, []byte("</svg>")); end >= 0 {
+		out = out[:end+len("</svg>")]
+	}
+	return out
+}
+
+// diagramSVGPolicy allows the SVG vocabulary diagram engines produce, minus scripts, event
+// handlers and external references.
+func diagramSVGPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("svg", "g", "path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+		"text", "tspan", "title", "desc", "defs", "marker", "lineargradient", "radialgradient", "stop",
+		"clippath", "mask", "symbol", "pattern")
+	p.AllowAttrs("id", "class", "style", "transform", "viewbox", "width", "height", "x", "y", "x1", "y1",
+		"x2", "y2", "cx", "cy", "r", "rx", "ry", "d", "points", "fill", "fill-opacity", "fill-rule", "stroke",
+		"stroke-width", "stroke-dasharray", "stroke-linecap", "stroke-linejoin", "stroke-opacity",
+		"stroke-miterlimit", "opacity", "font-family", "font-size", "font-weight", "font-style",
+		"text-anchor", "dominant-baseline", "alignment-baseline", "dx", "dy", "preserveaspectratio",
+		"xmlns", "version", "markerwidth", "markerheight", "refx", "refy", "orient", "markerunits",
+		"offset", "stop-color", "stop-opacity", "gradientunits", "gradienttransform", "clip-path",
+		"clip-rule", "mask", "marker-start", "marker-mid", "marker-end", "role", "aria-label").Globally()
+	p.AllowStyling()
+	return p
+}
+
+// diagramCountKey carries an *int counting the diagrams numbered so far, so the pieces of a
+// progressively rendered document don't reuse placeholder IDs.
+var diagramCountKey = parser.NewContextKey()
+
+// KindDiagram is the node kind for fenced code blocks rendered by a DiagramRenderer.
+var KindDiagram = ast.NewNodeKind("Diagram")
+
+// Diagram replaces a fenced code block whose language has a registered engine. SVG is
+// spliced in after sanitising the page, so the node only renders a placeholder. The
+// placeholder holds a token that is random for each render, so raw HTML in the document
+// can't pass for it.
+type Diagram struct {
+	ast.BaseBlock
+	Language string
+	Index    int
+	SVG      []byte
+	Err      error
+	Source   []byte
+	token    string
+}
+
+// Kind implements ast.Node.
+func (n *Diagram) Kind() ast.NodeKind {
+	return KindDiagram
+}
+
+// Dump implements ast.Node.
+func (n *Diagram) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Language": n.Language}, nil)
+}
+
+func (n *Diagram) placeholderID() string {
+	return fmt.Sprintf("mdr-diagram-%d", n.Index)
+}
+
+// placeholderEnd is how the placeholder's HTML ends, from its id on.
+func (n *Diagram) placeholderEnd() string {
+	return `id="` + n.placeholderID() + `">` + n.token + `</div>`
+}
+
+type diagramTransformer struct{}
+
+// Transform renders every diagram block up front and swaps it for a Diagram node.
+func (t *diagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if fcb, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			blocks = append(blocks, fcb)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	index, _ := pc.Get(diagramCountKey).(*int)
+	if index == nil {
+		index = new(int)
+	}
+	// The nonce alphabet needs no escaping, so the token survives the sanitizer unchanged.
+	token, err := newScriptNonce()
+	if err != nil {
+		return
+	}
+	for _, fcb := range blocks {
+		lang := strings.ToLower(string(fcb.Language(source)))
+		if _, ok := diagramRenderers[lang]; !ok {
+			continue
+		}
+		var body bytes.Buffer
+		lines := fcb.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			body.Write(seg.Value(source))
+		}
+
+		svg, err := renderDiagram(lang, body.Bytes())
+		if errors.Is(err, errDiagramUnavailable) && clientSideDiagrams[lang] {
+			continue
+		}
+		d := &Diagram{Language: lang, Index: *index, SVG: svg, Err: err, Source: body.Bytes(), token: token}
+		d.SetLines(fcb.Lines())
+		fcb.Parent().ReplaceChild(fcb.Parent(), fcb, d)
+		*index++
+	}
+}
+
+type diagramRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (r *diagramRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDiagram, r.renderDiagram)
+}
+
+func (r *diagramRenderer) renderDiagram(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*Diagram)
+	if n.Err != nil {
+		msg := n.Err.Error()
+		if errors.Is(n.Err, errDiagramUnavailable) {
+			msg = fmt.Sprintf("Cannot render %s diagram: %s is not installed or not on PATH.", n.Language, diagramRenderers[n.Language].Name())
+		}
+		_, _ = w.WriteString(`<div class="diagram-error"><p class="diagram-error-title">`)
+		_, _ = w.Write(util.EscapeHTML([]byte(msg)))
+		_, _ = w.WriteString("</p><pre><code>")
+		_, _ = w.Write(util.EscapeHTML(n.Source))
+		_, _ = w.WriteString("</code></pre></div>\n")
+		return ast.WalkSkipChildren, nil
+	}
+	_, _ = fmt.Fprintf(w, `<div class="diagram diagram-%s" %s`+"\n", n.Language, n.placeholderEnd())
+	return ast.WalkSkipChildren, nil
+}
+
+type diagramExtension struct{}
+
+// diagrams renders fenced `dot`, `plantuml`, `vega-lite`, `chart` (and `mermaid`, when the
+// CLI is installed) blocks to inline SVG.
+var diagrams = &diagramExtension{}
+
+// Extend implements goldmark.Extender.
+func (e *diagramExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&diagramTransformer{}, 700),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&diagramRenderer{}, 500),
+	))
+}
+
+// injectDiagrams fills the placeholders left by diagramRenderer with their SVG. It runs after
+// the page body has been sanitised; the SVG was already cleaned by diagramSVGPolicy.
+func injectDiagrams(bodyHTML string, doc ast.Node) string {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		d, ok := n.(*Diagram)
+		if !ok || !entering || d.Err != nil {
+			return ast.WalkContinue, nil
+		}
+		bodyHTML = strings.Replace(bodyHTML, d.placeholderEnd(), `id="`+d.placeholderID()+`">`+string(d.SVG)+`</div>`, 1)
+		return ast.WalkSkipChildren, nil
+	})
+	return bodyHTML
+}
+
+const diagramCSS = `.diagram{text-align:center;margin:16px 0;overflow:auto}.diagram svg{max-width:100%;height:auto}.diagram-error{margin:0 0 16px 0;padding:8px 16px;border-left:4px solid #d1242f;border-radius:0 6px 6px 0}.diagram-error-title{margin:0 0 8px 0;font-weight:600;color:#d1242f}`
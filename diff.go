@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// diffExcerptRunes caps the text of a block shown in the change list.
+const diffExcerptRunes = 80
+
+// DiffChange is one changed stretch of a document, for navigating a diff.
+type DiffChange struct {
+	// Kind is "inserted", "deleted" or "modified".
+	Kind string `json:"kind"`
+	// ID is the id of the change's first row in the diff page.
+	ID string `json:"id"`
+	// OldLine and NewLine are the source lines the change starts on in each version, 0 when
+	// the version has no blocks in it.
+	OldLine int    `json:"oldLine"`
+	NewLine int    `json:"newLine"`
+	Text    string `json:"text"`
+}
+
+// DiffResult is a rendered side-by-side comparison of two versions of a document.
+type DiffResult struct {
+	OldPath  string       `json:"oldPath"`
+	NewPath  string       `json:"newPath"`
+	OldTitle string       `json:"oldTitle"`
+	NewTitle string       `json:"newTitle"`
+	HTML     string       `json:"html"`
+	Changes  []DiffChange `json:"changes"`
+}
+
+// ChangedBlock is a block of a reloaded document that was not in the previous render.
+type ChangedBlock struct {
+	BlockID string `json:"blockId"`
+	// Kind is "inserted" or "modified".
+	Kind string `json:"kind"`
+}
+
+// diffRow pairs a block of the old version with one of the new; either may be missing.
+type diffRow struct {
+	kind     string
+	old, new *RenderedBlock
+}
+
+// diffCSS lays the two versions out in columns and colours the changed rows.
+const diffCSS = `body #wrapper{max-width:1800px}` +
+	`.diff-row{display:grid;grid-template-columns:1fr 1fr;gap:24px}` +
+	`.diff-head{font-weight:600;padding:6px 0;margin-bottom:8px;border-bottom:1px solid rgba(128,128,128,.35);overflow-wrap:anywhere}` +
+	`.diff-side{min-width:0;padding:0 10px;border-left:4px solid transparent}` +
+	`.diff-deleted .diff-old{background:rgba(248,81,73,.15);border-left-color:rgba(248,81,73,.8)}` +
+	`.diff-inserted .diff-new{background:rgba(46,160,67,.15);border-left-color:rgba(46,160,67,.8)}` +
+	`.diff-modified .diff-side{background:rgba(210,153,34,.15);border-left-color:rgba(210,153,34,.8)}` +
+	`.diff-unchanged{opacity:.75}`
+
+// RenderDiff renders the documents at oldPath and newPath side by side, matching their blocks
+// and highlighting the ones inserted, deleted or modified. Either path may be a virtual
+// document, such as a file at a git revision.
+func (a *App) RenderDiff(oldPath string, newPath string) (DiffResult, error) {
+	oldPath, newPath = normalizePath(oldPath), normalizePath(newPath)
+	oldMarkdown, _, err := readDocument(oldPath)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	newMarkdown, _, err := readDocument(newPath)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	oldTitle, newTitle := diffTitle(oldPath), diffTitle(newPath)
+	page, changes, err := sharedRenderer().RenderDiff(
+		oldMarkdown, documentBase(oldPath), oldTitle,
+		newMarkdown, documentBase(newPath), newTitle,
+		getThemeFromConfig(), getPaletteFromConfig(), getFontScaleFromConfig())
+	if err != nil {
+		return DiffResult{}, err
+	}
+	return DiffResult{
+		OldPath:  oldPath,
+		NewPath:  newPath,
+		OldTitle: oldTitle,
+		NewTitle: newTitle,
+		HTML:     page,
+		Changes:  changes,
+	}, nil
+}
+
+// RenderGitDiff compares the file at path as it was at a git revision with its current
+// contents.
+func (a *App) RenderGitDiff(path string, rev string) (DiffResult, error) {
+	path = documentBase(normalizePath(path))
+	rev = strings.TrimSpace(rev)
+	if rev == "" {
+		rev = "HEAD"
+	}
+	return a.RenderDiff(gitDocPath(rev, path), path)
+}
+
+// diffTitle names a version of a document in the column headers.
+func diffTitle(path string) string {
+	if title := documentTitle(path); title != "" {
+		return title
+	}
+	return path
+}
+
+// RenderDiff renders two versions of a document into one side-by-side page and lists the
+// changes between them. Blocks are matched by their IDs, which hash the rendered HTML.
+func (r *Renderer) RenderDiff(oldMarkdown, oldPath, oldTitle, newMarkdown, newPath, newTitle, themeName, palette string, fontScale int) (string, []DiffChange, error) {
+	oldState := r.newRenderState(htmlProfileForPath(oldPath))
+	_, oldBlocks, _, err := r.renderBody(oldMarkdown, oldPath, oldState)
+	if err != nil {
+		return "", nil, err
+	}
+	newState := r.newRenderState(htmlProfileForPath(newPath))
+	_, newBlocks, _, err := r.renderBody(newMarkdown, newPath, newState)
+	if err != nil {
+		return "", nil, err
+	}
+	newState.clientScripts = newState.clientScripts || oldState.clientScripts
+
+	var body strings.Builder
+	body.WriteString(`<div class="diff-row diff-head"><div class="diff-side">` + html.EscapeString(oldTitle) +
+		`</div><div class="diff-side">` + html.EscapeString(newTitle) + `</div></div>`)
+	var changes []DiffChange
+	prev := "unchanged"
+	for _, row := range diffBlocks(oldBlocks, newBlocks) {
+		id := ""
+		if row.kind != "unchanged" && row.kind != prev {
+			id = "diff-" + strconv.Itoa(len(changes)+1)
+			changes = append(changes, newDiffChange(id, row))
+		}
+		prev = row.kind
+		writeDiffRow(&body, id, row)
+	}
+
+	page, err := r.renderPage(body.String(), newState, themeCSSByName(themeName, normalizePalette(palette))+diffCSS, normalizePalette(palette), clampFontScale(fontScale), "")
+	if err != nil {
+		return "", nil, err
+	}
+	return page, changes, nil
+}
+
+// maxDiffEdits bounds how many inserted and deleted blocks diffBlocks aligns. Past it the
+// documents are too different for the alignment to help, and the search would cost too much.
+const maxDiffEdits = 1000
+
+// diffBlocks aligns two block lists along their longest common subsequence. Within each run
+// of changes, deleted and inserted blocks are paired up as modified.
+func diffBlocks(oldBlocks, newBlocks []RenderedBlock) []diffRow {
+	// Skip the common prefix and suffix so the table only covers the changed middle.
+	start := 0
+	for start < len(oldBlocks) && start < len(newBlocks) && oldBlocks[start].ID == newBlocks[start].ID {
+		start++
+	}
+	endOld, endNew := len(oldBlocks), len(newBlocks)
+	for endOld > start && endNew > start && oldBlocks[endOld-1].ID == newBlocks[endNew-1].ID {
+		endOld--
+		endNew--
+	}
+	o, n := oldBlocks[start:endOld], newBlocks[start:endNew]
+
+	edits, ok := blockEdits(o, n, maxDiffEdits)
+	if !ok {
+		// Too different to align: the whole middle shows as modified.
+		edits = []byte(strings.Repeat("-", len(o)) + strings.Repeat("+", len(n)))
+	}
+
+	var rows []diffRow
+	for i := 0; i < start; i++ {
+		rows = append(rows, diffRow{kind: "unchanged", old: &oldBlocks[i], new: &newBlocks[i]})
+	}
+	var deleted, inserted []*RenderedBlock
+	flush := func() {
+		for k := 0; k < max(len(deleted), len(inserted)); k++ {
+			row := diffRow{kind: "modified"}
+			if k < len(deleted) {
+				row.old = deleted[k]
+			} else {
+				row.kind = "inserted"
+			}
+			if k < len(inserted) {
+				row.new = inserted[k]
+			} else {
+				row.kind = "deleted"
+			}
+			rows = append(rows, row)
+		}
+		deleted, inserted = nil, nil
+	}
+	i, j := 0, 0
+	for _, e := range edits {
+		switch e {
+		case '=':
+			flush()
+			rows = append(rows, diffRow{kind: "unchanged", old: &o[i], new: &n[j]})
+			i++
+			j++
+		case '+':
+			inserted = append(inserted, &n[j])
+			j++
+		default:
+			deleted = append(deleted, &o[i])
+			i++
+		}
+	}
+	flush()
+	for k := 0; k < len(oldBlocks)-endOld; k++ {
+		rows = append(rows, diffRow{kind: "unchanged", old: &oldBlocks[endOld+k], new: &newBlocks[endNew+k]})
+	}
+	return rows
+}
+
+// blockEdits finds the shortest edit script turning o into n with Myers' O(ND) algorithm:
+// one byte per step, '=' to keep a block, '-' to delete one from o and '+' to insert one from
+// n. Memory grows with the square of the number of edits, so it gives up, returning false,
+// when more than maxEdits are needed.
+func blockEdits(o, n []RenderedBlock, maxEdits int) ([]byte, bool) {
+	// trace[d][k+d] is the furthest x reached on diagonal k (x-y) with d edits.
+	var trace [][]int
+	furthest := func(d, k int) int {
+		prev := trace[d-1]
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			return prev[k+1+d-1]
+		}
+		return prev[k-1+d-1] + 1
+	}
+	for d := 0; d <= min(len(o)+len(n), maxEdits); d++ {
+		v := make([]int, 2*d+1)
+		trace = append(trace, v)
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if d > 0 {
+				x = furthest(d, k)
+			}
+			y := x - k
+			for x < len(o) && y < len(n) && o[x].ID == n[y].ID {
+				x++
+				y++
+			}
+			v[k+d] = x
+			if x >= len(o) && y >= len(n) {
+				return backtrackEdits(trace, len(o), len(n)), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrackEdits walks the trace of blockEdits back from the end to build the edit script.
+func backtrackEdits(trace [][]int, x, y int) []byte {
+	var edits []byte
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, '=')
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, '+')
+			y--
+		} else {
+			edits = append(edits, '-')
+			x--
+		}
+	}
+	for ; x > 0; x-- {
+		edits = append(edits, '=')
+	}
+	slices.Reverse(edits)
+	return edits
+}
+
+// changedBlocks lists the blocks of a new render that were inserted or modified since the
+// render whose block IDs are prev. It runs on every reload, so it relies on diffBlocks
+// bounding its work: a rewrite of a large file marks every new block as changed.
+func changedBlocks(prev []string, blocks []RenderedBlock) []ChangedBlock {
+	old := make([]RenderedBlock, len(prev))
+	for i, id := range prev {
+		old[i].ID = id
+	}
+	var changed []ChangedBlock
+	for _, row := range diffBlocks(old, blocks) {
+		if row.new != nil && row.kind != "unchanged" {
+			changed = append(changed, ChangedBlock{BlockID: row.new.ID, Kind: row.kind})
+		}
+	}
+	return changed
+}
+
+// writeDiffRow writes one row of the side-by-side page.
+func writeDiffRow(b *strings.Builder, id string, row diffRow) {
+	b.WriteString(`<div class="diff-row diff-` + row.kind + `"`)
+	if id != "" {
+		b.WriteString(` id="` + id + `"`)
+	}
+	b.WriteString(`>`)
+	for _, side := range []struct {
+		class string
+		block *RenderedBlock
+	}{{"diff-old", row.old}, {"diff-new", row.new}} {
+		b.WriteString(`<div class="diff-side ` + side.class + `">`)
+		if side.block != nil {
+			b.WriteString(side.block.HTML)
+		}
+		b.WriteString(`</div>`)
+	}
+	b.WriteString(`</div>`)
+}
+
+// newDiffChange describes the change starting at row for the change list.
+func newDiffChange(id string, row diffRow) DiffChange {
+	c := DiffChange{Kind: row.kind, ID: id}
+	if row.old != nil {
+		c.OldLine = row.old.Line
+		c.Text = blockExcerpt(row.old.HTML)
+	}
+	if row.new != nil {
+		c.NewLine = row.new.Line
+		c.Text = blockExcerpt(row.new.HTML)
+	}
+	if c.Text == "" {
+		c.Text = fmt.Sprintf("%s block", row.kind)
+	}
+	return c
+}
+
+// blockExcerpt returns the start of a block's text, leaving out style and script contents.
+func blockExcerpt(fragment string) string {
+	var text strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(fragment))
+	skip := ""
+	for text.Len() < diffExcerptRunes*4 {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		switch tt {
+		case xhtml.StartTagToken:
+			if name, _ := z.TagName(); skip == "" && (string(name) == "style" || string(name) == "script") {
+				skip = string(name)
+			}
+		case xhtml.EndTagToken:
+			if name, _ := z.TagName(); string(name) == skip {
+				skip = ""
+			}
+		case xhtml.TextToken:
+			if skip == "" {
+				text.Write(z.Text())
+				text.WriteByte(' ')
+			}
+		}
+	}
+	excerpt := []rune(strings.Join(strings.Fields(text.String()), " "))
+	if len(excerpt) > diffExcerptRunes {
+		return string(excerpt[:diffExcerptRunes-1]) + "…"
+	}
+	return string(excerpt)
+}
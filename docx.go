@@ -0,0 +1,708 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+const (
+	// docxMaxImageWidth caps embedded images at 6 inches, in EMUs.
+	docxMaxImageWidth = 6 * 914400
+	// docxEMUPerPixel converts image pixels to EMUs at 96 DPI.
+	docxEMUPerPixel = 9525
+	// docxIndent is the indent per list or quote level, in twentieths of a point.
+	docxIndent = 720
+)
+
+// docxBreakTag matches raw `<br>` tags, the only inline HTML a Word export keeps.
+var docxBreakTag = regexp.MustCompile(`(?i)^<br\s*/?>$`)
+
+// docxInvalidChars are the control characters XML can't hold.
+var docxInvalidChars = regexp.MustCompile("[\x00-\x08\x0b\x0c\x0e-\x1f]")
+
+// docxImageExtensions maps the image formats Word embeds to their file extension.
+var docxImageExtensions = map[string]string{"png": "png", "jpeg": "jpeg", "gif": "gif"}
+
+// ExportDOCX exports the document at path as a Word document, asking where to save it with
+// the save dialog. It returns the path written, or "" when the dialog is cancelled.
+func (a *App) ExportDOCX(path string) (string, error) {
+	path = normalizePath(path)
+	markdown, _, err := readDocument(path)
+	if err != nil {
+		return "", err
+	}
+	base := documentBase(path)
+	dest, err := a.chooseExportFile(base, ".docx", "Word document (*.docx)")
+	if err != nil || dest == "" {
+		return "", err
+	}
+	doc, err := sharedRenderer().RenderDOCX(markdown, base, documentTitle(path))
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dest, doc, 0o644); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// docxRel is a relationship of the main document part: a hyperlink target or an image.
+type docxRel struct {
+	id, kind, target string
+	external         bool
+}
+
+// docxImage is an image embedded in the document.
+type docxImage struct {
+	rel    string
+	cx, cy int
+}
+
+// docxRun holds the character formatting of a run of text.
+type docxRun struct {
+	bold, italic, strike, code, link bool
+}
+
+// docxPara holds the paragraph formatting blocks inherit from their containers.
+type docxPara struct {
+	style  string
+	numID  int
+	level  int
+	indent int
+	lists  int
+}
+
+// docxWriter walks a goldmark AST and writes WordprocessingML.
+type docxWriter struct {
+	source    []byte
+	dir       string
+	body      strings.Builder
+	rels      []docxRel
+	media     map[string][]byte
+	images    map[string]docxImage
+	lists     []string
+	bookmarks int
+	anchors   map[string]string
+	drawings  int
+}
+
+// RenderDOCX renders markdown as a Word document, mapping headings, lists, tables, code,
+// quotes, links and local images to Word's own structures and styles. An empty title falls
+// back to the first heading, then to the file name.
+func (r *Renderer) RenderDOCX(markdown, docPath, title string) ([]byte, error) {
+	source := []byte(markdown)
+	doc := r.parse(source, docPath, newLineIndex(source), nil)
+	toc := extractTOC(source, doc, map[string]int{})
+	if title == "" && len(toc) > 0 {
+		title = toc[0].Text
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(docPath), filepath.Ext(docPath))
+	}
+
+	w := &docxWriter{source: source, dir: filepath.Dir(docPath), media: map[string][]byte{}, images: map[string]docxImage{}}
+	w.anchors = docxBookmarks(doc)
+	w.blocks(doc, docxPara{})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", docxCoreProperties(title)},
+		{"word/document.xml", docxDocumentStart + w.body.String() + docxDocumentEnd},
+		{"word/styles.xml", docxStyles},
+		{"word/numbering.xml", w.numbering()},
+		{"word/_rels/document.xml.rels", w.relationships()},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write([]byte(f.content)); err != nil {
+			return nil, err
+		}
+	}
+	for _, rel := range w.rels {
+		if data, ok := w.media[rel.target]; ok {
+			fw, err := zw.Create("word/" + rel.target)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := fw.Write(data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blocks writes the block children of parent.
+func (w *docxWriter) blocks(parent ast.Node, para docxPara) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		w.block(n, para)
+	}
+}
+
+// block writes one block in a container formatted as para.
+func (w *docxWriter) block(n ast.Node, para docxPara) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		para.style = "Heading" + strconv.Itoa(min(n.Level, 6))
+		w.paragraph(para, n, docxRun{}, headingID(n))
+	case *ast.Paragraph, *ast.TextBlock:
+		w.paragraph(para, n, docxRun{}, "")
+	case *ast.ThematicBreak:
+		w.body.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr></w:pPr></w:p>`)
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		var code strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			code.Write(seg.Value(w.source))
+		}
+		w.codeBlock(para, code.String())
+	case *Diagram:
+		w.codeBlock(para, string(n.Source))
+	case *ast.Blockquote:
+		w.blocks(n, w.quoted(para))
+	case *Admonition:
+		quote := w.quoted(para)
+		w.body.WriteString(`<w:p>` + w.pPr(quote) + docxText(admonitionKinds[n.AdmonitionKind], docxRun{bold: true}) + `</w:p>`)
+		w.blocks(n, quote)
+	case *ast.List:
+		w.list(n, para)
+	case *east.Table:
+		w.table(n)
+	case *ast.HTMLBlock:
+		// Raw HTML has no Word equivalent.
+	default:
+		w.blocks(n, para)
+	}
+}
+
+// quoted returns the formatting of blocks inside a quote in a container formatted as para.
+func (w *docxWriter) quoted(para docxPara) docxPara {
+	para.style = "Quote"
+	para.indent += docxIndent
+	para.numID = 0
+	return para
+}
+
+// list writes a list; each item's first paragraph carries its bullet or number and the
+// rest are indented to match.
+func (w *docxWriter) list(n *ast.List, para docxPara) {
+	numID := w.newList(n, para.lists)
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		inner := para
+		inner.lists++
+		inner.indent += docxIndent
+		first := item.FirstChild()
+		if first == nil {
+			w.body.WriteString(`<w:p>` + w.pPr(docxPara{numID: numID, level: para.lists}) + `</w:p>`)
+			continue
+		}
+		for c := first; c != nil; c = c.NextSibling() {
+			p := inner
+			p.numID = 0
+			if c == first {
+				p.numID, p.level = numID, para.lists
+			}
+			w.block(c, p)
+		}
+	}
+}
+
+// newList adds a numbering instance for a list nested level deep and returns its id.
+func (w *docxWriter) newList(n *ast.List, level int) int {
+	abstract := "0"
+	override := ""
+	if n.IsOrdered() {
+		abstract = "1"
+		override = `<w:lvlOverride w:ilvl="` + strconv.Itoa(level) + `"><w:startOverride w:val="` + strconv.Itoa(max(n.Start, 0)) + `"/></w:lvlOverride>`
+	}
+	w.lists = append(w.lists, `<w:abstractNumId w:val="`+abstract+`"/>`+override)
+	return len(w.lists)
+}
+
+// table writes a GFM table, repeating its header row on every page.
+func (w *docxWriter) table(n *east.Table) {
+	w.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="0" w:type="auto"/></w:tblPr><w:tblGrid>`)
+	w.body.WriteString(strings.Repeat(`<w:gridCol/>`, len(n.Alignments)))
+	w.body.WriteString(`</w:tblGrid>`)
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		_, header := row.(*east.TableHeader)
+		w.body.WriteString(`<w:tr>`)
+		if header {
+			w.body.WriteString(`<w:trPr><w:tblHeader/></w:trPr>`)
+		}
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			w.body.WriteString(`<w:tc><w:tcPr><w:tcW w:w="0" w:type="auto"/></w:tcPr><w:p>`)
+			if c, ok := cell.(*east.TableCell); ok {
+				switch c.Alignment {
+				case east.AlignCenter:
+					w.body.WriteString(`<w:pPr><w:jc w:val="center"/></w:pPr>`)
+				case east.AlignRight:
+					w.body.WriteString(`<w:pPr><w:jc w:val="right"/></w:pPr>`)
+				}
+			}
+			w.inlines(&w.body, cell, docxRun{bold: header})
+			w.body.WriteString(`</w:p></w:tc>`)
+		}
+		w.body.WriteString(`</w:tr>`)
+	}
+	w.body.WriteString(`</w:tbl><w:p/>`)
+}
+
+// codeBlock writes code as one paragraph in the monospace Code style.
+func (w *docxWriter) codeBlock(para docxPara, code string) {
+	para.style = "Code"
+	w.body.WriteString(`<w:p>` + w.pPr(para) + docxText(strings.TrimSuffix(code, "\n"), docxRun{}) + `</w:p>`)
+}
+
+// paragraph writes the inline content of n as a paragraph, bookmarked as anchor if set.
+func (w *docxWriter) paragraph(para docxPara, n ast.Node, run docxRun, anchor string) {
+	w.body.WriteString(`<w:p>` + w.pPr(para))
+	if anchor != "" {
+		w.bookmarks++
+		id := strconv.Itoa(w.bookmarks)
+		w.body.WriteString(`<w:bookmarkStart w:id="` + id + `" w:name="` + html.EscapeString(w.anchors[anchor]) + `"/>`)
+		w.inlines(&w.body, n, run)
+		w.body.WriteString(`<w:bookmarkEnd w:id="` + id + `"/>`)
+	} else {
+		w.inlines(&w.body, n, run)
+	}
+	w.body.WriteString(`</w:p>`)
+}
+
+// pPr returns the paragraph properties for para.
+func (w *docxWriter) pPr(para docxPara) string {
+	var b strings.Builder
+	if para.style != "" {
+		b.WriteString(`<w:pStyle w:val="` + para.style + `"/>`)
+	}
+	if para.numID != 0 {
+		b.WriteString(`<w:numPr><w:ilvl w:val="` + strconv.Itoa(min(para.level, 8)) + `"/><w:numId w:val="` + strconv.Itoa(para.numID) + `"/></w:numPr>`)
+	} else if para.indent != 0 {
+		b.WriteString(`<w:ind w:left="` + strconv.Itoa(para.indent) + `"/>`)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return `<w:pPr>` + b.String() + `</w:pPr>`
+}
+
+// inlines writes the inline children of parent as runs.
+func (w *docxWriter) inlines(b *strings.Builder, parent ast.Node, run docxRun) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		switch n := n.(type) {
+		case *ast.Text:
+			b.WriteString(docxText(string(n.Segment.Value(w.source)), run))
+			if n.HardLineBreak() {
+				b.WriteString(`<w:r><w:br/></w:r>`)
+			} else if n.SoftLineBreak() {
+				b.WriteString(docxText(" ", run))
+			}
+		case *ast.String:
+			b.WriteString(docxText(string(n.Value), run))
+		case *ast.CodeSpan:
+			r := run
+			r.code = true
+			w.inlines(b, n, r)
+		case *ast.Emphasis:
+			r := run
+			if n.Level >= 2 {
+				r.bold = true
+			} else {
+				r.italic = true
+			}
+			w.inlines(b, n, r)
+		case *east.Strikethrough:
+			r := run
+			r.strike = true
+			w.inlines(b, n, r)
+		case *east.TaskCheckBox:
+			box := "☐ "
+			if n.IsChecked {
+				box = "☒ "
+			}
+			b.WriteString(docxText(box, run))
+		case *ast.Link:
+			w.hyperlink(b, string(n.Destination), run, func(r docxRun) { w.inlines(b, n, r) })
+		case *ast.AutoLink:
+			url := string(n.URL(w.source))
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(strings.ToLower(url), "mailto:") {
+				url = "mailto:" + url
+			} else if n.AutoLinkType == ast.AutoLinkURL && linkScheme(url) == "" {
+				// URL() already gives www. autolinks http://; this keeps any other target without a
+				// scheme from being taken for a local file and dropped.
+				url = "http://" + url
+			}
+			w.hyperlink(b, url, run, func(r docxRun) { b.WriteString(docxText(string(n.Label(w.source)), r)) })
+		case *ast.Image:
+			if !w.image(b, n) {
+				w.inlines(b, n, run)
+			}
+		case *ast.RawHTML:
+			var raw strings.Builder
+			for i := 0; i < n.Segments.Len(); i++ {
+				seg := n.Segments.At(i)
+				raw.Write(seg.Value(w.source))
+			}
+			if docxBreakTag.MatchString(strings.TrimSpace(raw.String())) {
+				b.WriteString(`<w:r><w:br/></w:r>`)
+			}
+		default:
+			w.inlines(b, n, run)
+		}
+	}
+}
+
+// hyperlink writes a link to dest around the runs content writes. Links within the
+// document point at heading bookmarks; links to local files keep only their text.
+func (w *docxWriter) hyperlink(b *strings.Builder, dest string, run docxRun, content func(docxRun)) {
+	r := run
+	r.link = true
+	switch {
+	case strings.HasPrefix(dest, "#") && w.anchors[dest[1:]] != "":
+		b.WriteString(`<w:hyperlink w:anchor="` + html.EscapeString(w.anchors[dest[1:]]) + `">`)
+	case isRemoteLink(dest):
+		id := w.addRel("http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink", dest, true)
+		b.WriteString(`<w:hyperlink r:id="` + id + `" w:history="1">`)
+	default:
+		content(run)
+		return
+	}
+	content(r)
+	b.WriteString(`</w:hyperlink>`)
+}
+
+// isRemoteLink reports whether dest is a web or mail link, which Word may open. Other schemes,
+// such as javascript: and file:, are not linked.
+func isRemoteLink(dest string) bool {
+	switch linkScheme(dest) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// linkScheme returns the lower-case scheme of dest, or "" when dest has none and is a path.
+func linkScheme(dest string) string {
+	scheme, _, ok := strings.Cut(dest, ":")
+	if !ok || len(scheme) < 2 || strings.ContainsAny(scheme, "/\\.#?") {
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
+
+// image embeds a local PNG, JPEG or GIF image, scaled down to the page width. It returns
+// false when the image can't be embedded, so its alt text is written instead.
+func (w *docxWriter) image(b *strings.Builder, n *ast.Image) bool {
+	p, ok := localImagePath(string(n.Destination), w.dir)
+	if !ok {
+		return false
+	}
+	img, ok := w.images[p]
+	if !ok {
+		if enforceFileLimit(p) != nil {
+			return false
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return false
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		ext, supported := docxImageExtensions[format]
+		if err != nil || !supported || cfg.Width == 0 || cfg.Height == 0 {
+			return false
+		}
+		name := "media/image" + strconv.Itoa(len(w.media)+1) + "." + ext
+		w.media[name] = data
+		img = docxImage{
+			rel: w.addRel("http://schemas.openxmlformats.org/officeDocument/2006/relationships/image", name, false),
+			cx:  cfg.Width * docxEMUPerPixel,
+			cy:  cfg.Height * docxEMUPerPixel,
+		}
+		if img.cx > docxMaxImageWidth {
+			img.cy = img.cy * docxMaxImageWidth / img.cx
+			img.cx = docxMaxImageWidth
+		}
+		w.images[p] = img
+	}
+
+	var alt strings.Builder
+	w.plainText(&alt, n)
+	w.drawings++
+	id := strconv.Itoa(w.drawings)
+	cx, cy := strconv.Itoa(img.cx), strconv.Itoa(img.cy)
+	fmt.Fprintf(b, `<w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0">`+
+		`<wp:extent cx="%[1]s" cy="%[2]s"/><wp:docPr id="%[3]s" name="Picture %[3]s" descr="%[4]s"/>`+
+		`<wp:cNvGraphicFramePr><a:graphicFrameLocks noChangeAspect="1"/></wp:cNvGraphicFramePr>`+
+		`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic>`+
+		`<pic:nvPicPr><pic:cNvPr id="%[3]s" name="Picture %[3]s"/><pic:cNvPicPr/></pic:nvPicPr>`+
+		`<pic:blipFill><a:blip r:embed="%[5]s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%[1]s" cy="%[2]s"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>`+
+		`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r>`,
+		cx, cy, id, html.EscapeString(alt.String()), img.rel)
+	return true
+}
+
+// plainText writes the text of parent's inline children, without formatting.
+func (w *docxWriter) plainText(b *strings.Builder, parent ast.Node) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(w.source))
+		case *ast.String:
+			b.Write(n.Value)
+		default:
+			w.plainText(b, n)
+		}
+	}
+}
+
+// addRel adds a relationship of the document part and returns its id. rId1 and rId2 are
+// the styles and numbering parts.
+func (w *docxWriter) addRel(kind, target string, external bool) string {
+	id := "rId" + strconv.Itoa(len(w.rels)+3)
+	w.rels = append(w.rels, docxRel{id: id, kind: kind, target: target, external: external})
+	return id
+}
+
+// relationships builds word/_rels/document.xml.rels.
+func (w *docxWriter) relationships() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>`)
+	for _, rel := range w.rels {
+		b.WriteString(`<Relationship Id="` + rel.id + `" Type="` + rel.kind + `" Target="` + html.EscapeString(rel.target) + `"`)
+		if rel.external {
+			b.WriteString(` TargetMode="External"`)
+		}
+		b.WriteString(`/>`)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// numbering builds word/numbering.xml: a bullet and a decimal list definition, and a
+// numbering instance per list so every ordered list counts from its own start.
+func (w *docxWriter) numbering() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`)
+	bullets := []string{"•", "◦", "▪"}
+	for abstract, ordered := range []bool{false, true} {
+		b.WriteString(`<w:abstractNum w:abstractNumId="` + strconv.Itoa(abstract) + `"><w:multiLevelType w:val="hybridMultilevel"/>`)
+		for lvl := 0; lvl < 9; lvl++ {
+			format, text := "bullet", bullets[lvl%len(bullets)]
+			if ordered {
+				format, text = "decimal", "%"+strconv.Itoa(lvl+1)+"."
+			}
+			fmt.Fprintf(&b, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/>`+
+				`<w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`, lvl, format, text, docxIndent*(lvl+1))
+		}
+		b.WriteString(`</w:abstractNum>`)
+	}
+	for i, num := range w.lists {
+		b.WriteString(`<w:num w:numId="` + strconv.Itoa(i+1) + `">` + num + `</w:num>`)
+	}
+	b.WriteString(`</w:numbering>`)
+	return b.String()
+}
+
+// headingID returns the id extractTOC gave a heading.
+func headingID(n *ast.Heading) string {
+	if id, ok := n.AttributeString("id"); ok {
+		if b, ok := id.([]byte); ok {
+			return string(b)
+		}
+	}
+	return ""
+}
+
+// docxBookmarks names a bookmark for every heading in doc, keyed by heading id. Names that
+// come out the same once shortened get a counter suffix, so links find the right heading.
+func docxBookmarks(doc ast.Node) map[string]string {
+	names := map[string]string{}
+	used := map[string]bool{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		id := headingID(h)
+		if id == "" || names[id] != "" {
+			return ast.WalkContinue, nil
+		}
+		base := docxBookmark(id)
+		name := base
+		for i := 2; used[name]; i++ {
+			suffix := "_" + strconv.Itoa(i)
+			name = base[:min(len(base), 40-len(suffix))] + suffix
+		}
+		used[name] = true
+		names[id] = name
+		return ast.WalkSkipChildren, nil
+	})
+	return names
+}
+
+// docxBookmark turns a heading id into a Word bookmark name, which must start with a letter
+// and be at most 40 characters long.
+func docxBookmark(id string) string {
+	if id == "" || !(id[0] >= 'a' && id[0] <= 'z' || id[0] >= 'A' && id[0] <= 'Z') {
+		id = "h" + id
+	}
+	if len(id) > 40 {
+		id = id[:40]
+	}
+	return id
+}
+
+// docxText returns s as a run formatted as run, with tabs and line breaks as Word's own.
+func docxText(s string, run docxRun) string {
+	if s == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(`<w:r>`)
+	var props strings.Builder
+	switch {
+	case run.code:
+		props.WriteString(`<w:rStyle w:val="CodeChar"/>`)
+	case run.link:
+		props.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+	}
+	if run.bold {
+		props.WriteString(`<w:b/>`)
+	}
+	if run.italic {
+		props.WriteString(`<w:i/>`)
+	}
+	if run.strike {
+		props.WriteString(`<w:strike/>`)
+	}
+	if props.Len() > 0 {
+		b.WriteString(`<w:rPr>` + props.String() + `</w:rPr>`)
+	}
+	s = docxInvalidChars.ReplaceAllString(s, "")
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			b.WriteString(`<w:br/>`)
+		}
+		for j, part := range strings.Split(line, "\t") {
+			if j > 0 {
+				b.WriteString(`<w:tab/>`)
+			}
+			if part != "" {
+				b.WriteString(`<w:t xml:space="preserve">` + html.EscapeString(part) + `</w:t>`)
+			}
+		}
+	}
+	b.WriteString(`</w:r>`)
+	return b.String()
+}
+
+// docxCoreProperties builds docProps/core.xml with the document's title.
+func docxCoreProperties(title string) string {
+	now := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" ` +
+		`xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" ` +
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<dc:title>` + html.EscapeString(title) + `</dc:title>` +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">` + now + `</dcterms:created>` +
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">` + now + `</dcterms:modified>` +
+		`</cp:coreProperties>`
+}
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+	`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Default Extension="png" ContentType="image/png"/>` +
+	`<Default Extension="jpeg" ContentType="image/jpeg"/>` +
+	`<Default Extension="gif" ContentType="image/gif"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+	`<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>` +
+	`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+	`</Types>`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`</Relationships>`
+
+const docxDocumentStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+	`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" ` +
+	`xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" ` +
+	`xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" ` +
+	`xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><w:body>`
+
+const docxDocumentEnd = `<w:sectPr><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr></w:body></w:document>`
+
+// docxStyles defines the styles the export uses, so they can be restyled in Word.
+var docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+	`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+	`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:sz w:val="22"/><w:szCs w:val="22"/><w:lang w:val="en-US"/></w:rPr></w:rPrDefault>` +
+	`<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+	`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>` +
+	docxHeadingStyles() +
+	`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:qFormat/>` +
+	`<w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/><w:spacing w:after="120" w:line="240" w:lineRule="auto"/></w:pPr>` +
+	`<w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="19"/><w:szCs w:val="19"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:qFormat/>` +
+	`<w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="D0D7DE"/></w:pBdr></w:pPr>` +
+	`<w:rPr><w:color w:val="57606A"/></w:rPr></w:style>` +
+	`<w:style w:type="character" w:default="1" w:styleId="DefaultParagraphFont"><w:name w:val="Default Paragraph Font"/><w:uiPriority w:val="1"/><w:semiHidden/></w:style>` +
+	`<w:style w:type="character" w:styleId="CodeChar"><w:name w:val="Code Char"/><w:basedOn w:val="DefaultParagraphFont"/>` +
+	`<w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/><w:szCs w:val="20"/><w:shd w:val="clear" w:color="auto" w:fill="F0F0F0"/></w:rPr></w:style>` +
+	`<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:basedOn w:val="DefaultParagraphFont"/>` +
+	`<w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>` +
+	`<w:style w:type="table" w:default="1" w:styleId="TableNormal"><w:name w:val="Normal Table"/><w:semiHidden/>` +
+	`<w:tblPr><w:tblInd w:w="0" w:type="dxa"/><w:tblCellMar><w:top w:w="0" w:type="dxa"/><w:left w:w="108" w:type="dxa"/><w:bottom w:w="0" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>` +
+	`<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:basedOn w:val="TableNormal"/>` +
+	`<w:pPr><w:spacing w:after="0" w:line="240" w:lineRule="auto"/></w:pPr>` +
+	`<w:tblPr><w:tblBorders><w:top w:val="single" w:sz="4" w:space="0" w:color="auto"/><w:left w:val="single" w:sz="4" w:space="0" w:color="auto"/>` +
+	`<w:bottom w:val="single" w:sz="4" w:space="0" w:color="auto"/><w:right w:val="single" w:sz="4" w:space="0" w:color="auto"/>` +
+	`<w:insideH w:val="single" w:sz="4" w:space="0" w:color="auto"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="auto"/></w:tblBorders></w:tblPr></w:style>` +
+	`</w:styles>`
+
+// docxHeadingStyles defines Heading1 to Heading6 with their outline levels, so headings show
+// in Word's navigation pane and tables of contents.
+func docxHeadingStyles() string {
+	sizes := []int{36, 30, 26, 24, 22, 22}
+	var b strings.Builder
+	for i, size := range sizes {
+		fmt.Fprintf(&b, `<w:style w:type="paragraph" w:styleId="Heading%[1]d"><w:name w:val="heading %[1]d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/>`+
+			`<w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="%[2]d"/></w:pPr>`+
+			`<w:rPr><w:b/><w:sz w:val="%[3]d"/><w:szCs w:val="%[3]d"/></w:rPr></w:style>`, i+1, i, size)
+	}
+	return b.String()
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// emojiShortcodes maps GitHub shortcodes (without colons) to their Unicode emoji.
+// It covers the codes that commonly show up in READMEs, changelogs and issue text.
+var emojiShortcodes = map[string]string{
+	"+1":                          "👍",
+	"-1":                          "👎",
+	"100":                         "💯",
+	"1234":                        "🔢",
+	"alarm_clock":                 "⏰",
+	"alien":                       "👽",
+	"ambulance":                   "🚑",
+	"anchor":                      "⚓",
+	"angry":                       "😠",
+	"apple":                       "🍎",
+	"arrow_down":                  "⬇️",
+	"arrow_left":                  "⬅️",
+	"arrow_right":                 "➡️",
+	"arrow_up":                    "⬆️",
+	"art":                         "🎨",
+	"astonished":                  "😲",
+	"atom_symbol":                 "⚛️",
+	"baby":                        "👶",
+	"balloon":                     "🎈",
+	"bangbang":                    "‼️",
+	"bar_chart":                   "📊",
+	"beer":                        "🍺",
+	"beers":                       "🍻",
+	"beetle":                      "🐞",
+	"bell":                        "🔔",
+	"bento":                       "🍱",
+	"bike":                        "🚲",
+	"bird":                        "🐦",
+	"blue_heart":                  "💙",
+	"blush":                       "😊",
+	"bomb":                        "💣",
+	"book":                        "📖",
+	"bookmark":                    "🔖",
+	"books":                       "📚",
+	"boom":                        "💥",
+	"bowtie":                      "🎀",
+	"brain":                       "🧠",
+	"bricks":                      "🧱",
+	"broken_heart":                "💔",
+	"bug":                         "🐛",
+	"bulb":                        "💡",
+	"bullettrain_side":            "🚄",
+	"busts_in_silhouette":         "👥",
+	"cake":                        "🍰",
+	"calendar":                    "📆",
+	"camera":                      "📷",
+	"card_file_box":               "🗃️",
+	"cat":                         "🐱",
+	"chart_with_downwards_trend":  "📉",
+	"chart_with_upwards_trend":    "📈",
+	"check":                       "✔️",
+	"checkered_flag":              "🏁",
+	"children_crossing":           "🚸",
+	"clap":                        "👏",
+	"clipboard":                   "📋",
+	"clock1":                      "🕐",
+	"closed_lock_with_key":        "🔐",
+	"cloud":                       "☁️",
+	"clown_face":                  "🤡",
+	"coffee":                      "☕",
+	"coffin":                      "⚰️",
+	"collision":                   "💥",
+	"computer":                    "💻",
+	"confetti_ball":               "🎊",
+	"confused":                    "😕",
+	"construction":                "🚧",
+	"construction_worker":         "👷",
+	"cool":                        "🆒",
+	"copyright":                   "©️",
+	"crab":                        "🦀",
+	"crossed_fingers":             "🤞",
+	"crown":                       "👑",
+	"cry":                         "😢",
+	"crystal_ball":                "🔮",
+	"dart":                        "🎯",
+	"dash":                        "💨",
+	"date":                        "📅",
+	"dizzy":                       "💫",
+	"dog":                         "🐶",
+	"dollar":                      "💵",
+	"dragon":                      "🐉",
+	"droplet":                     "💧",
+	"earth_africa":                "🌍",
+	"earth_americas":              "🌎",
+	"earth_asia":                  "🌏",
+	"egg":                         "🥚",
+	"eight":                       "8️⃣",
+	"email":                       "📧",
+	"envelope":                    "✉️",
+	"exclamation":                 "❗",
+	"expressionless":              "😑",
+	"eyes":                        "👀",
+	"facepalm":                    "🤦",
+	"fearful":                     "😨",
+	"file_folder":                 "📁",
+	"fire":                        "🔥",
+	"fireworks":                   "🎆",
+	"fish":                        "🐟",
+	"fist":                        "✊",
+	"five":                        "5️⃣",
+	"flags":                       "🎏",
+	"flashlight":                  "🔦",
+	"floppy_disk":                 "💾",
+	"four":                        "4️⃣",
+	"frog":                        "🐸",
+	"frowning":                    "😦",
+	"gear":                        "⚙️",
+	"gem":                         "💎",
+	"ghost":                       "👻",
+	"gift":                        "🎁",
+	"globe_with_meridians":        "🌐",
+	"goal_net":                    "🥅",
+	"goat":                        "🐐",
+	"green_heart":                 "💚",
+	"grey_exclamation":            "❕",
+	"grey_question":               "❔",
+	"grimacing":                   "😬",
+	"grin":                        "😁",
+	"grinning":                    "😀",
+	"hammer":                      "🔨",
+	"hammer_and_wrench":           "🛠️",
+	"hand":                        "✋",
+	"handshake":                   "🤝",
+	"hankey":                      "💩",
+	"hash":                        "#️⃣",
+	"heart":                       "❤️",
+	"heart_eyes":                  "😍",
+	"heavy_check_mark":            "✔️",
+	"heavy_minus_sign":            "➖",
+	"heavy_multiplication_x":      "✖️",
+	"heavy_plus_sign":             "➕",
+	"hocho":                       "🔪",
+	"hole":                        "🕳️",
+	"honeybee":                    "🐝",
+	"hook":                        "🪝",
+	"hotsprings":                  "♨️",
+	"hourglass":                   "⌛",
+	"hourglass_flowing_sand":      "⏳",
+	"house":                       "🏠",
+	"hugs":                        "🤗",
+	"hushed":                      "😯",
+	"information_source":          "ℹ️",
+	"innocent":                    "😇",
+	"iphone":                      "📱",
+	"jack_o_lantern":              "🎃",
+	"joy":                         "😂",
+	"key":                         "🔑",
+	"keyboard":                    "⌨️",
+	"kiss":                        "💋",
+	"kissing_heart":               "😘",
+	"label":                       "🏷️",
+	"ladder":                      "🪜",
+	"laptop":                      "💻",
+	"laughing":                    "😆",
+	"leaves":                      "🍃",
+	"ledger":                      "📒",
+	"lipstick":                    "💄",
+	"link":                        "🔗",
+	"lock":                        "🔒",
+	"loud_sound":                  "🔊",
+	"loudspeaker":                 "📢",
+	"mag":                         "🔍",
+	"mag_right":                   "🔎",
+	"mailbox":                     "📫",
+	"man_technologist":            "👨‍💻",
+	"mask":                        "😷",
+	"medal_sports":                "🏅",
+	"memo":                        "📝",
+	"metal":                       "🤘",
+	"microscope":                  "🔬",
+	"money_with_wings":            "💸",
+	"monkey":                      "🐒",
+	"monocle_face":                "🧐",
+	"moon":                        "🌔",
+	"mortar_board":                "🎓",
+	"muscle":                      "💪",
+	"mute":                        "🔇",
+	"necktie":                     "👔",
+	"negative_squared_cross_mark": "❎",
+	"nerd_face":                   "🤓",
+	"neutral_face":                "😐",
+	"new":                         "🆕",
+	"nine":                        "9️⃣",
+	"no_entry":                    "⛔",
+	"no_entry_sign":               "🚫",
+	"notebook":                    "📓",
+	"ok":                          "🆗",
+	"ok_hand":                     "👌",
+	"one":                         "1️⃣",
+	"open_mouth":                  "😮",
+	"package":                     "📦",
+	"page_facing_up":              "📄",
+	"page_with_curl":              "📃",
+	"paperclip":                   "📎",
+	"partying_face":               "🥳",
+	"passport_control":            "🛂",
+	"pencil":                      "📝",
+	"pencil2":                     "✏️",
+	"penguin":                     "🐧",
+	"pensive":                     "😔",
+	"persevere":                   "😣",
+	"pill":                        "💊",
+	"pizza":                       "🍕",
+	"point_down":                  "👇",
+	"point_left":                  "👈",
+	"point_right":                 "👉",
+	"point_up":                    "☝️",
+	"poop":                        "💩",
+	"pray":                        "🙏",
+	"pushpin":                     "📌",
+	"purple_heart":                "💜",
+	"question":                    "❓",
+	"rabbit":                      "🐰",
+	"rage":                        "😡",
+	"rainbow":                     "🌈",
+	"raised_hands":                "🙌",
+	"recycle":                     "♻️",
+	"red_circle":                  "🔴",
+	"registered":                  "®️",
+	"relaxed":                     "☺️",
+	"relieved":                    "😌",
+	"repeat":                      "🔁",
+	"rewind":                      "⏪",
+	"ribbon":                      "🎀",
+	"robot":                       "🤖",
+	"rocket":                      "🚀",
+	"rofl":                        "🤣",
+	"rose":                        "🌹",
+	"rotating_light":              "🚨",
+	"runner":                      "🏃",
+	"satellite":                   "📡",
+	"scream":                      "😱",
+	"scroll":                      "📜",
+	"see_no_evil":                 "🙈",
+	"seedling":                    "🌱",
+	"seven":                       "7️⃣",
+	"shield":                      "🛡️",
+	"shipit":                      "🐿️",
+	"shrug":                       "🤷",
+	"six":                         "6️⃣",
+	"skull":                       "💀",
+	"sleeping":                    "😴",
+	"sleepy":                      "😪",
+	"slightly_smiling_face":       "🙂",
+	"smile":                       "😄",
+	"smiley":                      "😃",
+	"smirk":                       "😏",
+	"snail":                       "🐌",
+	"snake":                       "🐍",
+	"snowflake":                   "❄️",
+	"sob":                         "😭",
+	"soon":                        "🔜",
+	"sos":                         "🆘",
+	"sound":                       "🔉",
+	"space_invader":               "👾",
+	"sparkles":                    "✨",
+	"sparkling_heart":             "💖",
+	"speech_balloon":              "💬",
+	"star":                        "⭐",
+	"star2":                       "🌟",
+	"stars":                       "🌠",
+	"stop_sign":                   "🛑",
+	"stopwatch":                   "⏱️",
+	"sunglasses":                  "😎",
+	"sunny":                       "☀️",
+	"sweat":                       "😓",
+	"sweat_smile":                 "😅",
+	"tada":                        "🎉",
+	"test_tube":                   "🧪",
+	"thinking":                    "🤔",
+	"thought_balloon":             "💭",
+	"three":                       "3️⃣",
+	"thumbsdown":                  "👎",
+	"thumbsup":                    "👍",
+	"ticket":                      "🎫",
+	"tired_face":                  "😫",
+	"tm":                          "™️",
+	"toolbox":                     "🧰",
+	"tophat":                      "🎩",
+	"trophy":                      "🏆",
+	"truck":                       "🚚",
+	"turtle":                      "🐢",
+	"two":                         "2️⃣",
+	"umbrella":                    "☔",
+	"unamused":                    "😒",
+	"unicorn":                     "🦄",
+	"unlock":                      "🔓",
+	"up":                          "🆙",
+	"v":                           "✌️",
+	"vertical_traffic_light":      "🚦",
+	"vhs":                         "📼",
+	"warning":                     "⚠️",
+	"wastebasket":                 "🗑️",
+	"watch":                       "⌚",
+	"wave":                        "👋",
+	"weary":                       "😩",
+	"whale":                       "🐳",
+	"wheelchair":                  "♿",
+	"white_check_mark":            "✅",
+	"wink":                        "😉",
+	"wip":                         "🚧",
+	"worried":                     "😟",
+	"wrench":                      "🔧",
+	"x":                           "❌",
+	"yellow_heart":                "💛",
+	"yum":                         "😋",
+	"zap":                         "⚡",
+	"zero":                        "0️⃣",
+	"zipper_mouth_face":           "🤐",
+	"zzz":                         "💤",
+}
+
+func isShortcodeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '+' || c == '-'
+}
+
+type emojiParser struct{}
+
+// Trigger implements parser.InlineParser.
+func (p *emojiParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+// Parse replaces a known `:shortcode:` with its Unicode emoji; anything else is left as text.
+func (p *emojiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if len(line) < 3 || line[0] != ':' {
+		return nil
+	}
+	end := 1
+	for end < len(line) && end <= 64 && isShortcodeChar(line[end]) {
+		end++
+	}
+	if end == 1 || end >= len(line) || line[end] != ':' {
+		return nil
+	}
+	emoji, ok := emojiShortcodes[string(line[1:end])]
+	if !ok {
+		return nil
+	}
+	block.Advance(end + 1)
+	return ast.NewString([]byte(emoji))
+}
+
+type emojiExtension struct{}
+
+// emojis expands GitHub `:shortcode:` emoji to Unicode.
+var emojis = &emojiExtension{}
+
+// Extend implements goldmark.Extender.
+func (e *emojiExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&emojiParser{}, 999),
+	))
+}
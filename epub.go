@@ -0,0 +1,434 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// chapterHeading captures the id of a block that is an H1 or H2.
+var chapterHeading = regexp.MustCompile(`^<h[12] id="([^"]+)"`)
+
+// xmlName matches attribute names that can be written in XHTML.
+var xmlName = regexp.MustCompile(`^[A-Za-z_][-A-Za-z0-9_.]*$`)
+
+// epubCSS undoes the page layout of the preview; e-readers set their own margins and text size.
+const epubCSS = `#wrapper{max-width:none;margin:0;padding:0}` +
+	`pre{white-space:pre-wrap;overflow-wrap:anywhere;padding:8px}` +
+	`img,svg{max-width:100%;height:auto}` +
+	`table{border-collapse:collapse}` +
+	`pre,table,figure,img{page-break-inside:avoid}`
+
+// epubVoidElements are written as empty XHTML elements.
+var epubVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// ExportEPUB exports the document at path as an EPUB 3 book, asking where to save it with the
+// save dialog. It returns the path written, or "" when the dialog is cancelled.
+func (a *App) ExportEPUB(path string, theme string) (string, error) {
+	path = normalizePath(path)
+	markdown, _, err := readDocument(path)
+	if err != nil {
+		return "", err
+	}
+	base := documentBase(path)
+	dest, err := a.chooseExportFile(base, ".epub", "EPUB (*.epub)")
+	if err != nil || dest == "" {
+		return "", err
+	}
+	book, err := sharedRenderer().RenderEPUB(markdown, base, documentTitle(path), theme)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(dest, book, 0o644); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// epubChapter is one content document of a book.
+type epubChapter struct {
+	file  string
+	title string
+	nodes []*xhtml.Node
+	svg   bool
+}
+
+// epubImage is a local image copied into a book.
+type epubImage struct {
+	file      string
+	mediaType string
+	data      []byte
+}
+
+// epubBook collects what goes into the package while chapters are written.
+type epubBook struct {
+	dir     string
+	anchors map[string]string
+	images  []epubImage
+	byPath  map[string]string
+}
+
+// RenderEPUB renders markdown as an EPUB 3 book: a chapter per H1 and H2, a navigation
+// document built from the TOC, the theme's CSS and the local images the document shows. An
+// empty title falls back to the first heading, then to the file name.
+func (r *Renderer) RenderEPUB(markdown, docPath, title, themeName string) ([]byte, error) {
+	st := r.newRenderState(htmlProfileForPath(docPath))
+	_, blocks, toc, err := r.renderBody(markdown, docPath, st)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" && len(toc) > 0 {
+		title = toc[0].Text
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(docPath), filepath.Ext(docPath))
+	}
+	if title == "" || title == "." {
+		title = "Untitled"
+	}
+
+	chapterTitles := map[string]string{}
+	for _, item := range toc {
+		if item.Level <= 2 {
+			chapterTitles[item.ID] = item.Text
+		}
+	}
+	book := &epubBook{dir: filepath.Dir(docPath), anchors: map[string]string{}, byPath: map[string]string{}}
+	var chapters []*epubChapter
+	var cur *epubChapter
+	for _, block := range blocks {
+		m := chapterHeading.FindStringSubmatch(block.HTML)
+		heading := ""
+		if m != nil {
+			heading = html.UnescapeString(m[1])
+		}
+		chapterTitle, starts := chapterTitles[heading]
+		if cur == nil || (starts && len(cur.nodes) > 0) {
+			cur = &epubChapter{file: "chapter-" + strconv.Itoa(len(chapters)+1) + ".xhtml", title: title}
+			chapters = append(chapters, cur)
+		}
+		if starts && len(cur.nodes) == 0 {
+			cur.title = chapterTitle
+		}
+		nodes, err := xhtml.ParseFragment(strings.NewReader(block.HTML), &xhtml.Node{Type: xhtml.ElementNode, Data: "div", DataAtom: atom.Div})
+		if err != nil {
+			return nil, err
+		}
+		cur.nodes = append(cur.nodes, nodes...)
+	}
+	if len(chapters) == 0 {
+		chapters = append(chapters, &epubChapter{file: "chapter-1.xhtml", title: title})
+	}
+	for _, ch := range chapters {
+		for _, n := range ch.nodes {
+			book.collectAnchors(n, ch.file)
+		}
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// The mimetype entry must come first and be stored uncompressed.
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte("application/epub+zip")); err != nil {
+		return nil, err
+	}
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+			`<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles>` +
+			`<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`},
+		{"OEBPS/style.css", admonitionCSS + diagramCSS + themeCSSByName(themeName, paletteLight) + paletteCSSByMode(paletteLight) + epubCSS},
+	}
+	for _, ch := range chapters {
+		var body strings.Builder
+		for _, n := range ch.nodes {
+			ch.svg = book.writeNode(&body, n, ch.file, false) || ch.svg
+		}
+		files = append(files, struct{ name, content string }{"OEBPS/" + ch.file, epubDocument(ch.title, body.String())})
+	}
+	files = append(files,
+		struct{ name, content string }{"OEBPS/nav.xhtml", book.navDocument(title, toc, chapters)},
+		struct{ name, content string }{"OEBPS/content.opf", book.packageDocument(markdown, docPath, title, chapters)})
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			return nil, err
+		}
+	}
+	for _, img := range book.images {
+		w, err := zw.Create("OEBPS/" + img.file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(img.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// collectAnchors records which chapter file each id in n ends up in.
+func (b *epubBook) collectAnchors(n *xhtml.Node, file string) {
+	for _, a := range n.Attr {
+		if a.Key == "id" && a.Namespace == "" {
+			if _, ok := b.anchors[a.Val]; !ok {
+				b.anchors[a.Val] = file
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.collectAnchors(c, file)
+	}
+}
+
+// writeNode writes n as XHTML. Scripts and comments are dropped, links to headings in other
+// chapters are pointed at their files, links to local files outside the book lose their
+// target, and images are copied into the book or, when that isn't possible, replaced by their
+// alt text. It reports whether it wrote any SVG.
+func (b *epubBook) writeNode(w *strings.Builder, n *xhtml.Node, file string, inSVG bool) bool {
+	switch n.Type {
+	case xhtml.TextNode:
+		w.WriteString(html.EscapeString(n.Data))
+		return false
+	case xhtml.ElementNode:
+	default:
+		return false
+	}
+	if n.Data == "script" {
+		return false
+	}
+	attrs := n.Attr
+	if n.Namespace == "" {
+		switch n.Data {
+		case "a":
+			attrs = b.linkAttrs(attrs, file)
+		case "img":
+			var ok bool
+			if attrs, ok = b.imageAttrs(attrs); !ok {
+				w.WriteString(html.EscapeString(attrValue(n.Attr, "alt")))
+				return false
+			}
+		}
+	}
+
+	svgRoot := n.Namespace == "svg" && !inSVG
+	w.WriteString("<" + n.Data)
+	if svgRoot {
+		w.WriteString(` xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"`)
+	} else if n.Namespace == "math" && n.Data == "math" {
+		w.WriteString(` xmlns="http://www.w3.org/1998/Math/MathML"`)
+	}
+	for _, a := range attrs {
+		name := a.Key
+		switch {
+		case a.Namespace == "xlink":
+			name = "xlink:" + a.Key
+		case a.Namespace == "xml":
+			name = "xml:" + a.Key
+		case a.Namespace != "" || !xmlName.MatchString(a.Key) || (svgRoot && (a.Key == "xmlns" || a.Key == "xmlns:xlink")):
+			continue
+		}
+		w.WriteString(" " + name + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	if (n.Namespace == "" && epubVoidElements[n.Data]) || (n.Namespace != "" && n.FirstChild == nil) {
+		w.WriteString("/>")
+		return n.Namespace == "svg"
+	}
+	w.WriteString(">")
+	svg := n.Namespace == "svg"
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		svg = b.writeNode(w, c, file, inSVG || svg) || svg
+	}
+	w.WriteString("</" + n.Data + ">")
+	return svg
+}
+
+// linkAttrs rewrites the href of a link for the chapter file it is in.
+func (b *epubBook) linkAttrs(attrs []xhtml.Attribute, file string) []xhtml.Attribute {
+	out := make([]xhtml.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Key == "href" && a.Namespace == "" {
+			if id, ok := strings.CutPrefix(a.Val, "#"); ok {
+				if target, found := b.anchors[id]; found && target != file {
+					a.Val = target + a.Val
+				}
+			} else if u, err := url.Parse(a.Val); err != nil || u.Scheme == "" {
+				continue
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// imageAttrs points the src of an image at its copy in the book. It returns false for images
+// that can't be embedded: remote ones and local files that can't be read.
+func (b *epubBook) imageAttrs(attrs []xhtml.Attribute) ([]xhtml.Attribute, bool) {
+	out := make([]xhtml.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Key == "src" && a.Namespace == "" {
+			src, ok := b.embedImage(a.Val)
+			if !ok {
+				return nil, false
+			}
+			a.Val = src
+		}
+		out = append(out, a)
+	}
+	return out, true
+}
+
+// embedImage copies the local image src refers to into the book once and returns its path
+// there. data: URLs are kept as they are.
+func (b *epubBook) embedImage(src string) (string, bool) {
+	if strings.HasPrefix(src, "data:") {
+		return src, true
+	}
+	p, ok := localImagePath(src, b.dir)
+	if !ok {
+		return "", false
+	}
+	if file, ok := b.byPath[p]; ok {
+		return file, true
+	}
+	ext := strings.ToLower(filepath.Ext(p))
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(ext), ";")
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", false
+	}
+	if err := enforceFileLimit(p); err != nil {
+		return "", false
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", false
+	}
+	file := "images/image-" + strconv.Itoa(len(b.images)+1) + ext
+	b.images = append(b.images, epubImage{file: file, mediaType: mediaType, data: data})
+	b.byPath[p] = file
+	return file, true
+}
+
+// localImagePath returns the file an image src refers to, relative to dir unless absolute. It
+// returns false for remote images.
+func localImagePath(src, dir string) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "" && u.Scheme != "file") || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	p := filepath.FromSlash(u.Path)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return p, true
+}
+
+// attrValue returns the value of the attribute named key, or "".
+func attrValue(attrs []xhtml.Attribute, key string) string {
+	for _, a := range attrs {
+		if a.Key == key && a.Namespace == "" {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// epubDocument wraps a chapter body in an XHTML content document.
+func epubDocument(title, body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<!DOCTYPE html>` + "\n" +
+		`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="en" xml:lang="en">` +
+		`<head><meta charset="utf-8"/><title>` + html.EscapeString(title) + `</title>` +
+		`<link rel="stylesheet" type="text/css" href="style.css"/></head>` +
+		`<body><div id="wrapper">` + body + `</div></body></html>`
+}
+
+// navDocument builds the navigation document from the TOC, nesting entries by level.
+func (b *epubBook) navDocument(title string, toc []TOCItem, chapters []*epubChapter) string {
+	var list strings.Builder
+	var levels []int
+	for _, item := range toc {
+		file, ok := b.anchors[item.ID]
+		if !ok {
+			continue
+		}
+		closed := 0
+		for len(levels) > 0 && levels[len(levels)-1] >= item.Level {
+			levels = levels[:len(levels)-1]
+			closed++
+		}
+		if closed == 0 {
+			list.WriteString("<ol>")
+		} else {
+			list.WriteString("</li>" + strings.Repeat("</ol></li>", closed-1))
+		}
+		levels = append(levels, item.Level)
+		list.WriteString(`<li><a href="` + html.EscapeString(file+"#"+item.ID) + `">` + html.EscapeString(item.Text) + `</a>`)
+	}
+	list.WriteString(strings.Repeat("</li></ol>", len(levels)))
+	if list.Len() == 0 {
+		// A book needs at least one entry; point it at the first chapter.
+		list.WriteString(`<ol><li><a href="` + chapters[0].file + `">` + html.EscapeString(title) + `</a></li></ol>`)
+	}
+	return epubDocument(title, `<nav epub:type="toc" id="toc"><h1>`+html.EscapeString(title)+`</h1>`+list.String()+`</nav>`)
+}
+
+// packageDocument builds content.opf: the book's metadata, its files and their reading order.
+// The identifier is derived from the document so re-exports of the same text match.
+func (b *epubBook) packageDocument(markdown, docPath, title string, chapters []*epubChapter) string {
+	sum := sha1.Sum([]byte(docPath + "\x00" + markdown))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	uuid := fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+
+	var manifest, spine strings.Builder
+	manifest.WriteString(`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`)
+	manifest.WriteString(`<item id="css" href="style.css" media-type="text/css"/>`)
+	for i, ch := range chapters {
+		id := "chapter-" + strconv.Itoa(i+1)
+		props := ""
+		if ch.svg {
+			props = ` properties="svg"`
+		}
+		manifest.WriteString(`<item id="` + id + `" href="` + ch.file + `" media-type="application/xhtml+xml"` + props + `/>`)
+		spine.WriteString(`<itemref idref="` + id + `"/>`)
+	}
+	for i, img := range b.images {
+		manifest.WriteString(`<item id="image-` + strconv.Itoa(i+1) + `" href="` + img.file + `" media-type="` + img.mediaType + `"/>`)
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="en">` +
+		`<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+		`<dc:identifier id="book-id">urn:uuid:` + uuid + `</dc:identifier>` +
+		`<dc:title>` + html.EscapeString(title) + `</dc:title>` +
+		`<dc:language>en</dc:language>` +
+		`<meta property="dcterms:modified">` + time.Now().UTC().Format("2006-01-02T15:04:05Z") + `</meta>` +
+		`</metadata>` +
+		`<manifest>` + manifest.String() + `</manifest>` +
+		`<spine>` + spine.String() + `</spine>` +
+		`</package>`
+}
@@ -1,8 +1,8 @@
 import './style.css';
 import './app.css';
 
-import { GetAutoReload, GetFontScale, GetLaunchArgs, GetPalette, GetTheme, GetTOCPinned, GetTOCVisible, ListThemes, OpenAndRender, RenderFileWithPaletteAndTOC, SetAutoReload, SetFontScale, SetPalette, SetTheme, SetTOCPinned, SetTOCVisible, StartWatchingFile, StopWatchingFile, SearchDocument, NavigateSearch, ClearSearch, GetSearchCaseSensitive, SetSearchCaseSensitive, GetRecentFiles, AddRecentFile, ClearRecentFiles, GetReadingProgress, SetReadingProgress } from '../wailsjs/go/main/App';
-import { EventsOn } from '../wailsjs/runtime/runtime';
+import { GetAutoReload, GetFontScale, GetLaunchArgs, GetPalette, GetTheme, GetTOCPinned, GetTOCVisible, ListThemes, OpenAndRender, RenderFileWithPaletteAndTOC, SetAutoReload, SetFontScale, SetPalette, SetTheme, SetTOCPinned, SetTOCVisible, StartWatchingFile, StopWatchingFile, SearchDocument, NavigateSearch, ClearSearch, GetSearchCaseSensitive, SetSearchCaseSensitive, GetRecentFiles, AddRecentFile, ClearRecentFiles, GetReadingProgress, SetReadingProgress, GetBacklinks, ResolveLink, RenderFilePatch, GetRemovedContent, GetSource, GetLaunchGoto, ChooseMarkdownFile, RenderDiff, RenderGitDiff, RenderSlides, GetSlideSplit, SetSlideSplit, RenderPrint, ExportEPUB, ExportDOCX, GetPandocFormats, ExportWithPandoc, CopySection } from '../wailsjs/go/main/App';
+import { EventsOn, WindowFullscreen, WindowUnfullscreen } from '../wailsjs/runtime/runtime';
 
 document.querySelector('#app').innerHTML = `
   <div class="shell">
@@ -32,10 +32,19 @@ document.querySelector('#app').innerHTML = `
           <option value="dark">dark</option>
           <option value="theme">theme</option>
         </select>
+        <select id="viewMode" class="select" title="View mode (${navigator.platform.toUpperCase().indexOf('MAC') >= 0 ? 'Cmd' : 'Ctrl'}+U)">
+          <option value="preview">preview</option>
+          <option value="source">source</option>
+          <option value="split">split</option>
+          <option value="slides">slides</option>
+        </select>
         <label class="auto-reload-label" title="Auto-reload file on changes">
           <input type="checkbox" id="autoReload" class="auto-reload-checkbox">
           Auto-reload
         </label>
+        <button id="compare" class="btn" title="Compare with another version (${navigator.platform.toUpperCase().indexOf('MAC') >= 0 ? 'Cmd' : 'Ctrl'}+Shift+D)">Compare…</button>
+        <button id="export" class="btn" title="Export to another format">Export…</button>
+        <button id="print" class="btn" title="Print (${navigator.platform.toUpperCase().indexOf('MAC') >= 0 ? 'Cmd' : 'Ctrl'}+Shift+P)">Print…</button>
         <button id="open" class="btn">Open…</button>
       </div>
       <div id="path" class="path"></div>
@@ -51,8 +60,29 @@ document.querySelector('#app').innerHTML = `
           </button>
         </div>
         <nav id="tocNav" class="toc-nav"></nav>
+        <div class="backlinks-header">Backlinks</div>
+        <nav id="backlinksNav" class="backlinks-nav"></nav>
       </aside>
       <iframe id="preview" class="preview"></iframe>
+      <div id="sourceView" class="source-view" hidden></div>
+      <div id="slideBar" class="slide-bar" hidden>
+        <button id="slidePrev" class="btn" title="Previous slide (←)">‹</button>
+        <span id="slideCounter" class="slide-counter"></span>
+        <button id="slideNext" class="btn" title="Next slide (→, Space)">›</button>
+        <select id="slideSplit" class="select" title="Start a new slide at">
+          <option value="hr">---</option>
+          <option value="h1"># headings</option>
+          <option value="h2">## headings</option>
+          <option value="h3">### headings</option>
+        </select>
+        <button id="slideOverview" class="btn" title="Slide overview (O)">Overview</button>
+        <button id="slideNotesToggle" class="btn" title="Presenter notes (N)">Notes</button>
+        <button id="slideFullscreen" class="btn" title="Fullscreen (F)">Fullscreen</button>
+      </div>
+      <div id="slideNotes" class="slide-notes" hidden>
+        <div id="slideNotesHeader" class="slide-notes-header"></div>
+        <div id="slideNotesBody" class="slide-notes-body"></div>
+      </div>
     </main>
     <footer class="status-bar">
       <div class="progress-container">
@@ -62,6 +92,9 @@ document.querySelector('#app').innerHTML = `
         <span id="progressPercent" class="progress-percent">0%</span>
       </div>
       <div id="status" class="status">Ready</div>
+      <button id="showRemoved" class="status-action" hidden>Show what was removed</button>
+      <button id="closeDiff" class="status-action" hidden>Close comparison</button>
+      <button id="nextChange" class="status-action" hidden title="Next change (]), previous change ([)">Next change</button>
     </footer>
   </div>
   
@@ -83,6 +116,83 @@ document.querySelector('#app').innerHTML = `
       </div>
     </div>
   </div>
+
+  <!-- Content removed by the HTML sanitizer -->
+  <div id="removedDialog" class="removed-dialog" hidden>
+    <div class="removed-dialog-header">
+      <span>Removed by the HTML sanitizer</span>
+      <button id="removedClose" class="search-close-btn" title="Close (Esc)">✕</button>
+    </div>
+    <div id="removedBody" class="removed-dialog-body"></div>
+  </div>
+
+  <!-- Compare the document with another version -->
+  <div id="compareDialog" class="removed-dialog compare-dialog" hidden>
+    <div class="removed-dialog-header">
+      <span>Compare with…</span>
+      <button id="compareClose" class="search-close-btn" title="Close (Esc)">✕</button>
+    </div>
+    <div class="removed-dialog-body compare-body">
+      <label for="compareRev">Git revision</label>
+      <input type="text" id="compareRev" class="compare-rev" value="HEAD" spellcheck="false">
+      <button id="compareRevBtn" class="btn">Compare</button>
+      <button id="compareFileBtn" class="btn">Another file…</button>
+    </div>
+  </div>
+
+  <!-- Export formats -->
+  <div id="exportDialog" class="removed-dialog export-dialog" hidden>
+    <div class="removed-dialog-header">
+      <span>Export as…</span>
+      <button id="exportClose" class="search-close-btn" title="Close (Esc)">✕</button>
+    </div>
+    <div id="exportFormats" class="removed-dialog-body export-body">
+      <button class="btn" data-format="epub" title="EPUB 3 book with a chapter per H1/H2">EPUB</button>
+      <button class="btn" data-format="docx" title="Word document using Word's heading, list, code and quote styles">Word (DOCX)</button>
+    </div>
+    <div id="pandocExport" class="removed-dialog-body export-pandoc">
+      <label for="pandocFormat">With pandoc</label>
+      <select id="pandocFormat" disabled></select>
+      <button id="pandocExportBtn" class="btn" disabled>Export</button>
+      <div id="pandocNote" class="export-note"></div>
+    </div>
+  </div>
+
+  <!-- Copy a section or the document -->
+  <div id="copyDialog" class="removed-dialog copy-dialog" hidden>
+    <div class="removed-dialog-header">
+      <span id="copyTitle">Copy</span>
+      <button id="copyClose" class="search-close-btn" title="Close (Esc)">✕</button>
+    </div>
+    <div id="copyFormats" class="removed-dialog-body export-body">
+      <button class="btn" data-format="html" title="Rendered, with inline styles for mail and chat">Rich text</button>
+      <button class="btn" data-format="text">Plain text</button>
+      <button class="btn" data-format="markdown" title="The Markdown source">Markdown</button>
+    </div>
+  </div>
+
+  <!-- Print options -->
+  <div id="printDialog" class="removed-dialog print-dialog" hidden>
+    <div class="removed-dialog-header">
+      <span>Print</span>
+      <button id="printClose" class="search-close-btn" title="Close (Esc)">✕</button>
+    </div>
+    <div class="removed-dialog-body print-body">
+      <label class="auto-reload-label">
+        <input type="checkbox" id="printLinkURLs" class="auto-reload-checkbox" checked>
+        Show link URLs
+      </label>
+      <label for="printFontScale">Text size</label>
+      <select id="printFontScale">
+        <option value="80">80%</option>
+        <option value="90">90%</option>
+        <option value="100" selected>100%</option>
+        <option value="110">110%</option>
+        <option value="125">125%</option>
+      </select>
+      <button id="printBtn" class="btn">Print</button>
+    </div>
+  </div>
 `;
 
 const themeEl = document.getElementById('theme');
@@ -99,8 +209,53 @@ const tocToggleEl = document.getElementById('tocToggle');
 const tocSidebarEl = document.getElementById('tocSidebar');
 const tocNavEl = document.getElementById('tocNav');
 const tocPinEl = document.getElementById('tocPin');
+const backlinksNavEl = document.getElementById('backlinksNav');
+const contentEl = document.querySelector('.content');
+const viewModeEl = document.getElementById('viewMode');
+const sourceViewEl = document.getElementById('sourceView');
 const statusBarEl = document.querySelector('.status-bar');
 const statusTextEl = document.getElementById('status');
+const showRemovedEl = document.getElementById('showRemoved');
+const removedDialogEl = document.getElementById('removedDialog');
+const removedBodyEl = document.getElementById('removedBody');
+const removedCloseEl = document.getElementById('removedClose');
+const compareEl = document.getElementById('compare');
+const closeDiffEl = document.getElementById('closeDiff');
+const nextChangeEl = document.getElementById('nextChange');
+const shellEl = document.querySelector('.shell');
+const slideBarEl = document.getElementById('slideBar');
+const slidePrevEl = document.getElementById('slidePrev');
+const slideNextEl = document.getElementById('slideNext');
+const slideCounterEl = document.getElementById('slideCounter');
+const slideSplitEl = document.getElementById('slideSplit');
+const slideOverviewEl = document.getElementById('slideOverview');
+const slideNotesToggleEl = document.getElementById('slideNotesToggle');
+const slideFullscreenEl = document.getElementById('slideFullscreen');
+const slideNotesEl = document.getElementById('slideNotes');
+const slideNotesHeaderEl = document.getElementById('slideNotesHeader');
+const slideNotesBodyEl = document.getElementById('slideNotesBody');
+const compareDialogEl = document.getElementById('compareDialog');
+const compareCloseEl = document.getElementById('compareClose');
+const compareRevEl = document.getElementById('compareRev');
+const compareRevBtnEl = document.getElementById('compareRevBtn');
+const compareFileBtnEl = document.getElementById('compareFileBtn');
+const exportEl = document.getElementById('export');
+const exportDialogEl = document.getElementById('exportDialog');
+const exportCloseEl = document.getElementById('exportClose');
+const exportFormatsEl = document.getElementById('exportFormats');
+const pandocFormatEl = document.getElementById('pandocFormat');
+const pandocExportBtnEl = document.getElementById('pandocExportBtn');
+const pandocNoteEl = document.getElementById('pandocNote');
+const copyDialogEl = document.getElementById('copyDialog');
+const copyTitleEl = document.getElementById('copyTitle');
+const copyCloseEl = document.getElementById('copyClose');
+const copyFormatsEl = document.getElementById('copyFormats');
+const printEl = document.getElementById('print');
+const printDialogEl = document.getElementById('printDialog');
+const printCloseEl = document.getElementById('printClose');
+const printLinkURLsEl = document.getElementById('printLinkURLs');
+const printFontScaleEl = document.getElementById('printFontScale');
+const printBtnEl = document.getElementById('printBtn');
 
 // Search elements
 const searchBarEl = document.getElementById('searchBar');
@@ -127,12 +282,38 @@ if (previewEl) {
 }
 
 let currentPath = '';
+// The comparison shown instead of the document: { path, rev } or { path, oldPath }
+let diffView = null;
+// Blocks added or modified by the last reload, and the one last jumped to
+let changedBlockIds = [];
+let changedIndex = -1;
+let flashChangesOnLoad = false;
+// Slides mode: the rendered deck and the slide shown
+let slideDeck = null;
+let slideIndex = 0;
+let slideOverview = false;
 let fontScale = 100;
 let autoReloadEnabled = false;
 let tocVisible = false;
 let tocPinned = false;
 let currentTOC = [];
 
+// Progressive rendering of large files: the first page comes back from the render call and
+// the rest arrives as render-chunk events tagged with the render's stream ID.
+let currentStreamId = 0;
+let progressiveView = false;
+let previewReady = false;
+const chunkQueue = [];
+
+// What the HTML sanitizer removed from the current document
+let removedContent = [];
+
+// Preview, Markdown source, or both side by side
+let viewMode = 'preview';
+
+// Source line an editor asked to show, applied once the preview has loaded
+let pendingGotoLine = 0;
+
 // Search state
 let searchOpen = false;
 let currentSearchResults = [];
@@ -448,8 +629,9 @@ async function loadRecentFiles() {
   }
 }
 
-function setPreview(html, charCount, wordCount) {
+function setPreview(html, charCount, wordCount, removed) {
   const doc = html || '<!DOCTYPE html><html><body></body></html>';
+  previewReady = false;
 
   previewEl.onload = () => {
     try {
@@ -457,21 +639,617 @@ function setPreview(html, charCount, wordCount) {
         previewEl.contentWindow.document.open();
         previewEl.contentWindow.document.write(doc);
         previewEl.contentWindow.document.close();
+        previewEl.contentWindow.document.addEventListener('click', handlePreviewClick);
       }
     } catch (e) {
     }
+    previewReady = true;
+    drainChunks();
+    applyPendingGoto(!progressiveView);
+    if (flashChangesOnLoad) {
+      flashChangesOnLoad = false;
+      flashChangedBlocks(changedBlockIds);
+    }
+    if (viewMode === 'slides' && slideDeck) {
+      initSlideFrame();
+    }
   };
 
   previewEl.srcdoc = doc;
   
   // Display character and word count if provided
   if (charCount !== undefined && wordCount !== undefined) {
-    setStatus('info', `${wordCount.toLocaleString()} words, ${charCount.toLocaleString()} chars`);
+    setDocumentStatus(charCount, wordCount, removed);
   } else {
+    setRemovedContent([]);
     setStatus('info', `Loaded ${doc.length} chars`);
   }
 }
 
+// Shows the path of the document in the title bar, or the title of a virtual document (piped
+// text or a file at a git revision), marked read-only.
+function setDocumentTitle(res) {
+  const readOnly = !!(res && res.readOnly);
+  pathEl.textContent = readOnly ? `${res.title || res.path} (read-only)` : currentPath;
+  pathEl.title = readOnly ? 'Virtual document: not a file on disk, so it is not watched for changes' : currentPath;
+  pathEl.classList.toggle('read-only', readOnly);
+}
+
+// Shows the document's word count, or a warning when the sanitizer removed content from it.
+function setDocumentStatus(charCount, wordCount, removed) {
+  setRemovedContent(removed);
+  if (removedContent.length) {
+    const parts = removedContent.map(r => `${r.count}× ${r.label}`);
+    setStatus('warning', `Sanitizer removed ${parts.join(', ')}`);
+    return;
+  }
+  setStatus('info', `${wordCount.toLocaleString()} words, ${charCount.toLocaleString()} chars`);
+}
+
+function setRemovedContent(removed) {
+  removedContent = removed || [];
+  if (showRemovedEl) {
+    showRemovedEl.hidden = removedContent.length === 0;
+  }
+  if (!removedContent.length) {
+    closeRemovedDialog();
+  }
+}
+
+// Lists each changed block as a line diff of its HTML before and after sanitizing.
+async function openRemovedDialog() {
+  let blocks = [];
+  try {
+    blocks = await GetRemovedContent();
+  } catch (err) {
+    setStatus('error', formatError(err));
+    return;
+  }
+  removedBodyEl.textContent = '';
+  if (!blocks || !blocks.length) {
+    removedBodyEl.textContent = 'Nothing was removed.';
+  }
+  for (const block of blocks || []) {
+    const pre = document.createElement('pre');
+    pre.className = 'removed-diff';
+    for (const [op, line] of diffLines(block.before, block.after)) {
+      const row = document.createElement('div');
+      row.className = op === '-' ? 'diff-del' : op === '+' ? 'diff-add' : 'diff-same';
+      row.textContent = `${op} ${line}`;
+      pre.appendChild(row);
+    }
+    removedBodyEl.appendChild(pre);
+  }
+  removedDialogEl.hidden = false;
+}
+
+function closeRemovedDialog() {
+  if (removedDialogEl) {
+    removedDialogEl.hidden = true;
+  }
+}
+
+function openCompareDialog() {
+  if (!currentPath) {
+    setStatus('info', 'Open a document to compare');
+    return;
+  }
+  compareDialogEl.hidden = false;
+  compareRevEl.focus();
+  compareRevEl.select();
+}
+
+function closeCompareDialog() {
+  compareDialogEl.hidden = true;
+}
+
+// Export bindings by format; each asks where to save and returns the path written, or ""
+// when cancelled. Formats pandoc offers are exported as `pandoc:<format>`.
+const exporters = {
+  epub: (path) => ExportEPUB(path, themeEl.value),
+  docx: (path) => ExportDOCX(path),
+};
+
+function openExportDialog() {
+  if (!currentPath) {
+    setStatus('info', 'Open a document to export');
+    return;
+  }
+  exportDialogEl.hidden = false;
+  exportFormatsEl.querySelector('button')?.focus();
+  loadPandocFormats();
+}
+
+function closeExportDialog() {
+  exportDialogEl.hidden = true;
+}
+
+// Fills the pandoc format menu from the local pandoc, or says how to get it.
+async function loadPandocFormats() {
+  if (pandocFormatEl.options.length > 0) return;
+  try {
+    const formats = await GetPandocFormats();
+    for (const format of formats || []) {
+      const opt = document.createElement('option');
+      opt.value = format;
+      opt.textContent = format;
+      pandocFormatEl.appendChild(opt);
+    }
+    pandocFormatEl.value = formats.includes('odt') ? 'odt' : formats[0];
+    pandocFormatEl.disabled = false;
+    pandocExportBtnEl.disabled = false;
+    pandocNoteEl.textContent = '';
+  } catch (err) {
+    pandocNoteEl.textContent = formatError(err);
+  }
+}
+
+async function exportDocument(format) {
+  closeExportDialog();
+  if (!currentPath) return;
+  let exporter = exporters[format];
+  let name = format.toUpperCase();
+  if (format.startsWith('pandoc:')) {
+    name = format.slice('pandoc:'.length);
+    exporter = (path) => ExportWithPandoc(path, themeEl.value, name);
+  }
+  if (!exporter) return;
+  setStatus('info', `Exporting ${name}…`);
+  try {
+    const dest = await exporter(currentPath);
+    setStatus('info', dest ? `Exported to ${dest}` : 'Export cancelled');
+  } catch (err) {
+    console.error(err);
+    setStatus('error', formatError(err));
+  }
+}
+
+// The heading id of the section the copy dialog copies; '' copies the whole document.
+let copySectionId = '';
+
+function openCopyDialog(id = '') {
+  if (!currentPath) {
+    setStatus('info', 'Open a document to copy');
+    return;
+  }
+  copySectionId = id;
+  const item = currentTOC.find((entry) => entry.id === id);
+  copyTitleEl.textContent = item ? `Copy section “${item.text}” as…` : 'Copy document as…';
+  copyDialogEl.hidden = false;
+  copyFormatsEl.querySelector('button')?.focus();
+}
+
+function closeCopyDialog() {
+  copyDialogEl.hidden = true;
+}
+
+// Copies the section (or document) to the clipboard. The backend puts the text on the
+// clipboard; rich text copies also add the styled HTML where the webview allows it.
+async function copySection(format) {
+  closeCopyDialog();
+  try {
+    const res = await CopySection(currentPath, copySectionId, format);
+    if (res.html && window.ClipboardItem && navigator.clipboard?.write) {
+      try {
+        await navigator.clipboard.write([new ClipboardItem({
+          'text/html': new Blob([res.html], { type: 'text/html' }),
+          'text/plain': new Blob([res.text], { type: 'text/plain' }),
+        })]);
+      } catch (err) {
+        console.warn('Rich text copy unavailable, copied plain text:', err);
+      }
+    }
+    const what = copySectionId ? 'section' : 'document';
+    const names = { html: 'rich text', text: 'plain text', markdown: 'Markdown' };
+    setStatus('info', `Copied ${what} as ${names[format]}`);
+  } catch (err) {
+    console.error(err);
+    setStatus('error', formatError(err));
+  }
+}
+
+function openPrintDialog() {
+  if (!currentPath) {
+    setStatus('info', 'Open a document to print');
+    return;
+  }
+  printDialogEl.hidden = false;
+  printBtnEl.focus();
+}
+
+function closePrintDialog() {
+  printDialogEl.hidden = true;
+}
+
+// Prints the document from a hidden frame holding its print rendering (light palette and the
+// print stylesheet), so the preview itself is left as it is.
+async function printDocument() {
+  closePrintDialog();
+  let page;
+  try {
+    page = await RenderPrint(currentPath, themeEl.value, {
+      linkURLs: printLinkURLsEl.checked,
+      fontScale: Number(printFontScaleEl.value),
+    });
+  } catch (err) {
+    console.error(err);
+    setStatus('error', formatError(err));
+    return;
+  }
+  const frame = document.createElement('iframe');
+  frame.className = 'print-frame';
+  frame.setAttribute('sandbox', 'allow-same-origin allow-scripts allow-modals');
+  frame.addEventListener('load', async () => {
+    await waitForDiagrams(frame.contentDocument, 3000);
+    try {
+      frame.contentWindow.focus();
+      frame.contentWindow.print();
+    } catch (err) {
+      setStatus('error', formatError(err));
+    }
+    setTimeout(() => frame.remove(), 1000);
+  }, { once: true });
+  frame.srcdoc = page;
+  document.body.appendChild(frame);
+  setStatus('info', 'Printing…');
+}
+
+// Resolves once every Mermaid diagram in doc has rendered, or after timeout ms.
+function waitForDiagrams(doc, timeout) {
+  const deadline = Date.now() + timeout;
+  return new Promise((resolve) => {
+    const check = () => {
+      const pending = [...doc.querySelectorAll('.mermaid')].some((el) => !el.querySelector('svg'));
+      if (!pending || Date.now() >= deadline) {
+        resolve();
+      } else {
+        setTimeout(check, 100);
+      }
+    };
+    check();
+  });
+}
+
+// Shows the document side by side with another version of it (a git revision or another
+// file), with the changes listed in the sidebar.
+async function showDiff(view) {
+  closeCompareDialog();
+  if (!view.path) return;
+  setDiffView(view);
+  await renderDiffView();
+}
+
+async function renderDiffView() {
+  const view = diffView;
+  let res;
+  try {
+    res = view.rev ? await RenderGitDiff(view.path, view.rev) : await RenderDiff(view.oldPath, view.path);
+  } catch (err) {
+    console.error(err);
+    setDiffView(null);
+    setStatus('error', formatError(err));
+    return;
+  }
+  if (diffView !== view) return;
+  trackStream({});
+  setPreview(res.html);
+  renderDiffChanges(res.changes || []);
+  const n = (res.changes || []).length;
+  setStatus('info', n ? `${n} change${n === 1 ? '' : 's'} since ${res.oldTitle}` : `No changes since ${res.oldTitle}`);
+}
+
+function setDiffView(view) {
+  diffView = view;
+  closeDiffEl.hidden = !view;
+}
+
+function closeDiffView() {
+  setDiffView(null);
+  rerender();
+}
+
+// Lists the changes of a comparison in the sidebar in place of the Table of Contents.
+function renderDiffChanges(changes) {
+  currentTOC = [];
+  if (!changes.length) {
+    tocNavEl.innerHTML = '<div class="toc-empty">No changes</div>';
+    return;
+  }
+  const signs = { inserted: '+', deleted: '−', modified: '~' };
+  tocNavEl.innerHTML = changes.map(c =>
+    `<a href="#${c.id}" class="toc-item diff-change diff-change-${c.kind}" data-id="${c.id}" title="${c.kind}, line ${c.newLine || c.oldLine}">${signs[c.kind] || ''} ${escapeHTML(c.text)}</a>`
+  ).join('');
+  tocNavEl.querySelectorAll('.toc-item').forEach(item => {
+    item.addEventListener('click', (e) => {
+      e.preventDefault();
+      const el = previewEl.contentDocument && previewEl.contentDocument.getElementById(item.dataset.id);
+      if (el) {
+        el.scrollIntoView({ behavior: 'smooth', block: 'start' });
+      }
+    });
+  });
+}
+
+// Minimal LCS line diff; sanitized blocks are small.
+function diffLines(before, after) {
+  const a = (before || '').replace(/\n$/, '').split('\n');
+  const b = (after || '').replace(/\n$/, '').split('\n');
+  const lcs = Array.from({ length: a.length + 1 }, () => new Array(b.length + 1).fill(0));
+  for (let i = a.length - 1; i >= 0; i--) {
+    for (let j = b.length - 1; j >= 0; j--) {
+      lcs[i][j] = a[i] === b[j] ? lcs[i + 1][j + 1] + 1 : Math.max(lcs[i + 1][j], lcs[i][j + 1]);
+    }
+  }
+  const out = [];
+  let i = 0;
+  let j = 0;
+  while (i < a.length || j < b.length) {
+    if (i < a.length && j < b.length && a[i] === b[j]) {
+      out.push([' ', a[i]]);
+      i++;
+      j++;
+    } else if (j >= b.length || (i < a.length && lcs[i + 1][j] >= lcs[i][j + 1])) {
+      out.push(['-', a[i++]]);
+    } else {
+      out.push(['+', b[j++]]);
+    }
+  }
+  return out;
+}
+
+function setViewMode(mode) {
+  const wasSlides = viewMode === 'slides';
+  viewMode = ['source', 'split', 'slides'].includes(mode) ? mode : 'preview';
+  viewModeEl.value = viewMode;
+  contentEl.dataset.view = viewMode;
+  sourceViewEl.hidden = viewMode === 'preview' || viewMode === 'slides';
+  if (wasSlides && viewMode !== 'slides') {
+    leaveSlides();
+  }
+  if (wasSlides !== (viewMode === 'slides')) {
+    rerender();
+  }
+  loadSource();
+}
+
+function cycleViewMode() {
+  const modes = ['preview', 'source', 'split'];
+  setViewMode(modes[(modes.indexOf(viewMode) + 1) % modes.length]);
+  setStatus('info', `View: ${viewMode} (${modifierKey === 'metaKey' ? 'Cmd' : 'Ctrl'}+U)`);
+}
+
+// Loads the current document's Markdown into the source view when it is showing.
+async function loadSource() {
+  if (viewMode === 'preview' || viewMode === 'slides' || !currentPath) return;
+  try {
+    renderSource(await GetSource(currentPath));
+  } catch (err) {
+    console.error('Failed to load source:', err);
+    setStatus('error', formatError(err));
+  }
+}
+
+// Lists the source one row per line. Lines are numbered as in the rendered blocks'
+// data-source-line; the gutter shows the file's own line numbers, leaving included lines blank.
+function renderSource(src) {
+  const scrollTop = sourceViewEl.scrollTop;
+  const lines = (src.markdown || '').replace(/\n$/, '').split('\n');
+  const fileLines = src.fileLines || [];
+  const rows = document.createDocumentFragment();
+  let fence = '';
+  lines.forEach((text, i) => {
+    const row = document.createElement('div');
+    row.className = 'source-line';
+    row.dataset.line = i + 1;
+    const gutter = document.createElement('span');
+    gutter.className = 'source-gutter';
+    if (!fileLines.length) {
+      gutter.textContent = i + 1;
+    } else if (fileLines[i] !== fileLines[i - 1]) {
+      gutter.textContent = fileLines[i];
+    } else {
+      row.classList.add('source-included');
+    }
+    const code = document.createElement('span');
+    code.className = 'source-text';
+    let html;
+    [html, fence] = highlightMarkdownLine(text, fence);
+    code.innerHTML = html;
+    row.append(gutter, code);
+    rows.appendChild(row);
+  });
+  sourceViewEl.replaceChildren(rows);
+  sourceViewEl.scrollTop = scrollTop;
+}
+
+// Scrolls the preview to the block holding a source line, as asked by an editor.
+function gotoSourceLine(line) {
+  if (!line) return;
+  pendingGotoLine = line;
+  applyPendingGoto(!progressiveView);
+}
+
+// Applies pendingGotoLine once the preview is ready. While a large document is still
+// streaming, a line past the blocks received so far waits for more unless final is set.
+function applyPendingGoto(final) {
+  const line = pendingGotoLine;
+  if (!line || !previewReady) return;
+  const doc = previewEl.contentDocument;
+  const wrapper = doc && doc.getElementById('wrapper');
+  if (!wrapper) return;
+
+  let block = null;
+  for (const el of wrapper.querySelectorAll(':scope > .mdr-block')) {
+    if (Number(el.dataset.sourceLine) > line) break;
+    block = el;
+  }
+  if (!block && !final) return;
+  if (block && !final && Number(block.dataset.sourceEnd) < line && !block.nextElementSibling) return;
+  pendingGotoLine = 0;
+  if (!block) block = wrapper.querySelector('.mdr-block');
+  if (!block) return;
+
+  // Blocks are display: contents, so scroll to the innermost annotated element instead.
+  let target = block.firstElementChild || block;
+  for (const el of block.querySelectorAll('[data-source-line]')) {
+    if (Number(el.dataset.sourceLine) > line) break;
+    target = el;
+  }
+  target.scrollIntoView({ block: 'start' });
+  if (viewMode === 'split') {
+    highlightSource(line, line);
+  }
+}
+
+function highlightSource(line, endLine) {
+  if (!line) return;
+  for (const el of sourceViewEl.querySelectorAll('.source-active')) {
+    el.classList.remove('source-active');
+  }
+  const last = Math.max(line, endLine || line);
+  for (let l = line; l <= last; l++) {
+    const row = sourceViewEl.querySelector(`.source-line[data-line="${l}"]`);
+    if (row) row.classList.add('source-active');
+  }
+  const first = sourceViewEl.querySelector(`.source-line[data-line="${line}"]`);
+  if (first) first.scrollIntoView({ block: 'center' });
+}
+
+function escapeHTML(text) {
+  return text.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').replace(/"/g, '&quot;');
+}
+
+const inlineMarkdown = /(`+)[^`]+?\1|!?\[[^\]]*\]\([^)]*\)|\[\[[^\]]+\]\]|\*\*[^*]+\*\*|__[^_]+__|\*[^*\s][^*]*\*|<\/?[a-zA-Z][^>]*>/g;
+
+// Colours one line of Markdown. fence is the open code fence carried between lines.
+function highlightMarkdownLine(text, fence) {
+  const trimmed = text.trim();
+  if (fence) {
+    const closes = trimmed.startsWith(fence);
+    return [`<span class="md-code">${escapeHTML(text)}</span>`, closes ? '' : fence];
+  }
+  const open = text.match(/^\s{0,3}(`{3,}|~{3,})/);
+  if (open) {
+    return [`<span class="md-code">${escapeHTML(text)}</span>`, open[1]];
+  }
+  if (/^\s{0,3}#{1,6}(\s|$)/.test(text)) {
+    return [`<span class="md-heading">${escapeHTML(text)}</span>`, ''];
+  }
+  if (/^\s{0,3}([-*_])(\s*\1){2,}\s*$/.test(text)) {
+    return [`<span class="md-rule">${escapeHTML(text)}</span>`, ''];
+  }
+
+  let prefix = '';
+  let rest = text;
+  const block = rest.match(/^(\s*(?:>\s?)+)?(\s*(?:[-*+]|\d+[.)])\s(?:\[[ xX]\]\s)?)?/);
+  if (block && block[0]) {
+    if (block[1]) prefix += `<span class="md-quote">${escapeHTML(block[1])}</span>`;
+    if (block[2]) prefix += `<span class="md-marker">${escapeHTML(block[2])}</span>`;
+    rest = rest.slice(block[0].length);
+  }
+
+  let out = '';
+  let last = 0;
+  for (const m of rest.matchAll(inlineMarkdown)) {
+    out += escapeHTML(rest.slice(last, m.index));
+    const tok = m[0];
+    let cls = 'md-emphasis';
+    if (tok.startsWith('`')) cls = 'md-code';
+    else if (tok.startsWith('<')) cls = 'md-html';
+    else if (tok.startsWith('[') || tok.startsWith('!')) cls = 'md-link';
+    else if (tok.startsWith('**') || tok.startsWith('__')) cls = 'md-strong';
+    out += `<span class="${cls}">${escapeHTML(tok)}</span>`;
+    last = m.index + tok.length;
+  }
+  out += escapeHTML(rest.slice(last));
+  return [prefix + out, ''];
+}
+
+// Follow [[wikilinks]] inside the preview by opening the linked note in mdr
+async function handlePreviewClick(e) {
+  if (viewMode === 'split' && e.target && e.target.closest && !e.target.closest('a')) {
+    const block = e.target.closest('.mdr-block');
+    if (block) {
+      highlightSource(Number(block.dataset.sourceLine), Number(block.dataset.sourceEnd));
+    }
+  }
+  const link = e.target && e.target.closest ? e.target.closest('a.wikilink') : null;
+  if (!link || !currentPath) return;
+  e.preventDefault();
+  try {
+    const target = await ResolveLink(currentPath, link.getAttribute('href') || '');
+    await openPath(target);
+  } catch (err) {
+    console.error('Failed to follow link:', err);
+    setStatus('error', formatError(err));
+  }
+}
+
+async function openPath(path) {
+  if (!path) return;
+  currentPath = path;
+  pathEl.textContent = path;
+  await rerender();
+
+  try {
+    await AddRecentFile(path);
+    await loadRecentFiles();
+  } catch (err) {
+    console.error('Failed to update recent files:', err);
+  }
+
+  if (autoReloadEnabled && currentPath) {
+    try {
+      await StartWatchingFile(currentPath);
+    } catch (err) {
+      console.error('Failed to start watching file:', err);
+    }
+  }
+}
+
+async function loadBacklinks() {
+  if (!backlinksNavEl) return;
+  if (!currentPath) {
+    backlinksNavEl.innerHTML = '';
+    return;
+  }
+
+  let links = [];
+  try {
+    links = await GetBacklinks(currentPath) || [];
+  } catch (err) {
+    console.error('Failed to load backlinks:', err);
+  }
+
+  if (!links.length) {
+    backlinksNavEl.innerHTML = '<div class="toc-empty">No backlinks</div>';
+    return;
+  }
+
+  backlinksNavEl.innerHTML = '';
+  for (const link of links) {
+    const item = document.createElement('a');
+    item.href = '#';
+    item.className = 'toc-item backlink-item';
+    item.title = `${link.path}:${link.line}`;
+
+    const title = document.createElement('div');
+    title.className = 'backlink-title';
+    title.textContent = link.title;
+    const context = document.createElement('div');
+    context.className = 'backlink-context';
+    context.textContent = link.context;
+    item.appendChild(title);
+    item.appendChild(context);
+
+    item.addEventListener('click', (e) => {
+      e.preventDefault();
+      openPath(link.path);
+    });
+    backlinksNavEl.appendChild(item);
+  }
+}
+
 function renderTOC(toc) {
   currentTOC = toc || [];
 
@@ -503,6 +1281,10 @@ function renderTOC(toc) {
         console.error('Failed to scroll to section:', err);
       }
     });
+    item.addEventListener('contextmenu', (e) => {
+      e.preventDefault();
+      openCopyDialog(item.dataset.id);
+    });
   });
 }
 
@@ -592,17 +1374,20 @@ async function openAndRender() {
     if (!res || !res.path) {
       return;
     }
+    trackStream(res);
     currentPath = res.path;
-    pathEl.textContent = currentPath;
+    setDocumentTitle(res);
     
     // Update recent files
     await loadRecentFiles();
     
     requestAnimationFrame(() => {
-      setPreview(res.html, res.charCount, res.wordCount);
+      setPreview(res.html, res.charCount, res.wordCount, res.removed);
       renderTOC(res.toc);
       updateTOCTheme();
     });
+    loadBacklinks();
+    loadSource();
 
     // Start watching the file if auto-reload is enabled
     if (autoReloadEnabled && currentPath) {
@@ -622,13 +1407,27 @@ async function rerender() {
   if (!currentPath) {
     return;
   }
+  if (diffView && diffView.path === currentPath) {
+    await renderDiffView();
+    return;
+  }
+  setDiffView(null);
+  setChangedBlocks([]);
+  if (viewMode === 'slides') {
+    await renderSlidesView();
+    return;
+  }
   setStatus('info', '');
   try {
     const theme = themeEl.value;
     const palette = paletteEl.value;
     const res = await RenderFileWithPaletteAndTOC(currentPath, theme, palette);
+    trackStream(res);
+    setDocumentTitle(res);
+    loadBacklinks();
+    loadSource();
     requestAnimationFrame(() => {
-      setPreview(res.html, res.charCount, res.wordCount);
+      setPreview(res.html, res.charCount, res.wordCount, res.removed);
       renderTOC(res.toc);
       updateTOCTheme();
       
@@ -645,10 +1444,390 @@ async function rerender() {
   }
 }
 
+// Re-render after a file change, patching only the blocks that changed so scroll position
+// and already-rendered diagrams are kept. Falls back to a full reload when that's not possible.
+async function patchPreview() {
+  if (!currentPath) {
+    return;
+  }
+  try {
+    const res = await RenderFilePatch(currentPath, themeEl.value, paletteEl.value);
+    if (res.progressive) {
+      // Large files stream in again rather than being parsed and diffed in one go.
+      await rerender();
+      return;
+    }
+    loadBacklinks();
+    loadSource();
+    if (!res.full && !applyBlockPatch(res.blocks || [])) {
+      await rerender();
+      return;
+    }
+    setChangedBlocks(res.changed);
+    if (res.full) {
+      flashChangesOnLoad = true;
+      setPreview(res.html, res.charCount, res.wordCount, res.removed);
+    } else {
+      setDocumentStatus(res.charCount, res.wordCount, res.removed);
+      flashChangedBlocks(changedBlockIds);
+    }
+    if (changedBlockIds.length && !removedContent.length) {
+      const n = changedBlockIds.length;
+      setStatus('info', `${n} block${n === 1 ? '' : 's'} changed (] next, [ previous)`);
+    }
+    renderTOC(res.toc);
+    updateTOCTheme();
+    if (searchOpen && searchInputEl.value) {
+      setTimeout(() => {
+        performSearch(searchInputEl.value);
+      }, 100);
+    }
+  } catch (err) {
+    console.error(err);
+    setStatus('error', formatError(err));
+  }
+}
+
+// Remembers the blocks a reload added or modified, for jumping between them.
+function setChangedBlocks(changed) {
+  changedBlockIds = (changed || []).map(c => c.blockId);
+  changedIndex = -1;
+  nextChangeEl.hidden = changedBlockIds.length === 0;
+}
+
+// Briefly highlights blocks, restarting the animation of any still highlighted.
+function flashChangedBlocks(ids) {
+  const doc = previewEl.contentDocument;
+  if (!doc) return;
+  for (const id of ids) {
+    const el = doc.querySelector(`.mdr-block[data-block="${id}"]`);
+    if (!el) continue;
+    el.classList.remove('mdr-changed');
+    void el.offsetWidth;
+    el.classList.add('mdr-changed');
+  }
+}
+
+// Scrolls to the next (or previous) block changed by the last reload.
+function jumpToChange(step) {
+  if (!changedBlockIds.length) {
+    setStatus('info', 'No changes since the last reload');
+    return;
+  }
+  const n = changedBlockIds.length;
+  changedIndex = changedIndex < 0 && step < 0 ? n - 1 : (changedIndex + step + n) % n;
+  const id = changedBlockIds[changedIndex];
+  const doc = previewEl.contentDocument;
+  const block = doc && doc.querySelector(`.mdr-block[data-block="${id}"]`);
+  const target = block && (block.firstElementChild || block);
+  if (target) {
+    target.scrollIntoView({ behavior: 'smooth', block: 'center' });
+    flashChangedBlocks([id]);
+  }
+  setStatus('info', `Change ${changedIndex + 1} of ${n}`);
+}
+
+// Renders the document as a deck of slides, staying on the same slide when it reloads.
+async function renderSlidesView() {
+  let deck;
+  try {
+    deck = await RenderSlides(currentPath, themeEl.value, paletteEl.value);
+  } catch (err) {
+    console.error(err);
+    setStatus('error', formatError(err));
+    return;
+  }
+  if (viewMode !== 'slides') return;
+  if (!slideDeck || slideDeck.path !== deck.path) {
+    slideIndex = 0;
+  }
+  slideDeck = deck;
+  slideDeck.slides = deck.slides || [];
+  slideSplitEl.value = deck.split;
+  slideBarEl.hidden = false;
+  trackStream({});
+  setPreview(deck.html);
+  renderSlideList();
+  setStatus('info', `${slideDeck.slides.length} slides (← → to move, O overview, N notes, F fullscreen)`);
+}
+
+// Hooks the slide page up once it has loaded: keys pressed in it, and picking a slide in
+// the overview.
+function initSlideFrame() {
+  const doc = previewEl.contentDocument;
+  if (!doc) return;
+  doc.addEventListener('keydown', handleKeyboardShortcuts);
+  doc.addEventListener('click', (e) => {
+    const slide = slideOverview && e.target.closest ? e.target.closest('.mdr-slide') : null;
+    if (slide) {
+      slideOverview = false;
+      showSlide(Number(slide.dataset.slide));
+    }
+  });
+  showSlide(slideIndex);
+}
+
+function showSlide(index) {
+  if (!slideDeck || !slideDeck.slides.length) {
+    updateSlideUI();
+    return;
+  }
+  slideIndex = Math.max(0, Math.min(index, slideDeck.slides.length - 1));
+  const doc = previewEl.contentDocument;
+  if (doc && doc.body) {
+    doc.body.classList.toggle('mdr-overview', slideOverview);
+    let current = null;
+    for (const el of doc.querySelectorAll('.mdr-slide')) {
+      const isCurrent = Number(el.dataset.slide) === slideIndex;
+      el.classList.toggle('current', isCurrent);
+      if (isCurrent) current = el;
+    }
+    if (slideOverview && current) {
+      current.scrollIntoView({ block: 'nearest' });
+    } else if (previewEl.contentWindow) {
+      previewEl.contentWindow.scrollTo(0, 0);
+    }
+  }
+  updateSlideUI();
+}
+
+function updateSlideUI() {
+  const slides = slideDeck ? slideDeck.slides : [];
+  slideCounterEl.textContent = slides.length ? `${slideIndex + 1} / ${slides.length}` : '0 / 0';
+  slideOverviewEl.classList.toggle('active', slideOverview);
+  for (const item of tocNavEl.querySelectorAll('.slide-item')) {
+    item.classList.toggle('active', Number(item.dataset.slide) === slideIndex);
+  }
+  const slide = slides[slideIndex];
+  const next = slides[slideIndex + 1];
+  slideNotesHeaderEl.textContent = slide
+    ? `Slide ${slideIndex + 1} of ${slides.length}` + (next ? ` · Next: ${next.title || `slide ${slideIndex + 2}`}` : ' · Last slide')
+    : '';
+  slideNotesBodyEl.textContent = slide && slide.notes ? slide.notes : 'No notes for this slide.';
+}
+
+// Lists the slides in the sidebar in place of the Table of Contents.
+function renderSlideList() {
+  currentTOC = [];
+  const slides = slideDeck.slides;
+  if (!slides.length) {
+    tocNavEl.innerHTML = '<div class="toc-empty">No slides</div>';
+    return;
+  }
+  tocNavEl.innerHTML = slides.map((s, i) =>
+    `<a href="#" class="toc-item slide-item" data-slide="${i}">${i + 1}. ${escapeHTML(s.title || `Slide ${i + 1}`)}</a>`
+  ).join('');
+  tocNavEl.querySelectorAll('.slide-item').forEach(item => {
+    item.addEventListener('click', (e) => {
+      e.preventDefault();
+      slideOverview = false;
+      showSlide(Number(item.dataset.slide));
+    });
+  });
+}
+
+function toggleSlideOverview() {
+  slideOverview = !slideOverview;
+  showSlide(slideIndex);
+}
+
+function toggleSlideNotes() {
+  slideNotesEl.hidden = !slideNotesEl.hidden;
+  slideNotesToggleEl.classList.toggle('active', !slideNotesEl.hidden);
+}
+
+function toggleSlideFullscreen() {
+  const on = !shellEl.classList.contains('presenting');
+  shellEl.classList.toggle('presenting', on);
+  slideFullscreenEl.classList.toggle('active', on);
+  if (on) {
+    WindowFullscreen();
+  } else {
+    WindowUnfullscreen();
+  }
+}
+
+function leaveSlides() {
+  if (shellEl.classList.contains('presenting')) {
+    toggleSlideFullscreen();
+  }
+  slideDeck = null;
+  slideOverview = false;
+  slideBarEl.hidden = true;
+  slideNotesEl.hidden = true;
+  slideNotesToggleEl.classList.remove('active');
+}
+
+// Slide navigation keys; returns whether the key was handled.
+function handleSlideKey(e) {
+  if (e.metaKey || e.ctrlKey || e.altKey) return false;
+  switch (e.key) {
+    case 'ArrowRight':
+    case 'ArrowDown':
+    case 'PageDown':
+    case ' ':
+      showSlide(slideIndex + 1);
+      return true;
+    case 'ArrowLeft':
+    case 'ArrowUp':
+    case 'PageUp':
+    case 'Backspace':
+      showSlide(slideIndex - 1);
+      return true;
+    case 'Home':
+      showSlide(0);
+      return true;
+    case 'End':
+      showSlide(Number.MAX_SAFE_INTEGER);
+      return true;
+    case 'o':
+    case 'O':
+      toggleSlideOverview();
+      return true;
+    case 'n':
+    case 'N':
+      toggleSlideNotes();
+      return true;
+    case 'f':
+    case 'F':
+      toggleSlideFullscreen();
+      return true;
+    case 'Escape':
+      if (slideOverview) {
+        toggleSlideOverview();
+        return true;
+      }
+      if (shellEl.classList.contains('presenting')) {
+        toggleSlideFullscreen();
+        return true;
+      }
+      return false;
+  }
+  return false;
+}
+
+// Moves an unchanged block's source line annotations when lines above it were added or removed.
+function shiftSourceLines(el, delta) {
+  if (!delta) return;
+  el.dataset.sourceLine = Number(el.dataset.sourceLine) + delta;
+  for (const child of el.querySelectorAll('[data-source-line]')) {
+    child.dataset.sourceLine = Number(child.dataset.sourceLine) + delta;
+  }
+}
+
+function blockElement(doc, block) {
+  const el = doc.createElement('div');
+  el.className = 'mdr-block';
+  el.dataset.block = block.id;
+  el.dataset.sourceLine = block.line;
+  el.dataset.sourceEnd = block.endLine;
+  el.innerHTML = block.html;
+  return el;
+}
+
+// Remembers which render the preview shows, so only its render-chunk events are applied.
+function trackStream(res) {
+  currentStreamId = res.streamId || 0;
+  progressiveView = !!res.partial;
+  previewReady = false;
+}
+
+// Appends queued render-chunk blocks to the preview once it has loaded.
+function drainChunks() {
+  if (!previewReady) return;
+  const doc = previewEl.contentDocument;
+  const wrapper = doc && doc.getElementById('wrapper');
+  if (!wrapper) {
+    setTimeout(drainChunks, 50);
+    return;
+  }
+
+  let added = false;
+  while (chunkQueue.length) {
+    const chunk = chunkQueue[0];
+    if (chunk.streamId > currentStreamId) break; // belongs to a render that hasn't returned yet
+    chunkQueue.shift();
+    if (chunk.streamId < currentStreamId) continue;
+
+    if (chunk.error) {
+      setStatus('error', 'Failed to render the rest of the document: ' + chunk.error);
+      continue;
+    }
+    for (const b of chunk.blocks || []) {
+      wrapper.appendChild(blockElement(doc, b));
+      added = true;
+    }
+    if (chunk.toc && chunk.toc.length) {
+      renderTOC(currentTOC.concat(chunk.toc));
+      updateTOCTheme();
+    }
+    if (chunk.done) {
+      setDocumentStatus(chunk.charCount, chunk.wordCount, chunk.removed);
+      applyPendingGoto(true);
+      if (searchOpen && searchInputEl.value) {
+        performSearch(searchInputEl.value);
+      }
+    } else {
+      setStatus('info', 'Loading the rest of the document...');
+    }
+  }
+
+  if (added && typeof previewEl.contentWindow.mdrRenderMermaid === 'function') {
+    previewEl.contentWindow.mdrRenderMermaid();
+  }
+}
+
+// Reorders, inserts and removes .mdr-block elements in the preview to match blocks.
+// Returns false if the preview can't be patched (e.g. it is still loading).
+function applyBlockPatch(blocks) {
+  const doc = previewEl.contentDocument;
+  const wrapper = doc && doc.getElementById('wrapper');
+  if (!wrapper) return false;
+
+  const existing = new Map();
+  for (const el of wrapper.querySelectorAll(':scope > .mdr-block')) {
+    existing.set(el.dataset.block, el);
+  }
+  for (const b of blocks) {
+    if (!b.html && !existing.has(b.id)) return false;
+  }
+
+  let added = false;
+  let cursor = wrapper.firstChild;
+  for (const b of blocks) {
+    let el = existing.get(b.id);
+    if (el) {
+      existing.delete(b.id);
+      shiftSourceLines(el, b.line - Number(el.dataset.sourceLine));
+      el.dataset.sourceEnd = b.endLine;
+    } else {
+      el = blockElement(doc, b);
+      added = true;
+    }
+    if (el !== cursor) {
+      wrapper.insertBefore(el, cursor);
+    } else {
+      cursor = cursor.nextSibling;
+    }
+  }
+  for (const el of existing.values()) {
+    el.remove();
+  }
+
+  if (added && typeof previewEl.contentWindow.mdrRenderMermaid === 'function') {
+    previewEl.contentWindow.mdrRenderMermaid();
+  }
+  return true;
+}
+
 openEl.addEventListener('click', openAndRender);
 
 tocToggleEl.addEventListener('click', toggleTOC);
 
+viewModeEl.addEventListener('change', () => {
+  setViewMode(viewModeEl.value);
+});
+
 tocPinEl.addEventListener('click', (e) => {
   e.stopPropagation();
   togglePin();
@@ -755,6 +1934,129 @@ searchCloseEl.addEventListener('click', () => {
   closeSearch();
 });
 
+showRemovedEl.addEventListener('click', () => {
+  openRemovedDialog();
+});
+
+compareEl.addEventListener('click', () => {
+  openCompareDialog();
+});
+
+compareCloseEl.addEventListener('click', () => {
+  closeCompareDialog();
+});
+
+compareRevBtnEl.addEventListener('click', () => {
+  showDiff({ path: currentPath, rev: compareRevEl.value.trim() || 'HEAD' });
+});
+
+compareRevEl.addEventListener('keydown', (e) => {
+  if (e.key === 'Enter') {
+    e.preventDefault();
+    compareRevBtnEl.click();
+  } else if (e.key === 'Escape') {
+    e.preventDefault();
+    closeCompareDialog();
+  }
+});
+
+compareFileBtnEl.addEventListener('click', async () => {
+  try {
+    const oldPath = await ChooseMarkdownFile('Compare with');
+    if (oldPath) {
+      showDiff({ path: currentPath, oldPath });
+    }
+  } catch (err) {
+    setStatus('error', formatError(err));
+  }
+});
+
+exportEl.addEventListener('click', () => {
+  openExportDialog();
+});
+
+exportCloseEl.addEventListener('click', () => {
+  closeExportDialog();
+});
+
+pandocExportBtnEl.addEventListener('click', () => {
+  if (pandocFormatEl.value) {
+    exportDocument(`pandoc:${pandocFormatEl.value}`);
+  }
+});
+
+exportFormatsEl.addEventListener('click', (e) => {
+  const btn = e.target.closest('button[data-format]');
+  if (btn) {
+    exportDocument(btn.dataset.format);
+  }
+});
+
+copyCloseEl.addEventListener('click', () => {
+  closeCopyDialog();
+});
+
+copyFormatsEl.addEventListener('click', (e) => {
+  const btn = e.target.closest('button[data-format]');
+  if (btn) {
+    copySection(btn.dataset.format);
+  }
+});
+
+printEl.addEventListener('click', () => {
+  openPrintDialog();
+});
+
+printCloseEl.addEventListener('click', () => {
+  closePrintDialog();
+});
+
+printBtnEl.addEventListener('click', () => {
+  printDocument();
+});
+
+slidePrevEl.addEventListener('click', () => {
+  showSlide(slideIndex - 1);
+});
+
+slideNextEl.addEventListener('click', () => {
+  showSlide(slideIndex + 1);
+});
+
+slideOverviewEl.addEventListener('click', () => {
+  toggleSlideOverview();
+});
+
+slideNotesToggleEl.addEventListener('click', () => {
+  toggleSlideNotes();
+});
+
+slideFullscreenEl.addEventListener('click', () => {
+  toggleSlideFullscreen();
+});
+
+slideSplitEl.addEventListener('change', async () => {
+  try {
+    await SetSlideSplit(slideSplitEl.value);
+  } catch (err) {
+    console.error('Failed to save slide split:', err);
+  }
+  slideIndex = 0;
+  rerender();
+});
+
+nextChangeEl.addEventListener('click', () => {
+  jumpToChange(1);
+});
+
+closeDiffEl.addEventListener('click', () => {
+  closeDiffView();
+});
+
+removedCloseEl.addEventListener('click', () => {
+  closeRemovedDialog();
+});
+
 searchCaseSensitiveEl.addEventListener('change', async () => {
   // Save the case sensitivity setting
   try {
@@ -774,15 +2076,18 @@ recentFilesEl.addEventListener('change', async () => {
     const theme = themeEl.value;
     const palette = paletteEl.value;
     const res = await RenderFileWithPaletteAndTOC(path, theme, palette);
+    trackStream(res);
 
     currentPath = path;
-    pathEl.textContent = path;
+    setDocumentTitle(res);
 
     requestAnimationFrame(() => {
-      setPreview(res.html, res.charCount, res.wordCount);
+      setPreview(res.html, res.charCount, res.wordCount, res.removed);
       renderTOC(res.toc);
       updateTOCTheme();
     });
+    loadBacklinks();
+    loadSource();
 
     // Update recent files (move to top, refresh dropdown)
     await AddRecentFile(path);
@@ -815,6 +2120,20 @@ recentFilesEl.addEventListener('blur', () => {
   recentFilesEl.value = '';
 });
 
+// themeTooltip describes a theme for its menu entry: who made it, what it provides, and what
+// is wrong with its manifest.
+function themeTooltip(t) {
+  if (t.problems.length) return `Invalid theme package:\n${t.problems.join('\n')}`;
+  const lines = [];
+  if (t.description) lines.push(t.description);
+  if (t.author) lines.push(`By ${t.author}${t.version ? ` (v${t.version})` : ''}`);
+  if (t.variants.length) lines.push(`Variants: ${t.variants.join(', ')}`);
+  if (t.fonts.length) lines.push(`Fonts: ${t.fonts.join(', ')}`);
+  if (t.mermaid) lines.push(`Mermaid theme: ${t.mermaid}`);
+  if (t.syntax) lines.push(`Syntax scheme: ${t.syntax}`);
+  return lines.join('\n');
+}
+
 async function renderInitialArgs() {
   try {
     setControlsEnabled(false);
@@ -824,8 +2143,11 @@ async function renderInitialArgs() {
         themeEl.innerHTML = '';
         for (const t of themes) {
           const opt = document.createElement('option');
-          opt.value = t;
-          opt.textContent = t;
+          opt.value = t.id;
+          opt.textContent = t.name;
+          opt.title = themeTooltip(t);
+          // A package whose manifest has problems can't be applied; the tooltip says why.
+          opt.disabled = t.problems.length > 0;
           themeEl.appendChild(opt);
         }
       }
@@ -919,6 +2241,10 @@ async function renderInitialArgs() {
     }
     currentPath = args[0];
     pathEl.textContent = currentPath;
+    const target = await GetLaunchGoto();
+    if (target && target.line && target.path === currentPath) {
+      pendingGotoLine = target.line;
+    }
 
     setTimeout(async () => {
       await rerender();
@@ -973,18 +2299,18 @@ async function cyclePalette() {
 }
 
 async function cycleTheme() {
-    const themes = await ListThemes();
-    if (!themes || themes.length === 0) return;
+    const themes = (await ListThemes() || []).filter((t) => t.problems.length === 0);
+    if (themes.length === 0) return;
 
-    const currentIndex = themes.indexOf(themeEl.value);
+    const currentIndex = themes.findIndex((t) => t.id === themeEl.value);
     const nextIndex = (currentIndex + 1) % themes.length;
     const nextTheme = themes[nextIndex];
 
-    themeEl.value = nextTheme;
+    themeEl.value = nextTheme.id;
     try {
-        await SetTheme(nextTheme);
+        await SetTheme(nextTheme.id);
         await rerender();
-        setStatus('info', `Theme: ${nextTheme} (${modifierKey === 'metaKey' ? 'Cmd' : 'Ctrl'}+Shift+T)`);
+        setStatus('info', `Theme: ${nextTheme.name} (${modifierKey === 'metaKey' ? 'Cmd' : 'Ctrl'}+Shift+T)`);
     } catch (err) {
         console.error(err);
     }
@@ -1008,6 +2334,11 @@ function handleKeyboardShortcuts(e) {
         e.target.blur();
     }
 
+    if (viewMode === 'slides' && handleSlideKey(e)) {
+        e.preventDefault();
+        return;
+    }
+
     // Search functionality
     if (e.key === '/' && !e[modifierKey] && !e.shiftKey && !e.ctrlKey && !e.altKey) {
         e.preventDefault();
@@ -1025,6 +2356,46 @@ function handleKeyboardShortcuts(e) {
             navigateSearch('next');
         }
     }
+    else if (e.key === 'Escape' && !removedDialogEl.hidden) {
+        e.preventDefault();
+        closeRemovedDialog();
+    }
+    else if (e.key === 'Escape' && !compareDialogEl.hidden) {
+        e.preventDefault();
+        closeCompareDialog();
+    }
+    else if (e.key === 'Escape' && !exportDialogEl.hidden) {
+        e.preventDefault();
+        closeExportDialog();
+    }
+    else if (e.key === 'Escape' && !copyDialogEl.hidden) {
+        e.preventDefault();
+        closeCopyDialog();
+    }
+    else if (e.key === 'Escape' && !printDialogEl.hidden) {
+        e.preventDefault();
+        closePrintDialog();
+    }
+    else if (e.key === 'Escape' && diffView) {
+        e.preventDefault();
+        closeDiffView();
+    }
+    else if ((e.key === ']' || e.key === '[') && !e[modifierKey] && !e.ctrlKey && !e.altKey) {
+        e.preventDefault();
+        jumpToChange(e.key === ']' ? 1 : -1);
+    }
+    else if ((e.key === 'd' || e.key === 'D') && e[modifierKey] && e.shiftKey) {
+        e.preventDefault();
+        openCompareDialog();
+    }
+    else if ((e.key === 'c' || e.key === 'C') && e[modifierKey] && e.shiftKey) {
+        e.preventDefault();
+        openCopyDialog();
+    }
+    else if ((e.key === 'p' || e.key === 'P') && e[modifierKey] && e.shiftKey) {
+        e.preventDefault();
+        openPrintDialog();
+    }
     else if (e.key === 'Escape' && searchOpen) {
         e.preventDefault();
         closeSearch();
@@ -1044,6 +2415,10 @@ function handleKeyboardShortcuts(e) {
     }
 
     // View controls
+    else if (e.key === 'u' && e[modifierKey]) {
+        e.preventDefault();
+        cycleViewMode();
+    }
     else if (e.key === 't' && e[modifierKey] && !e.shiftKey) {
         e.preventDefault();
         toggleTOC();
@@ -1131,14 +2506,36 @@ EventsOn('file-open', async (paths) => {
   }
 });
 
+// An editor asked to show a source line (mdr --goto file.md:120, or the IPC socket)
+EventsOn('goto-line', async (req) => {
+  if (!req || !req.path) return;
+  if (req.path !== currentPath) {
+    pendingGotoLine = req.line;
+    await openPath(req.path);
+    return;
+  }
+  gotoSourceLine(req.line);
+});
+
 // Listen for file change events from the backend
 EventsOn('file-changed', async (path) => {
   if (autoReloadEnabled && path === currentPath) {
     setStatus('info', 'File changed, reloading...');
-    await rerender();
+    if (progressiveView || diffView || viewMode === 'slides') {
+      await rerender();
+    } else {
+      await patchPreview();
+    }
   }
 });
 
+// Remaining sections of a large document rendered progressively
+EventsOn('render-chunk', (chunk) => {
+  if (!chunk) return;
+  chunkQueue.push(chunk);
+  drainChunks();
+});
+
 // Listen for theme change events from the backend
 EventsOn('theme-changed', async (themeName) => {
   if (autoReloadEnabled) {
@@ -4,26 +4,50 @@ import {main} from '../models';
 
 export function AddRecentFile(arg1:string):Promise<void>;
 
+export function ChooseMarkdownFile(arg1:string):Promise<string>;
+
 export function ClearRecentFiles():Promise<void>;
 
 export function ClearSearch():Promise<void>;
 
+export function CopySection(arg1:string,arg2:string,arg3:string):Promise<main.ClipboardContent>;
+
+export function ExportDOCX(arg1:string):Promise<string>;
+
+export function ExportEPUB(arg1:string,arg2:string):Promise<string>;
+
+export function ExportWithPandoc(arg1:string,arg2:string,arg3:string):Promise<string>;
+
 export function GetAutoReload():Promise<boolean>;
 
+export function GetBacklinks(arg1:string):Promise<Array<main.Backlink>>;
+
 export function GetFontScale():Promise<number>;
 
 export function GetLaunchArgs():Promise<Array<string>>;
 
+export function GetLaunchGoto():Promise<main.GotoRequest>;
+
 export function GetPalette():Promise<string>;
 
+export function GetPandocFormats():Promise<Array<string>>;
+
 export function GetRecentFiles():Promise<Array<main.RecentFile>>;
 
+export function GetRemovedContent():Promise<Array<main.SanitizedBlock>>;
+
+export function GetRenderCacheStats():Promise<main.RenderCacheStats>;
+
 export function GetSearchCaseSensitive():Promise<boolean>;
 
 export function GetSearchHighlightColor():Promise<string>;
 
 export function GetSearchState():Promise<main.SearchResult>;
 
+export function GetSlideSplit():Promise<string>;
+
+export function GetSource(arg1:string):Promise<main.SourceDocument>;
+
 export function GetTOCPinned():Promise<boolean>;
 
 export function GetTOCVisible():Promise<boolean>;
@@ -32,22 +56,34 @@ export function GetTheme():Promise<string>;
 
 export function Greet(arg1:string):Promise<string>;
 
-export function ListThemes():Promise<Array<string>>;
+export function ListThemes():Promise<Array<main.ThemeInfo>>;
 
 export function NavigateSearch(arg1:string):Promise<main.SearchResult>;
 
 export function OpenAndRender(arg1:string,arg2:string):Promise<main.RenderResult>;
 
+export function RenderDiff(arg1:string,arg2:string):Promise<main.DiffResult>;
+
 export function RenderFile(arg1:string,arg2:string):Promise<string>;
 
+export function RenderFilePatch(arg1:string,arg2:string,arg3:string):Promise<main.RenderPatch>;
+
 export function RenderFileWithPalette(arg1:string,arg2:string,arg3:string):Promise<string>;
 
 export function RenderFileWithPaletteAndTOC(arg1:string,arg2:string,arg3:string):Promise<main.RenderResult>;
 
+export function RenderGitDiff(arg1:string,arg2:string):Promise<main.DiffResult>;
+
 export function RenderMarkdown(arg1:string,arg2:string):Promise<string>;
 
 export function RenderMarkdownWithPalette(arg1:string,arg2:string,arg3:string):Promise<string>;
 
+export function RenderPrint(arg1:string,arg2:string,arg3:main.PrintOptions):Promise<string>;
+
+export function RenderSlides(arg1:string,arg2:string,arg3:string):Promise<main.SlideDeck>;
+
+export function ResolveLink(arg1:string,arg2:string):Promise<string>;
+
 export function SearchDocument(arg1:string,arg2:boolean):Promise<main.SearchResult>;
 
 export function SetAutoReload(arg1:boolean):Promise<void>;
@@ -62,6 +98,8 @@ export function SetSearchCaseSensitive(arg1:boolean):Promise<void>;
 
 export function SetSearchHighlightColor(arg1:string):Promise<void>;
 
+export function SetSlideSplit(arg1:string):Promise<void>;
+
 export function SetTOCPinned(arg1:boolean):Promise<void>;
 
 export function SetTOCVisible(arg1:boolean):Promise<void>;
@@ -6,6 +6,10 @@ export function AddRecentFile(arg1) {
   return window['go']['main']['App']['AddRecentFile'](arg1);
 }
 
+export function ChooseMarkdownFile(arg1) {
+  return window['go']['main']['App']['ChooseMarkdownFile'](arg1);
+}
+
 export function ClearRecentFiles() {
   return window['go']['main']['App']['ClearRecentFiles']();
 }
@@ -14,10 +18,30 @@ export function ClearSearch() {
   return window['go']['main']['App']['ClearSearch']();
 }
 
+export function CopySection(arg1, arg2, arg3) {
+  return window['go']['main']['App']['CopySection'](arg1, arg2, arg3);
+}
+
+export function ExportDOCX(arg1) {
+  return window['go']['main']['App']['ExportDOCX'](arg1);
+}
+
+export function ExportEPUB(arg1, arg2) {
+  return window['go']['main']['App']['ExportEPUB'](arg1, arg2);
+}
+
+export function ExportWithPandoc(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ExportWithPandoc'](arg1, arg2, arg3);
+}
+
 export function GetAutoReload() {
   return window['go']['main']['App']['GetAutoReload']();
 }
 
+export function GetBacklinks(arg1) {
+  return window['go']['main']['App']['GetBacklinks'](arg1);
+}
+
 export function GetFontScale() {
   return window['go']['main']['App']['GetFontScale']();
 }
@@ -26,14 +50,30 @@ export function GetLaunchArgs() {
   return window['go']['main']['App']['GetLaunchArgs']();
 }
 
+export function GetLaunchGoto() {
+  return window['go']['main']['App']['GetLaunchGoto']();
+}
+
 export function GetPalette() {
   return window['go']['main']['App']['GetPalette']();
 }
 
+export function GetPandocFormats() {
+  return window['go']['main']['App']['GetPandocFormats']();
+}
+
 export function GetRecentFiles() {
   return window['go']['main']['App']['GetRecentFiles']();
 }
 
+export function GetRemovedContent() {
+  return window['go']['main']['App']['GetRemovedContent']();
+}
+
+export function GetRenderCacheStats() {
+  return window['go']['main']['App']['GetRenderCacheStats']();
+}
+
 export function GetSearchCaseSensitive() {
   return window['go']['main']['App']['GetSearchCaseSensitive']();
 }
@@ -46,6 +86,14 @@ export function GetSearchState() {
   return window['go']['main']['App']['GetSearchState']();
 }
 
+export function GetSlideSplit() {
+  return window['go']['main']['App']['GetSlideSplit']();
+}
+
+export function GetSource(arg1) {
+  return window['go']['main']['App']['GetSource'](arg1);
+}
+
 export function GetTOCPinned() {
   return window['go']['main']['App']['GetTOCPinned']();
 }
@@ -74,10 +122,18 @@ export function OpenAndRender(arg1, arg2) {
   return window['go']['main']['App']['OpenAndRender'](arg1, arg2);
 }
 
+export function RenderDiff(arg1, arg2) {
+  return window['go']['main']['App']['RenderDiff'](arg1, arg2);
+}
+
 export function RenderFile(arg1, arg2) {
   return window['go']['main']['App']['RenderFile'](arg1, arg2);
 }
 
+export function RenderFilePatch(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RenderFilePatch'](arg1, arg2, arg3);
+}
+
 export function RenderFileWithPalette(arg1, arg2, arg3) {
   return window['go']['main']['App']['RenderFileWithPalette'](arg1, arg2, arg3);
 }
@@ -86,6 +142,10 @@ export function RenderFileWithPaletteAndTOC(arg1, arg2, arg3) {
   return window['go']['main']['App']['RenderFileWithPaletteAndTOC'](arg1, arg2, arg3);
 }
 
+export function RenderGitDiff(arg1, arg2) {
+  return window['go']['main']['App']['RenderGitDiff'](arg1, arg2);
+}
+
 export function RenderMarkdown(arg1, arg2) {
   return window['go']['main']['App']['RenderMarkdown'](arg1, arg2);
 }
@@ -94,6 +154,18 @@ export function RenderMarkdownWithPalette(arg1, arg2, arg3) {
   return window['go']['main']['App']['RenderMarkdownWithPalette'](arg1, arg2, arg3);
 }
 
+export function RenderPrint(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RenderPrint'](arg1, arg2, arg3);
+}
+
+export function RenderSlides(arg1, arg2, arg3) {
+  return window['go']['main']['App']['RenderSlides'](arg1, arg2, arg3);
+}
+
+export function ResolveLink(arg1, arg2) {
+  return window['go']['main']['App']['ResolveLink'](arg1, arg2);
+}
+
 export function SearchDocument(arg1, arg2) {
   return window['go']['main']['App']['SearchDocument'](arg1, arg2);
 }
@@ -122,6 +194,10 @@ export function SetSearchHighlightColor(arg1) {
   return window['go']['main']['App']['SetSearchHighlightColor'](arg1);
 }
 
+export function SetSlideSplit(arg1) {
+  return window['go']['main']['App']['SetSlideSplit'](arg1);
+}
+
 export function SetTOCPinned(arg1) {
   return window['go']['main']['App']['SetTOCPinned'](arg1);
 }
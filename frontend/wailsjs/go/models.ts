@@ -52,6 +52,12 @@ export namespace main {
 	    toc: TOCItem[];
 	    charCount: number;
 	    wordCount: number;
+	    includes: string[];
+	    partial: boolean;
+	    streamId: number;
+	    removed: RemovedContent[];
+	    title?: string;
+	    readOnly?: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new RenderResult(source);
@@ -64,6 +70,12 @@ export namespace main {
 	        this.toc = this.convertValues(source["toc"], TOCItem);
 	        this.charCount = source["charCount"];
 	        this.wordCount = source["wordCount"];
+	        this.includes = source["includes"];
+	        this.partial = source["partial"];
+	        this.streamId = source["streamId"];
+	        this.removed = this.convertValues(source["removed"], RemovedContent);
+	        this.title = source["title"];
+	        this.readOnly = source["readOnly"];
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -142,6 +154,410 @@ export namespace main {
 		    return a;
 		}
 	}
+	export class Backlink {
+	    path: string;
+	    title: string;
+	    line: number;
+	    context: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Backlink(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.title = source["title"];
+	        this.line = source["line"];
+	        this.context = source["context"];
+	    }
+	}
+	export class RenderCacheStats {
+	    hits: number;
+	    misses: number;
+	    entries: number;
+	    capacity: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RenderCacheStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.hits = source["hits"];
+	        this.misses = source["misses"];
+	        this.entries = source["entries"];
+	        this.capacity = source["capacity"];
+	    }
+	}
+	export class RenderedBlock {
+	    id: string;
+	    html: string;
+	    line: number;
+	    endLine: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RenderedBlock(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.html = source["html"];
+	        this.line = source["line"];
+	        this.endLine = source["endLine"];
+	    }
+	}
+	export class RenderPatch {
+	    path: string;
+	    full: boolean;
+	    html: string;
+	    blocks: RenderedBlock[];
+	    toc: TOCItem[];
+	    charCount: number;
+	    wordCount: number;
+	    includes: string[];
+	    removed: RemovedContent[];
+	    changed: ChangedBlock[];
+	    progressive: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new RenderPatch(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.full = source["full"];
+	        this.html = source["html"];
+	        this.blocks = this.convertValues(source["blocks"], RenderedBlock);
+	        this.toc = this.convertValues(source["toc"], TOCItem);
+	        this.charCount = source["charCount"];
+	        this.wordCount = source["wordCount"];
+	        this.includes = source["includes"];
+	        this.removed = this.convertValues(source["removed"], RemovedContent);
+	        this.changed = this.convertValues(source["changed"], ChangedBlock);
+	        this.progressive = source["progressive"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class RenderChunk {
+	    streamId: number;
+	    path: string;
+	    blocks: RenderedBlock[];
+	    toc: TOCItem[];
+	    done: boolean;
+	    charCount: number;
+	    wordCount: number;
+	    error: string;
+	    removed: RemovedContent[];
+	
+	    static createFrom(source: any = {}) {
+	        return new RenderChunk(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.streamId = source["streamId"];
+	        this.path = source["path"];
+	        this.blocks = this.convertValues(source["blocks"], RenderedBlock);
+	        this.toc = this.convertValues(source["toc"], TOCItem);
+	        this.done = source["done"];
+	        this.charCount = source["charCount"];
+	        this.wordCount = source["wordCount"];
+	        this.error = source["error"];
+	        this.removed = this.convertValues(source["removed"], RemovedContent);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class RemovedContent {
+	    kind: string;
+	    name: string;
+	    label: string;
+	    count: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new RemovedContent(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.name = source["name"];
+	        this.label = source["label"];
+	        this.count = source["count"];
+	    }
+	}
+	export class SanitizedBlock {
+	    blockId: string;
+	    before: string;
+	    after: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SanitizedBlock(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.blockId = source["blockId"];
+	        this.before = source["before"];
+	        this.after = source["after"];
+	    }
+	}
+	export class SourceDocument {
+	    path: string;
+	    markdown: string;
+	    fileLines: number[];
+	    includes: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SourceDocument(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.markdown = source["markdown"];
+	        this.fileLines = source["fileLines"];
+	        this.includes = source["includes"];
+	    }
+	}
+	export class GotoRequest {
+	    path: string;
+	    line: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new GotoRequest(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.line = source["line"];
+	    }
+	}
+	export class DiffChange {
+	    kind: string;
+	    id: string;
+	    oldLine: number;
+	    newLine: number;
+	    text: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new DiffChange(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.id = source["id"];
+	        this.oldLine = source["oldLine"];
+	        this.newLine = source["newLine"];
+	        this.text = source["text"];
+	    }
+	}
+	export class DiffResult {
+	    oldPath: string;
+	    newPath: string;
+	    oldTitle: string;
+	    newTitle: string;
+	    html: string;
+	    changes: DiffChange[];
+	
+	    static createFrom(source: any = {}) {
+	        return new DiffResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.oldPath = source["oldPath"];
+	        this.newPath = source["newPath"];
+	        this.oldTitle = source["oldTitle"];
+	        this.newTitle = source["newTitle"];
+	        this.html = source["html"];
+	        this.changes = this.convertValues(source["changes"], DiffChange);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ChangedBlock {
+	    blockId: string;
+	    kind: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ChangedBlock(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.blockId = source["blockId"];
+	        this.kind = source["kind"];
+	    }
+	}
+	export class Slide {
+	    title: string;
+	    line: number;
+	    notes: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new Slide(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.title = source["title"];
+	        this.line = source["line"];
+	        this.notes = source["notes"];
+	    }
+	}
+	export class SlideDeck {
+	    path: string;
+	    html: string;
+	    split: string;
+	    slides: Slide[];
+	
+	    static createFrom(source: any = {}) {
+	        return new SlideDeck(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.html = source["html"];
+	        this.split = source["split"];
+	        this.slides = this.convertValues(source["slides"], Slide);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class PrintOptions {
+	    linkURLs: boolean;
+	    fontScale: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new PrintOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.linkURLs = source["linkURLs"];
+	        this.fontScale = source["fontScale"];
+	    }
+	}
+	export class ClipboardContent {
+	    format: string;
+	    html: string;
+	    text: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ClipboardContent(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.format = source["format"];
+	        this.html = source["html"];
+	        this.text = source["text"];
+	    }
+	}
+	export class ThemeInfo {
+	    id: string;
+	    name: string;
+	    author: string;
+	    description: string;
+	    version: string;
+	    package: boolean;
+	    variants: string[];
+	    fonts: string[];
+	    mermaid: string;
+	    syntax: string;
+	    problems: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new ThemeInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.name = source["name"];
+	        this.author = source["author"];
+	        this.description = source["description"];
+	        this.version = source["version"];
+	        this.package = source["package"];
+	        this.variants = source["variants"];
+	        this.fonts = source["fonts"];
+	        this.mermaid = source["mermaid"];
+	        this.syntax = source["syntax"];
+	        this.problems = source["problems"];
+	    }
+	}
 
 }
 
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// repoBaseURLKey carries the repository web URL (e.g. https://github.com/owner/repo) into the parser.
+var repoBaseURLKey = parser.NewContextKey()
+
+var (
+	issueRefPattern  = regexp.MustCompile(`#[0-9]+\b`)
+	mentionPattern   = regexp.MustCompile(`@[A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38}\b`)
+	commitSHAPattern = regexp.MustCompile(`\b[0-9a-f]{7,40}\b`)
+	hexLetterPattern = regexp.MustCompile(`[a-f]`)
+	hexDigitPattern  = regexp.MustCompile(`[0-9]`)
+)
+
+// repoBaseURLForPath returns the configured repository URL, or one derived from the
+// `origin` remote of the git repository enclosing docPath. It returns "" if neither exists.
+func repoBaseURLForPath(docPath string) string {
+	if configured := getRepoBaseURLFromConfig(); configured != "" {
+		return configured
+	}
+	if docPath == "" {
+		return ""
+	}
+	gitDir := findGitDir(filepath.Dir(docPath))
+	if gitDir == "" {
+		return ""
+	}
+	return remoteWebURL(readOriginURL(filepath.Join(gitDir, "config")))
+}
+
+// findGitDir walks up from dir looking for a `.git` directory (or a `.git` file pointing at one,
+// as used by worktrees and submodules).
+func findGitDir(dir string) string {
+	for {
+		candidate := filepath.Join(dir, ".git")
+		if info, err := os.Stat(candidate); err == nil {
+			if info.IsDir() {
+				return candidate
+			}
+			if b, err := os.ReadFile(candidate); err == nil {
+				if gitdir, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir:"); ok {
+					gitdir = strings.TrimSpace(gitdir)
+					if !filepath.IsAbs(gitdir) {
+						gitdir = filepath.Join(dir, gitdir)
+					}
+					// Worktrees keep their config in the common dir.
+					if common, err := os.ReadFile(filepath.Join(gitdir, "commondir")); err == nil {
+						c := strings.TrimSpace(string(common))
+						if !filepath.IsAbs(c) {
+							c = filepath.Join(gitdir, c)
+						}
+						return filepath.Clean(c)
+					}
+					return filepath.Clean(gitdir)
+				}
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readOriginURL extracts `url` from the `[remote "origin"]` section of a git config file.
+func readOriginURL(configFile string) string {
+	f, err := os.Open(configFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	inOrigin := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			inOrigin = strings.ReplaceAll(line, " ", "") == `[remote"origin"]`
+			continue
+		}
+		if !inOrigin {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(k) == "url" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// remoteWebURL converts a git remote (https, ssh or scp-style) into the repository's web URL.
+func remoteWebURL(remote string) string {
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		return ""
+	}
+
+	var host, repoPath string
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		host = u.Hostname()
+		repoPath = u.Path
+	} else if at, rest, ok := strings.Cut(remote, ":"); ok && !strings.Contains(at, "/") {
+		// scp-style: git@github.com:owner/repo.git
+		if _, h, ok := strings.Cut(at, "@"); ok {
+			at = h
+		}
+		host = at
+		repoPath = rest
+	} else {
+		return ""
+	}
+
+	repoPath = strings.Trim(strings.TrimSuffix(repoPath, ".git"), "/")
+	if host == "" || repoPath == "" {
+		return ""
+	}
+	return "https://" + host + "/" + repoPath
+}
+
+type repoRefTransformer struct{}
+
+// Transform turns issue refs, @mentions and commit SHAs in plain text into links on the
+// repository's host. It does nothing unless a base URL was placed in the parser context.
+func (t *repoRefTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	base, _ := pc.Get(repoBaseURLKey).(string)
+	if base == "" {
+		return
+	}
+	hostRoot := base
+	if u, err := url.Parse(base); err == nil {
+		hostRoot = u.Scheme + "://" + u.Host
+	}
+	source := reader.Source()
+
+	var texts []*ast.Text
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindLink, ast.KindAutoLink, ast.KindCodeSpan, ast.KindCodeBlock, ast.KindFencedCodeBlock, ast.KindHTMLBlock, ast.KindRawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		if tn, ok := n.(*ast.Text); ok {
+			texts = append(texts, tn)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, tn := range texts {
+		linkifyRepoRefs(tn, source, base, hostRoot)
+	}
+}
+
+type repoRef struct {
+	start, stop int
+	dest        string
+	label       string
+	class       string
+}
+
+// findRepoRefs returns non-overlapping references in seg, in source order.
+func findRepoRefs(source []byte, seg text.Segment, base, hostRoot string) []repoRef {
+	value := seg.Value(source)
+	var refs []repoRef
+	precededByWord := func(i int) bool {
+		abs := seg.Start + i
+		if abs == 0 {
+			return false
+		}
+		c := source[abs-1]
+		return util.IsAlphaNumeric(c) || c == '_' || c == '/' || c == '&' || c == '@' || c == '#'
+	}
+
+	for _, m := range issueRefPattern.FindAllIndex(value, -1) {
+		if precededByWord(m[0]) {
+			continue
+		}
+		num := string(value[m[0]+1 : m[1]])
+		refs = append(refs, repoRef{m[0], m[1], base + "/issues/" + num, "#" + num, "issue-link"})
+	}
+	for _, m := range mentionPattern.FindAllIndex(value, -1) {
+		if precededByWord(m[0]) {
+			continue
+		}
+		user := string(value[m[0]+1 : m[1]])
+		refs = append(refs, repoRef{m[0], m[1], hostRoot + "/" + user, "@" + user, "user-mention"})
+	}
+	for _, m := range commitSHAPattern.FindAllIndex(value, -1) {
+		sha := value[m[0]:m[1]]
+		if !hexLetterPattern.Match(sha) || !hexDigitPattern.Match(sha) || precededByWord(m[0]) {
+			continue
+		}
+		refs = append(refs, repoRef{m[0], m[1], base + "/commit/" + string(sha), string(sha[:7]), "commit-link"})
+	}
+
+	// Keep the earliest match when patterns overlap.
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].start < refs[j].start })
+	var out []repoRef
+	last := -1
+	for _, r := range refs {
+		if r.start < last {
+			continue
+		}
+		out = append(out, r)
+		last = r.stop
+	}
+	return out
+}
+
+// linkifyRepoRefs splits tn around every reference it contains, replacing each with a link.
+func linkifyRepoRefs(tn *ast.Text, source []byte, base, hostRoot string) {
+	refs := findRepoRefs(source, tn.Segment, base, hostRoot)
+	if len(refs) == 0 {
+		return
+	}
+	parent := tn.Parent()
+	seg := tn.Segment
+	pos := 0
+	var insertAfter ast.Node = tn
+	for _, r := range refs {
+		if r.start > pos {
+			before := ast.NewTextSegment(text.NewSegment(seg.Start+pos, seg.Start+r.start))
+			parent.InsertAfter(parent, insertAfter, before)
+			insertAfter = before
+		}
+		link := ast.NewLink()
+		link.Destination = []byte(r.dest)
+		link.SetAttributeString("class", []byte(r.class))
+		link.AppendChild(link, ast.NewString([]byte(r.label)))
+		parent.InsertAfter(parent, insertAfter, link)
+		insertAfter = link
+		pos = r.stop
+	}
+	if pos < seg.Len() {
+		rest := ast.NewTextSegment(text.NewSegment(seg.Start+pos, seg.Stop))
+		rest.SetSoftLineBreak(tn.SoftLineBreak())
+		rest.SetHardLineBreak(tn.HardLineBreak())
+		parent.InsertAfter(parent, insertAfter, rest)
+	} else if tn.SoftLineBreak() || tn.HardLineBreak() {
+		br := ast.NewTextSegment(text.NewSegment(seg.Stop, seg.Stop))
+		br.SetSoftLineBreak(tn.SoftLineBreak())
+		br.SetHardLineBreak(tn.HardLineBreak())
+		parent.InsertAfter(parent, insertAfter, br)
+	}
+	parent.RemoveChild(parent, tn)
+}
+
+type repoRefExtension struct{}
+
+// repoRefs links GitHub-style `#123`, `@user` and commit SHAs when a repository URL is known.
+var repoRefs = &repoRefExtension{}
+
+// Extend implements goldmark.Extender.
+func (e *repoRefExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&repoRefTransformer{}, 600),
+	))
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// ipcDialTimeout bounds how long a client waits for a running mdr to answer.
+const ipcDialTimeout = 2 * time.Second
+
+// ipcSocketPath is the Unix socket a running mdr listens on for commands from editors and
+// from later `mdr` invocations. MDR_SOCKET overrides it.
+func ipcSocketPath() (string, error) {
+	if p := strings.TrimSpace(os.Getenv("MDR_SOCKET")); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "mdr", "mdr.sock"), nil
+}
+
+// ipcRequest is one command, sent as a line of JSON such as
+// {"command":"goto","path":"/notes/todo.md","line":120} or
+// {"command":"open","paths":["/notes/todo.md"]}. An open of "stdin:" carries the piped
+// text in Stdin and the directory it was piped in from in Dir.
+type ipcRequest struct {
+	Command string   `json:"command"`
+	Path    string   `json:"path,omitempty"`
+	Line    int      `json:"line,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Stdin   string   `json:"stdin,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+}
+
+// ipcResponse answers each request with a line of JSON.
+type ipcResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// GotoRequest asks the preview to show path scrolled to the block holding a source line.
+// Requests carry the file's line; the frontend receives the matching data-source-line,
+// which differs only when the document includes others.
+type GotoRequest struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+}
+
+// parseGotoTarget parses the `file.md:120` argument of --goto.
+func parseGotoTarget(arg string) (GotoRequest, error) {
+	i := strings.LastIndex(arg, ":")
+	if i <= 0 {
+		return GotoRequest{}, fmt.Errorf("--goto expects file:line, got %q", arg)
+	}
+	line, err := strconv.Atoi(arg[i+1:])
+	if err != nil || line < 1 {
+		return GotoRequest{}, fmt.Errorf("--goto expects file:line, got %q", arg)
+	}
+	path := normalizePath(arg[:i])
+	if path == "" {
+		return GotoRequest{}, fmt.Errorf("--goto expects file:line, got %q", arg)
+	}
+	return GotoRequest{Path: path, Line: line}, nil
+}
+
+// flagValue reads the value of a `--name value` or `--name=value` flag at args[*i], advancing
+// *i past a separate value. ok is false when args[*i] is not that flag.
+func flagValue(args []string, i *int, name string) (string, bool) {
+	raw := args[*i]
+	if value, found := strings.CutPrefix(raw, name+"="); found {
+		return value, true
+	}
+	if raw != name {
+		return "", false
+	}
+	if *i+1 < len(args) {
+		*i++
+		return args[*i], true
+	}
+	return "", true
+}
+
+// parseLaunchArgs splits the command line into files to open and an optional --goto target,
+// whose file is opened first. `-` stands for the document read from stdin, and `--rev <rev>`
+// opens the files as they were at that git revision. A malformed flag is reported and
+// otherwise ignored.
+func parseLaunchArgs(args []string) ([]string, *GotoRequest, error) {
+	var files []string
+	var target *GotoRequest
+	var rev string
+	var argErr error
+	for i := 0; i < len(args); i++ {
+		raw := args[i]
+		if strings.HasPrefix(raw, "-psn_") {
+			continue
+		}
+		if value, ok := flagValue(args, &i, "--goto"); ok {
+			if req, err := parseGotoTarget(value); err == nil {
+				target = &req
+			} else {
+				argErr = err
+			}
+			continue
+		}
+		if value, ok := flagValue(args, &i, "--rev"); ok {
+			if rev = strings.TrimSpace(value); rev == "" || strings.HasPrefix(rev, "-") {
+				rev = ""
+				argErr = fmt.Errorf("--rev expects a git revision, got %q", value)
+			}
+			continue
+		}
+		if raw == "-" {
+			files = append(files, stdinDocPath)
+			continue
+		}
+		if p := normalizePath(raw); p != "" {
+			files = append(files, p)
+		}
+	}
+	if target != nil && !containsString(files, target.Path) {
+		files = append([]string{target.Path}, files...)
+	}
+	if rev != "" {
+		for i, p := range files {
+			if !isVirtualPath(p) {
+				files[i] = gitDocPath(rev, p)
+			}
+		}
+		if target != nil {
+			target.Path = gitDocPath(rev, target.Path)
+		}
+	}
+	return files, target, argErr
+}
+
+// sendIPC delivers a request to the running mdr. It fails when no instance is listening.
+func sendIPC(req ipcRequest) error {
+	path, err := ipcSocketPath()
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", path, ipcDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ipcDialTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+	var resp ipcResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
+// listenIPC starts serving commands on the socket. A socket left behind by an instance that
+// exited is replaced; one that still answers belongs to another running mdr and is left alone.
+func (a *App) listenIPC() error {
+	path, err := ipcSocketPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if conn, err := net.DialTimeout("unix", path, ipcDialTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("another mdr is listening on %s", path)
+	}
+	_ = os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	_ = os.Chmod(path, 0o600)
+
+	a.mu.Lock()
+	a.ipc = ln
+	a.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go a.serveIPCConn(conn)
+		}
+	}()
+	return nil
+}
+
+func (a *App) serveIPCConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	// "open" requests carry piped stdin up to the file size limit; JSON escaping can double it.
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*int(getMaxFileBytesFromConfig())+64*1024)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req ipcRequest
+		resp := ipcResponse{OK: true}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = ipcResponse{Error: "invalid request: " + err.Error()}
+		} else if err := a.handleIPCRequest(req); err != nil {
+			resp = ipcResponse{Error: err.Error()}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = enc.Encode(ipcResponse{Error: "invalid request: " + err.Error()})
+	}
+}
+
+func (a *App) handleIPCRequest(req ipcRequest) error {
+	switch req.Command {
+	case "goto":
+		path := normalizePath(req.Path)
+		if path == "" || req.Line < 1 {
+			return errors.New("goto needs a path and a line")
+		}
+		a.gotoLine(GotoRequest{Path: path, Line: req.Line})
+		return nil
+	case "open":
+		if containsString(req.Paths, stdinDocPath) {
+			setStdinDocument(req.Stdin, req.Dir)
+		}
+		if len(req.Paths) > 0 {
+			a.handleFileOpen(req.Paths)
+		}
+		a.raiseWindow()
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", req.Command)
+	}
+}
+
+// gotoLine asks the frontend to show a line, opening the file if it is not the one shown.
+func (a *App) gotoLine(req GotoRequest) {
+	req.Line = renderedLine(req.Path, req.Line)
+	a.mu.Lock()
+	ctx := a.ctx
+	a.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+	runtime.EventsEmit(ctx, "goto-line", req)
+}
+
+// raiseWindow brings the window to the front for files forwarded by a second launch.
+func (a *App) raiseWindow() {
+	a.mu.Lock()
+	ctx := a.ctx
+	a.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+	runtime.WindowUnminimise(ctx)
+	runtime.WindowShow(ctx)
+}
+
+// GetLaunchGoto returns the --goto target mdr was started with; Line is 0 when there was none.
+func (a *App) GetLaunchGoto() GotoRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.launchGoto == nil {
+		return GotoRequest{}
+	}
+	return *a.launchGoto
+}
+
+// closeIPC stops listening and removes the socket.
+func (a *App) closeIPC() {
+	a.mu.Lock()
+	ln := a.ipc
+	a.ipc = nil
+	a.mu.Unlock()
+	if ln != nil {
+		ln.Close()
+	}
+}
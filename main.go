@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -13,11 +14,36 @@ import (
 var assets embed.FS
 
 func main() {
+	// `mdr --goto file.md:120` scrolls an already running mdr instead of starting another,
+	// and in single-instance mode files are handed to the running mdr, which opens them.
+	files, target, err := parseLaunchArgs(os.Args[1:])
+	if err != nil {
+		println("Error:", err.Error())
+	}
+	// `mdr -` renders whatever is piped in
+	var stdin, dir string
+	if containsString(files, stdinDocPath) {
+		if stdin, err = readStdinDocument(); err != nil {
+			println("Error:", err.Error())
+		}
+		dir, _ = os.Getwd()
+		setStdinDocument(stdin, dir)
+	}
+	if target != nil {
+		if sendIPC(ipcRequest{Command: "goto", Path: target.Path, Line: target.Line}) == nil {
+			return
+		}
+	} else if getSingleInstanceFromConfig() {
+		if sendIPC(ipcRequest{Command: "open", Paths: files, Stdin: stdin, Dir: dir}) == nil {
+			return
+		}
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 
 	// Create application with options
-	err := wails.Run(&options.App{
+	err = wails.Run(&options.App{
 		Title:  "mdr",
 		Width:  1024,
 		Height: 768,
@@ -26,6 +52,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// pandocTimeout bounds a pandoc export; large documents with images can take a while.
+	pandocTimeout = 2 * time.Minute
+	// pandocListTimeout bounds asking pandoc for its output formats.
+	pandocListTimeout = 10 * time.Second
+)
+
+// errPandocMissing is returned when no pandoc binary can be found.
+var errPandocMissing = fmt.Errorf("pandoc not found: install it from https://pandoc.org/installing.html")
+
+// pandocExtensions maps pandoc output formats to the extension of the files they write, where
+// it differs from the format's name.
+var pandocExtensions = map[string]string{
+	"asciidoc": "adoc", "asciidoctor": "adoc", "beamer": "tex", "chunkedhtml": "zip",
+	"commonmark": "md", "commonmark_x": "md", "context": "tex", "docbook": "xml",
+	"docbook4": "xml", "docbook5": "xml", "dzslides": "html", "epub2": "epub", "epub3": "epub",
+	"gfm": "md", "haddock": "txt", "html4": "html", "html5": "html", "jats": "xml",
+	"jats_archiving": "xml", "jats_articleauthoring": "xml", "jats_publishing": "xml",
+	"jira": "txt", "latex": "tex", "man": "1", "markdown": "md", "markdown_github": "md",
+	"markdown_mmd": "md", "markdown_phpextra": "md", "markdown_strict": "md",
+	"mediawiki": "wiki", "ms": "ms", "native": "hs", "plain": "txt", "revealjs": "html",
+	"s5": "html", "slideous": "html", "slidy": "html", "tei": "xml", "texinfo": "texi",
+	"typst": "typ", "xwiki": "txt", "zimwiki": "txt",
+}
+
+// pandocHTMLFormats are the formats that take the theme CSS as an inline stylesheet.
+var pandocHTMLFormats = []string{"html", "html4", "html5", "chunkedhtml", "revealjs", "s5", "slidy", "slideous", "dzslides"}
+
+// GetPandocFormats lists the output formats of the local pandoc, for the export menu. It
+// fails with a message saying how to install pandoc when there is none.
+func (a *App) GetPandocFormats() ([]string, error) {
+	bin := findTool("pandoc")
+	if bin == "" {
+		return nil, errPandocMissing
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pandocListTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bin, "--list-output-formats").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pandoc --list-output-formats: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// ExportWithPandoc exports the document at path to format with the local pandoc, asking where
+// to save it with the save dialog. The Markdown goes to pandoc on stdin, with includes
+// expanded, and images resolve from the document's folder. HTML and EPUB output get the
+// theme's CSS. pandoc's warnings and progress go to the status bar as they come. It returns
+// the path written, or "" when the dialog is cancelled.
+func (a *App) ExportWithPandoc(path string, theme string, format string) (string, error) {
+	bin := findTool("pandoc")
+	if bin == "" {
+		return "", errPandocMissing
+	}
+	if pandocFormatName(format) == "" {
+		return "", fmt.Errorf("no pandoc output format given")
+	}
+	path = normalizePath(path)
+	markdown, _, err := readDocument(path)
+	if err != nil {
+		return "", err
+	}
+	base := documentBase(path)
+	dest, err := a.chooseExportFile(base, "."+pandocExtension(format), format+" (*."+pandocExtension(format)+")")
+	if err != nil || dest == "" {
+		return "", err
+	}
+
+	title := documentTitle(path)
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(base), filepath.Ext(base))
+	}
+	args, cleanup, err := pandocArgs(format, dest, filepath.Dir(base), title, themeCSSByName(theme, paletteLight))
+	defer cleanup()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pandocTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = filepath.Dir(base)
+	cmd.Stdin = strings.NewReader(markdown)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	var last string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			last = line
+			level := "info"
+			if strings.HasPrefix(line, "[WARNING]") {
+				level = "warning"
+			}
+			a.emitStatus(level, "pandoc", "pandoc: "+line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		a.emitStatus("warning", "pandoc", "pandoc: "+err.Error())
+	}
+	// Keep draining after an overlong line, or pandoc blocks writing to a full pipe.
+	_, _ = io.Copy(io.Discard, stderr)
+	if err := cmd.Wait(); err != nil {
+		if last == "" {
+			last = err.Error()
+		}
+		return "", fmt.Errorf("pandoc failed: %s", last)
+	}
+	return dest, nil
+}
+
+// pandocFormatName strips the `+ext`/`-ext` extension toggles from a pandoc format.
+func pandocFormatName(format string) string {
+	name, _, _ := strings.Cut(format, "+")
+	name, _, _ = strings.Cut(name, "-")
+	return name
+}
+
+// pandocExtension returns the file extension for a pandoc output format.
+func pandocExtension(format string) string {
+	name := pandocFormatName(format)
+	if ext, ok := pandocExtensions[name]; ok {
+		return ext
+	}
+	return name
+}
+
+// pandocArgs builds the pandoc command line for converting stdin to format in dest. The theme
+// CSS is written to a temporary file; cleanup removes it and must be called even on error.
+func pandocArgs(format, dest, resourceDir, title, css string) ([]string, func(), error) {
+	args := []string{
+		"--from=gfm", "--to=" + format, "--standalone",
+		"--resource-path=" + resourceDir,
+		"--metadata=pagetitle:" + title,
+		"--output=" + dest,
+	}
+	cleanup := func() {}
+	name := pandocFormatName(format)
+	htmlOut := containsString(pandocHTMLFormats, name)
+	epub := name == "epub" || name == "epub2" || name == "epub3"
+	if strings.TrimSpace(css) == "" || (!htmlOut && !epub) {
+		return args, cleanup, nil
+	}
+
+	dir, err := os.MkdirTemp("", "mdr-pandoc-")
+	if err != nil {
+		return nil, cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if epub {
+		// EPUB embeds the stylesheets it is given.
+		file := filepath.Join(dir, "theme.css")
+		if err := os.WriteFile(file, []byte(css), 0o600); err != nil {
+			return nil, cleanup, err
+		}
+		return append(args, "--css="+file), cleanup, nil
+	}
+	// A linked stylesheet would point at the temporary file, so HTML gets it inline.
+	var header bytes.Buffer
+	header.WriteString("<style>\n")
+	header.WriteString(strings.ReplaceAll(css, "</style", `<\/style`))
+	header.WriteString("\n</style>\n")
+	file := filepath.Join(dir, "theme.html")
+	if err := os.WriteFile(file, header.Bytes(), 0o600); err != nil {
+		return nil, cleanup, err
+	}
+	return append(args, "--include-in-header="+file), cleanup, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// printCSS lays a document out for paper: no dark backgrounds, wrapped code, link targets
+// written out and no page breaks inside tables, code blocks or diagrams.
+const printCSS = `@media print{` +
+	`@page{margin:16mm 14mm}` +
+	`html,body{background:#fff !important}` +
+	`#wrapper{max-width:none;padding:0;color:#000}` +
+	`#wrapper pre,#wrapper code{white-space:pre-wrap;overflow-wrap:anywhere;overflow:visible}` +
+	`#wrapper pre,#wrapper table,#wrapper blockquote,#wrapper figure,#wrapper img,#wrapper svg,#wrapper .mermaid,#wrapper .markdown-alert{break-inside:avoid;page-break-inside:avoid}` +
+	`#wrapper tr{break-inside:avoid;page-break-inside:avoid}` +
+	`#wrapper h1,#wrapper h2,#wrapper h3,#wrapper h4,#wrapper h5,#wrapper h6{break-after:avoid;page-break-after:avoid}` +
+	`#wrapper a{color:inherit;text-decoration:underline}` +
+	`}`
+
+// printLinkURLsCSS writes each link's target after its text, except for links within the page.
+const printLinkURLsCSS = `@media print{#wrapper a[href]:not([href^="#"])::after{content:" (" attr(href) ")";font-size:85%;color:#57606a;overflow-wrap:anywhere}}`
+
+// PrintOptions adjust the page RenderPrint produces.
+type PrintOptions struct {
+	// LinkURLs writes link targets after their text.
+	LinkURLs bool `json:"linkURLs"`
+	// FontScale is the text size in percent; 0 means 100.
+	FontScale int `json:"fontScale"`
+}
+
+// RenderPrint renders the document at path for printing: always in the light palette, with
+// the print stylesheet and then any `@media print` rules of the theme, so themes can restyle
+// the printout.
+func (a *App) RenderPrint(path string, theme string, options PrintOptions) (string, error) {
+	path = normalizePath(path)
+	markdown, _, err := readDocument(path)
+	if err != nil {
+		return "", err
+	}
+	if options.FontScale == 0 {
+		options.FontScale = 100
+	}
+	return sharedRenderer().RenderPrint(markdown, documentBase(path), theme, options)
+}
+
+// RenderPrint renders markdown into a page styled for printing.
+func (r *Renderer) RenderPrint(markdown, docPath, themeName string, options PrintOptions) (string, error) {
+	st := r.newRenderState(htmlProfileForPath(docPath))
+	body, _, _, err := r.renderBody(markdown, docPath, st)
+	if err != nil {
+		return "", err
+	}
+	layoutCSS := themeCSSByName(themeName, paletteLight)
+	css := printCSS
+	if options.LinkURLs {
+		css += printLinkURLsCSS
+	}
+	css += mediaPrintRules(layoutCSS)
+	return r.renderPage(body, st, layoutCSS, paletteLight, clampFontScale(options.FontScale), css)
+}
+
+// mediaPrintRule matches the start of an `@media print` block, in any case.
+var mediaPrintRule = regexp.MustCompile(`(?i)@media\s+print\b`)
+
+// mediaPrintRules returns the `@media print` blocks of a stylesheet.
+func mediaPrintRules(css string) string {
+	var out strings.Builder
+	for i := 0; ; {
+		loc := mediaPrintRule.FindStringIndex(css[i:])
+		if loc == nil {
+			break
+		}
+		start := i + loc[0]
+		open := strings.IndexByte(css[start:], '{')
+		if open < 0 {
+			break
+		}
+		depth, end := 0, -1
+		for j := start + open; j < len(css); j++ {
+			switch css[j] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				end = j + 1
+				break
+			}
+		}
+		if end < 0 {
+			break
+		}
+		out.WriteString(css[start:end])
+		i = end
+	}
+	return out.String()
+}
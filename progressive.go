@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	// progressiveFirstChunkBytes is roughly how much of a large document is rendered before
+	// the first page is shown.
+	progressiveFirstChunkBytes = 64 * 1024
+	// progressiveChunkBytes is roughly how much is rendered for each later chunk.
+	progressiveChunkBytes = 256 * 1024
+)
+
+// topLevelHeading matches `#` and `##` ATX headings, where progressive chunks are cut.
+var topLevelHeading = regexp.MustCompile(`^ {0,3}#{1,2}(?:[ \t]|$)`)
+
+// RenderChunk carries the blocks of a progressively rendered document that follow the first
+// page. The last chunk has Done set and the document's totals, including everything the
+// sanitizer removed.
+type RenderChunk struct {
+	StreamID  int              `json:"streamId"`
+	Path      string           `json:"path"`
+	Blocks    []RenderedBlock  `json:"blocks"`
+	TOC       []TOCItem        `json:"toc"`
+	Done      bool             `json:"done"`
+	CharCount int              `json:"charCount"`
+	WordCount int              `json:"wordCount"`
+	Error     string           `json:"error"`
+	Removed   []RemovedContent `json:"removed"`
+}
+
+// sectionReader splits a Markdown stream into chunks that end just before a top-level
+// heading, so each chunk parses on its own. Documents without such headings are cut at a
+// blank line once a chunk grows well past the requested size.
+type sectionReader struct {
+	r     *bufio.Reader
+	fence string
+	next  string
+	eof   bool
+}
+
+func newSectionReader(r io.Reader) *sectionReader {
+	return &sectionReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+func (s *sectionReader) done() bool {
+	return s.eof && s.next == ""
+}
+
+// nextChunk reads at least minBytes (unless the stream ends first) up to the next cut point.
+func (s *sectionReader) nextChunk(minBytes int) (string, error) {
+	var b strings.Builder
+	b.WriteString(s.next)
+	s.next = ""
+	for !s.eof {
+		line, err := s.r.ReadString('\n')
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return "", err
+		}
+		if line == "" {
+			continue
+		}
+
+		trimmed := strings.TrimRight(line, "\r\n")
+		if s.fence != "" {
+			if closesFence(trimmed, s.fence) {
+				s.fence = ""
+			}
+			b.WriteString(line)
+			continue
+		}
+		if m := fenceOpen.FindStringSubmatch(trimmed); m != nil {
+			s.fence = m[1]
+			b.WriteString(line)
+			continue
+		}
+		if b.Len() >= minBytes && topLevelHeading.MatchString(trimmed) {
+			s.next = line
+			return b.String(), nil
+		}
+		b.WriteString(line)
+		if b.Len() >= 4*minBytes && strings.TrimSpace(trimmed) == "" {
+			return b.String(), nil
+		}
+	}
+	return b.String(), nil
+}
+
+// linkReferenceLine matches the first line of a link reference definition.
+var linkReferenceLine = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:`)
+
+// linkReferences collects the link reference definitions in markdown, so every chunk of a
+// progressive render resolves references defined anywhere in the document, such as the
+// version links at the bottom of a changelog. Definitions inside code fences are skipped.
+func (r *Renderer) linkReferences(markdown string) []parser.Reference {
+	var defs strings.Builder
+	fence := ""
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimRight(line, "\r")
+		switch {
+		case fence != "":
+			if closesFence(trimmed, fence) {
+				fence = ""
+			}
+		case fenceOpen.MatchString(trimmed):
+			fence = fenceOpen.FindStringSubmatch(trimmed)[1]
+		case linkReferenceLine.MatchString(trimmed):
+			// Blank lines keep each definition a paragraph of its own.
+			defs.WriteString(trimmed + "\n\n")
+		}
+	}
+	// Let goldmark parse them, so they mean exactly what they would in the whole document.
+	pc := parser.NewContext()
+	r.md.Parser().Parse(text.NewReader([]byte(defs.String())), parser.WithContext(pc))
+	return pc.References()
+}
+
+// rendersProgressively reports whether the file at path is over `progressiveRenderKB`.
+func rendersProgressively(path string) bool {
+	limit := getProgressiveRenderBytesFromConfig()
+	if limit <= 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > limit
+}
+
+// renderProgressive renders the first screens of a large file and returns them as a page;
+// the rest of the file is rendered in the background and passed to emit chunk by chunk.
+// Includes are expanded for the whole document first, so they share one size budget and the
+// blocks are numbered by the same lines as a full render. A newer render of any file stops
+// the stream.
+func (a *App) renderProgressive(path string, theme string, palette string, gen int, emit func(RenderChunk)) (RenderResult, error) {
+	markdown, includes, err := readDocument(path)
+	if err != nil {
+		return RenderResult{}, err
+	}
+	sr := newSectionReader(strings.NewReader(markdown))
+	first, err := sr.nextChunk(progressiveFirstChunkBytes)
+	if err != nil {
+		return RenderResult{}, err
+	}
+
+	r := sharedRenderer()
+	st := r.newRenderState(htmlProfileForPath(path))
+	st.refs = r.linkReferences(markdown)
+	body, _, toc, err := r.renderBody(first, path, st)
+	if err != nil {
+		return RenderResult{}, err
+	}
+	st.lineOffset += strings.Count(first, "\n")
+	// Later chunks may contain diagrams, so a page that is still streaming always gets the scripts.
+	st.clientScripts = st.clientScripts || !sr.done()
+	page, err := r.renderPage(body, st, themeCSSByName(theme, normalizePalette(palette)), normalizePalette(palette), clampFontScale(getFontScaleFromConfig()), "")
+	if err != nil {
+		return RenderResult{}, err
+	}
+
+	a.SetCurrentDocument(first)
+	a.setIncludes(path, includes)
+	// Block IDs for the whole document aren't known yet, so the next patch must be a full render.
+	a.setShown(shownRender{})
+	removed := st.removed.items()
+	a.reportRemoved(removed, st.removed.blocks)
+
+	result := RenderResult{
+		Path:      path,
+		HTML:      page,
+		TOC:       toc,
+		CharCount: len(first),
+		WordCount: countWords(first),
+		Includes:  includes,
+		Partial:   !sr.done(),
+		StreamID:  gen,
+		Removed:   removed,
+	}
+	if sr.done() {
+		return result, nil
+	}
+	go a.streamSections(sr, path, gen, st, markdown, emit)
+	return result, nil
+}
+
+// streamSections renders the chunks of markdown left in sr; all is the whole document.
+func (a *App) streamSections(sr *sectionReader, path string, gen int, st *renderState, all string, emit func(RenderChunk)) {
+	for !sr.done() {
+		if !a.isCurrentRender(gen) {
+			return
+		}
+		chunk, err := sr.nextChunk(progressiveChunkBytes)
+		if err != nil {
+			emit(RenderChunk{StreamID: gen, Path: path, Done: true, Error: err.Error()})
+			return
+		}
+		_, blocks, toc, err := sharedRenderer().renderBody(chunk, path, st)
+		if err != nil {
+			emit(RenderChunk{StreamID: gen, Path: path, Done: true, Error: err.Error()})
+			return
+		}
+		st.lineOffset += strings.Count(chunk, "\n")
+
+		out := RenderChunk{StreamID: gen, Path: path, Blocks: blocks, TOC: toc, Done: sr.done()}
+		if !a.isCurrentRender(gen) {
+			return
+		}
+		if out.Done {
+			a.SetCurrentDocument(all)
+			out.CharCount = len(all)
+			out.WordCount = countWords(all)
+			out.Removed = st.removed.items()
+			a.reportRemoved(out.Removed, st.removed.blocks)
+		}
+		emit(out)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nextRenderGeneration starts a new render, which stops any progressive render in flight.
+func (a *App) nextRenderGeneration() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.renderGen++
+	return a.renderGen
+}
+
+func (a *App) isCurrentRender(gen int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.renderGen == gen
+}
+
+func (a *App) emitRenderChunk(chunk RenderChunk) {
+	a.mu.Lock()
+	ctx := a.ctx
+	a.mu.Unlock()
+	if ctx == nil {
+		return
+	}
+	runtime.EventsEmit(ctx, "render-chunk", chunk)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderCacheSize is how many rendered documents are kept. Theme and palette only change the
+// page around the body, so they share an entry.
+const renderCacheSize = 32
+
+// renderCacheKey identifies one rendering of a document's body. Besides the document and
+// the sanitizer profile, the key covers what the extensions look up outside the document:
+// the notes its wikilinks resolve against, the repository its references link to and the
+// diagram engines installed.
+type renderCacheKey struct {
+	content    [32]byte
+	extensions string
+	profile    string
+	notes      int
+	repoURL    string
+	engines    string
+}
+
+func newRenderCacheKey(markdown, docPath string, profile htmlProfile) renderCacheKey {
+	// The path is hashed with the content because links resolve relative to it.
+	key := renderCacheKey{
+		content:    sha256.Sum256([]byte(docPath + "\x00" + markdown)),
+		extensions: extensionSetKey(),
+		profile:    profile.key(),
+		repoURL:    keyInputs.repoURL(docPath),
+	}
+	// Only documents that can contain wikilinks or diagrams pay for checking the notes
+	// folder and the engines.
+	if docPath != "" && strings.Contains(markdown, "[[") {
+		key.notes = cachedNoteIndex(notesRoot(docPath)).version
+	}
+	if strings.Contains(markdown, "```") || strings.Contains(markdown, "~~~") {
+		key.engines = keyInputs.engines()
+	}
+	return key
+}
+
+// maxKeyInputPaths bounds how many documents' profiles and folders' repository URLs are kept.
+const maxKeyInputPaths = 1024
+
+// renderInputs keeps what render cache keys need from outside the document: the sanitizer
+// profile and repository URL of each document, read from the config and the enclosing git
+// repository, and the diagram engines found on PATH. Looking them up on every render would
+// cost a cache hit several config reads and PATH searches, so they are looked up again only
+// after the config file changes or the file watcher calls invalidate.
+type renderInputs struct {
+	mu        sync.Mutex
+	stamp     configStamp
+	profiles  map[string]htmlProfile
+	repoURLs  map[string]string
+	engineSet *string
+}
+
+// configStamp identifies a version of the config file and the environment it is read with.
+type configStamp struct {
+	path    string
+	modTime time.Time
+	size    int64
+	unsafe  bool
+}
+
+var keyInputs = &renderInputs{}
+
+func currentConfigStamp() configStamp {
+	st := configStamp{unsafe: allowUnsafeHTML()}
+	st.path, _ = configPath()
+	if info, err := os.Stat(st.path); err == nil {
+		st.modTime, st.size = info.ModTime(), info.Size()
+	}
+	return st
+}
+
+// refresh drops everything looked up under an older config. It must be called with c.mu held.
+func (c *renderInputs) refresh() {
+	if st := currentConfigStamp(); st != c.stamp || c.profiles == nil || len(c.profiles)+len(c.repoURLs) > maxKeyInputPaths {
+		c.stamp = st
+		c.profiles = map[string]htmlProfile{}
+		c.repoURLs = map[string]string{}
+		c.engineSet = nil
+	}
+}
+
+// invalidate makes the next render look everything up again.
+func (c *renderInputs) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.profiles = nil
+}
+
+// profile returns htmlProfileForPath(docPath).
+func (c *renderInputs) profile(docPath string) htmlProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+	p, ok := c.profiles[docPath]
+	if !ok {
+		p = htmlProfileForPath(docPath)
+		c.profiles[docPath] = p
+	}
+	return p
+}
+
+// repoURL returns repoBaseURLForPath(docPath), which only depends on the document's folder.
+func (c *renderInputs) repoURL(docPath string) string {
+	dir := ""
+	if docPath != "" {
+		dir = filepath.Dir(docPath)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+	u, ok := c.repoURLs[dir]
+	if !ok {
+		u = repoBaseURLForPath(docPath)
+		c.repoURLs[dir] = u
+	}
+	return u
+}
+
+// engines returns diagramEnginesKey().
+func (c *renderInputs) engines() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+	if c.engineSet == nil {
+		key := diagramEnginesKey()
+		c.engineSet = &key
+	}
+	return *c.engineSet
+}
+
+// diagramEnginesKey lists the diagram languages whose engine is installed.
+func diagramEnginesKey() string {
+	var langs []string
+	for lang, r := range diagramRenderers {
+		if r.Available() {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return strings.Join(langs, "+")
+}
+
+// extensionSetKey describes the Markdown extensions in effect.
+func extensionSetKey() string {
+	parts := []string{"gfm", "admonitions", "emoji", "repo-refs", "wikilinks", "diagrams", "source-lines"}
+	var langs []string
+	for lang := range diagramRenderers {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	parts = append(parts, "diagram-langs="+strings.Join(langs, "+"))
+	return strings.Join(parts, ",")
+}
+
+// RenderCacheStats reports render cache usage for diagnostics.
+type RenderCacheStats struct {
+	Hits     int `json:"hits"`
+	Misses   int `json:"misses"`
+	Entries  int `json:"entries"`
+	Capacity int `json:"capacity"`
+}
+
+type renderCacheEntry struct {
+	key renderCacheKey
+	doc renderedDocument
+}
+
+// renderLRU is a fixed-size, least-recently-used cache of rendered documents.
+type renderLRU struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[renderCacheKey]*list.Element
+	hits     int
+	misses   int
+}
+
+func newRenderLRU(capacity int) *renderLRU {
+	return &renderLRU{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  map[renderCacheKey]*list.Element{},
+	}
+}
+
+func (c *renderLRU) get(key renderCacheKey) (renderedDocument, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return renderedDocument{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return copyRenderedDocument(el.Value.(*renderCacheEntry).doc), true
+}
+
+func (c *renderLRU) put(key renderCacheKey, doc renderedDocument) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*renderCacheEntry).doc = copyRenderedDocument(doc)
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&renderCacheEntry{key: key, doc: copyRenderedDocument(doc)})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*renderCacheEntry).key)
+	}
+}
+
+func (c *renderLRU) stats() RenderCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return RenderCacheStats{
+		Hits:     c.hits,
+		Misses:   c.misses,
+		Entries:  c.order.Len(),
+		Capacity: c.capacity,
+	}
+}
+
+// copyRenderedDocument keeps callers from mutating a cached TOC, block list or removal report.
+func copyRenderedDocument(d renderedDocument) renderedDocument {
+	d.output.TOC = append([]TOCItem(nil), d.output.TOC...)
+	d.output.Blocks = append([]RenderedBlock(nil), d.output.Blocks...)
+	d.output.Removed = append([]RemovedContent(nil), d.output.Removed...)
+	d.output.Sanitized = append([]SanitizedBlock(nil), d.output.Sanitized...)
+	return d
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/yuin/goldmark"
@@ -40,11 +43,12 @@ type TOCItem struct {
 	Level int    `json:"level"`
 }
 
+var idUnsafeChars = regexp.MustCompile(`[^a-z0-9]+`)
+
 // generateID creates a URL-friendly ID from text
 func generateID(text string) string {
 	// Convert to lowercase and replace spaces/special chars with hyphens
-	reg := regexp.MustCompile(`[^a-z0-9]+`)
-	id := reg.ReplaceAllString(strings.ToLower(text), "-")
+	id := idUnsafeChars.ReplaceAllString(strings.ToLower(text), "-")
 	id = strings.Trim(id, "-")
 	return id
 }
@@ -81,15 +85,17 @@ func normalizePalette(p string) paletteMode {
 func paletteCSSByMode(p paletteMode) string {
 	switch p {
 	case paletteDark:
-		return "html,body{background:#0d1117;color:#c9d1d9}#wrapper{color:#c9d1d9}#wrapper p,#wrapper td,#wrapper div,#wrapper li,#wrapper h1,#wrapper h2,#wrapper h3,#wrapper h4,#wrapper h5,#wrapper h6,#wrapper th,#wrapper caption,#wrapper dt,#wrapper dd,#wrapper span{color:inherit}#wrapper a{color:#58a6ff}#wrapper pre,#wrapper code{background:#161b22}#wrapper blockquote{color:#8b949e;border-left:4px solid #30363d}#wrapper hr{border:0;border-top:1px solid #30363d}#wrapper table{border-collapse:collapse}#wrapper th,#wrapper td{border:1px solid #30363d;padding:6px 10px}#wrapper figcaption{background:transparent;color:inherit}"
+		return "html,body{background:#0d1117;color:#c9d1d9}#wrapper{color:#c9d1d9}#wrapper p,#wrapper td,#wrapper div,#wrapper li,#wrapper h1,#wrapper h2,#wrapper h3,#wrapper h4,#wrapper h5,#wrapper h6,#wrapper th,#wrapper caption,#wrapper dt,#wrapper dd,#wrapper span{color:inherit}#wrapper a{color:#58a6ff}#wrapper pre,#wrapper code{background:#161b22}#wrapper blockquote{color:#8b949e;border-left:4px solid #30363d}#wrapper hr{border:0;border-top:1px solid #30363d}#wrapper table{border-collapse:collapse}#wrapper th,#wrapper td{border:1px solid #30363d;padding:6px 10px}#wrapper figcaption{background:transparent;color:inherit}#wrapper{--alert-note-color:#4493f8;--alert-tip-color:#3fb950;--alert-important-color:#ab7df8;--alert-warning-color:#d29922;--alert-caution-color:#f85149}"
 	case paletteTheme:
 		return ""
 	default:
-		return "html,body{background:#ffffff;color:#1f2328}#wrapper{color:#1f2328}#wrapper p,#wrapper td,#wrapper div,#wrapper li,#wrapper h1,#wrapper h2,#wrapper h3,#wrapper h4,#wrapper h5,#wrapper h6,#wrapper th,#wrapper caption,#wrapper dt,#wrapper dd,#wrapper span{color:inherit}#wrapper a{color:#0969da}#wrapper pre,#wrapper code{background:#f6f8fa}#wrapper blockquote{color:#57606a;border-left:4px solid #d0d7de}#wrapper hr{border:0;border-top:1px solid #d0d7de}#wrapper table{border-collapse:collapse}#wrapper th,#wrapper td{border:1px solid #d0d7de;padding:6px 10px}#wrapper figcaption{background:transparent;color:inherit}"
+		return "html,body{background:#ffffff;color:#1f2328}#wrapper{color:#1f2328}#wrapper p,#wrapper td,#wrapper div,#wrapper li,#wrapper h1,#wrapper h2,#wrapper h3,#wrapper h4,#wrapper h5,#wrapper h6,#wrapper th,#wrapper caption,#wrapper dt,#wrapper dd,#wrapper span{color:inherit}#wrapper a{color:#0969da}#wrapper pre,#wrapper code{background:#f6f8fa}#wrapper blockquote{color:#57606a;border-left:4px solid #d0d7de}#wrapper hr{border:0;border-top:1px solid #d0d7de}#wrapper table{border-collapse:collapse}#wrapper th,#wrapper td{border:1px solid #d0d7de;padding:6px 10px}#wrapper figcaption{background:transparent;color:inherit}#wrapper{--alert-note-color:#0969da;--alert-tip-color:#1a7f37;--alert-important-color:#8250df;--alert-warning-color:#9a6700;--alert-caution-color:#d1242f}"
 	}
 }
 
-func themeCSSByName(themeName string) string {
+// themeCSSByName returns the CSS of the named theme for palette p: a theme package's
+// stylesheets and assets, or a loose .css file in the themes folder.
+func themeCSSByName(themeName string, p paletteMode) string {
 	themeName = strings.TrimSpace(themeName)
 	if themeName == "" {
 		return ""
@@ -99,6 +105,10 @@ func themeCSSByName(themeName string) string {
 		return ""
 	}
 
+	if pkg, ok := themePackageDir(themeName); ok {
+		return themePackageCSS(pkg, p)
+	}
+
 	dir, err := themesDir()
 	if err != nil {
 		return ""
@@ -119,35 +129,72 @@ func themeCSSByName(themeName string) string {
 
 // RenderOutput contains both the HTML and TOC
 type RenderOutput struct {
-	HTML string
-	TOC  []TOCItem
+	HTML          string
+	TOC           []TOCItem
+	Blocks        []RenderedBlock
+	ClientScripts bool
+	// Removed summarises what the sanitizer dropped; Sanitized has the affected blocks.
+	Removed   []RemovedContent
+	Sanitized []SanitizedBlock
 }
 
-func allowUnsafeHTML() bool {
-	env := strings.ToLower(strings.TrimSpace(os.Getenv("MDR_UNSAFE_HTML")))
-	return env == "1" || env == "true" || env == "yes"
+// contentSecurityPolicy builds the preview's CSP. Pages that run no scripts get no
+// script-src at all, so default-src 'none' blocks every script; pages that load Mermaid
+// allow only the scripts carrying nonce. Trusted documents keep the legacy policy so their
+// own inline scripts still run.
+func contentSecurityPolicy(nonce string, trusted bool) string {
+	directives := []string{
+		"default-src 'none'",
+		"style-src 'self' 'unsafe-inline' data: https://cdn.jsdelivr.net",
+		"img-src 'self' data:",
+		"font-src 'self' data:",
+	}
+	switch {
+	case trusted:
+		directives = append(directives, "script-src 'unsafe-inline' https://cdn.jsdelivr.net")
+	case nonce != "":
+		directives = append(directives, "script-src 'nonce-"+nonce+"'")
+	}
+	directives = append(directives,
+		"connect-src 'none'",
+		"media-src 'self' data:",
+		"object-src 'none'",
+		"frame-ancestors 'none'",
+		"form-action 'none'",
+	)
+	return strings.Join(directives, "; ")
 }
 
-func sanitizer() *bluemonday.Policy {
-	p := bluemonday.UGCPolicy()
-	p.AllowAttrs("id").Globally()
-	p.AllowAttrs("class").Globally()
-	p.AllowStyling()
-	return p
+// newScriptNonce returns a random nonce for the page's script tags. It uses the URL-safe
+// alphabet so the template never has to escape it.
+func newScriptNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func applyCSP(page string) (string, error) {
-	// Updated CSP to allow Mermaid.js to work
-	csp := "default-src 'none'; style-src 'self' 'unsafe-inline' data: https://cdn.jsdelivr.net; img-src 'self' data:; font-src 'self' data:; script-src 'unsafe-inline' https://cdn.jsdelivr.net; connect-src 'none'; media-src 'self' data:; object-src 'none'; frame-ancestors 'none'; form-action 'none'"
-	tag := fmt.Sprintf(`<meta http-equiv="Content-Security-Policy" content="%s">`, template.HTMLEscapeString(csp))
-	page = strings.Replace(page, "<head>", "<head>"+tag, 1)
-	return page, nil
+// needsClientScripts reports whether the document has blocks rendered in the preview by
+// script, i.e. Mermaid diagrams that weren't rendered to SVG up front.
+func needsClientScripts(source []byte, doc ast.Node) bool {
+	found := false
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if fcb, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			if strings.EqualFold(string(fcb.Language(source)), "mermaid") {
+				found = true
+				return ast.WalkStop, nil
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
 }
 
-// extractTOC walks the AST and extracts heading information
-func extractTOC(source []byte, node ast.Node) []TOCItem {
+// extractTOC walks the AST and extracts heading information. seen counts the heading IDs
+// already used, so IDs stay unique across documents rendered in several pieces.
+func extractTOC(source []byte, node ast.Node, seen map[string]int) []TOCItem {
 	var items []TOCItem
-	seen := make(map[string]int)
 	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
 			return ast.WalkContinue, nil
@@ -166,11 +213,12 @@ func extractTOC(source []byte, node ast.Node) []TOCItem {
 
 			text := textBuf.String()
 			if text != "" {
-				id := generateID(text)
-				if count := seen[id]; count > 0 {
-					id = fmt.Sprintf("%s-%d", id, count+1)
+				base := generateID(text)
+				id := base
+				if count := seen[base]; count > 0 {
+					id = fmt.Sprintf("%s-%d", base, count+1)
 				}
-				seen[id]++
+				seen[base]++
 				// Set ID attribute on the heading
 				heading.SetAttributeString("id", []byte(id))
 
@@ -188,53 +236,260 @@ func extractTOC(source []byte, node ast.Node) []TOCItem {
 	return items
 }
 
-// RenderMarkdownWithTOC renders markdown and returns HTML with TOC
-func RenderMarkdownWithTOC(markdown string, themeName string, palette string, fontScale int) (RenderOutput, error) {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Table,
-			extension.Strikethrough,
-			extension.TaskList,
-			extension.Linkify,
-		),
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
+// Renderer turns Markdown into preview pages. The goldmark instance and page template are
+// built once by NewRenderer, and sanitizer policies once per profile; a Renderer is safe
+// for concurrent use.
+type Renderer struct {
+	md       goldmark.Markdown
+	policies policyCache
+	page     *template.Template
+	cache    *renderLRU
+}
+
+// NewRenderer configures a Renderer.
+func NewRenderer() *Renderer {
+	r := &Renderer{
+		md: goldmark.New(
+			goldmark.WithExtensions(
+				extension.GFM,
+				extension.Table,
+				extension.Strikethrough,
+				extension.TaskList,
+				extension.Linkify,
+				admonitions,
+				emojis,
+				repoRefs,
+				wikiLinks,
+				diagrams,
+				sourceLines,
+			),
+			goldmark.WithRendererOptions(
+				html.WithUnsafe(),
+			),
+			goldmark.WithParserOptions(
+				parser.WithAutoHeadingID(),
+			),
 		),
-	)
+		cache: newRenderLRU(renderCacheSize),
+	}
+	r.page = template.Must(template.New("page").Parse(pageTemplate))
+	return r
+}
 
-	source := []byte(markdown)
-	doc := md.Parser().Parse(text.NewReader(source))
+// sharedRenderer is the Renderer behind the package-level Render functions.
+var sharedRenderer = sync.OnceValue(NewRenderer)
 
-	// Extract TOC before rendering
-	toc := extractTOC(source, doc)
+// RenderMarkdownWithTOC renders markdown and returns HTML with TOC
+func RenderMarkdownWithTOC(markdown string, themeName string, palette string, fontScale int) (RenderOutput, error) {
+	return RenderDocumentWithTOC(markdown, "", themeName, palette, fontScale)
+}
 
-	var buf bytes.Buffer
-	if err := md.Renderer().Render(&buf, source, doc); err != nil {
-		return RenderOutput{}, err
-	}
+// RenderDocumentWithTOC renders markdown read from docPath. The path lets extensions resolve
+// things relative to the file, such as the enclosing git repository; it may be empty.
+func RenderDocumentWithTOC(markdown string, docPath string, themeName string, palette string, fontScale int) (RenderOutput, error) {
+	return sharedRenderer().Render(markdown, docPath, themeName, palette, fontScale)
+}
 
-	layoutCSS := themeCSSByName(themeName)
+// Render renders markdown read from docPath (which may be empty) into a full page, sanitizing
+// raw HTML with the profile configured for the document's folder.
+// Rendered bodies are cached, so switching theme or palette, or back to a recent file, is
+// instant. The page around the body is built on every call, so each gets its own script nonce.
+func (r *Renderer) Render(markdown string, docPath string, themeName string, palette string, fontScale int) (RenderOutput, error) {
+	profile := keyInputs.profile(docPath)
 	pMode := normalizePalette(palette)
-	palCSS := paletteCSSByMode(pMode)
+	layoutCSS := themeCSSByName(themeName, pMode)
+	fontScale = clampFontScale(fontScale)
+
+	key := newRenderCacheKey(markdown, docPath, profile)
+	doc, ok := r.cache.get(key)
+	if !ok {
+		var err error
+		if doc, err = r.renderDocument(markdown, docPath, profile); err != nil {
+			return RenderOutput{}, err
+		}
+		r.cache.put(key, doc)
+	}
+	return r.wrapDocument(doc, layoutCSS, pMode, fontScale)
+}
+
+func clampFontScale(fontScale int) int {
 	if fontScale < 50 {
-		fontScale = 50
+		return 50
 	}
 	if fontScale > 200 {
-		fontScale = 200
+		return 200
 	}
+	return fontScale
+}
 
-	baseCSS := fmt.Sprintf("body{margin:0}img{max-width:100%%}pre{overflow:auto}#wrapper{font-size:%d%% !important;padding:32px;max-width:900px;margin:0 auto;font-family:-apple-system,BlinkMacSystemFont,Segoe UI,Roboto,Oxygen,Ubuntu,Cantarell,Helvetica Neue,Arial,sans-serif;line-height:1.55}pre{padding:12px;border-radius:8px}code{padding:2px 4px;border-radius:6px}blockquote{margin:0 0 16px 0;padding:0 0 0 14px}table{width:100%%}.mermaid{text-align:center;margin:16px 0}", fontScale)
+// CacheStats reports the Renderer's cache hit/miss counters.
+func (r *Renderer) CacheStats() RenderCacheStats {
+	return r.cache.stats()
+}
+
+// renderedDocument is a rendered body with the state its page needs. It is what the render
+// cache keeps; output has everything but the page's HTML.
+type renderedDocument struct {
+	body   string
+	state  *renderState
+	output RenderOutput
+}
+
+// renderDocument renders markdown to a body, without the page around it.
+func (r *Renderer) renderDocument(markdown string, docPath string, profile htmlProfile) (renderedDocument, error) {
+	st := r.newRenderState(profile)
+	body, blocks, toc, err := r.renderBody(markdown, docPath, st)
+	if err != nil {
+		return renderedDocument{}, err
+	}
+	return renderedDocument{
+		body:  body,
+		state: st,
+		output: RenderOutput{
+			TOC:           toc,
+			Blocks:        blocks,
+			ClientScripts: st.clientScripts,
+			Removed:       st.removed.items(),
+			Sanitized:     st.removed.blocks,
+		},
+	}, nil
+}
+
+// wrapDocument builds the page around a rendered document.
+func (r *Renderer) wrapDocument(doc renderedDocument, layoutCSS string, pMode paletteMode, fontScale int) (RenderOutput, error) {
+	page, err := r.renderPage(doc.body, doc.state, layoutCSS, pMode, fontScale, "")
+	if err != nil {
+		return RenderOutput{}, err
+	}
+	output := doc.output
+	output.HTML = page
+	return output, nil
+}
+
+// renderState carries the sanitizer policy and the heading and block IDs used so far through
+// the pieces of a document that is rendered progressively. clientScripts records whether
+// any piece needs the preview's scripts, removed what the sanitizer took out, and lineOffset
+// where the piece being rendered starts in the document. refs are link reference
+// definitions from the whole document and diagrams counts the diagrams numbered so far.
+type renderState struct {
+	policy        *bluemonday.Policy
+	headingIDs    map[string]int
+	blockIDs      map[string]int
+	clientScripts bool
+	removed       removalReport
+	lineOffset    int
+	refs          []parser.Reference
+	diagrams      int
+}
+
+func (r *Renderer) newRenderState(profile htmlProfile) *renderState {
+	return &renderState{
+		policy:     r.policies.get(profile),
+		headingIDs: map[string]int{},
+		blockIDs:   map[string]int{},
+	}
+}
 
-	// Add Mermaid.js library and initialization
-	// Goldmark renders fenced blocks as: <pre><code class="language-mermaid">...</code></pre>
-	// Mermaid expects diagram text inside an element with class="mermaid".
-	// So we rewrite those code blocks into <div class="mermaid">...</div> and then render.
-		mermaidScript := `<script src='https://cdn.jsdelivr.net/npm/mermaid@11/dist/mermaid.min.js'></script>
-<script>
+// parse parses source, read from docPath, with the context the extensions look for. st,
+// when not nil, carries what earlier pieces of the document left for this one.
+func (r *Renderer) parse(source []byte, docPath string, lines *lineIndex, st *renderState) ast.Node {
+	pc := parser.NewContext()
+	pc.Set(repoBaseURLKey, keyInputs.repoURL(docPath))
+	pc.Set(wikiResolverKey, newWikiResolver(docPath))
+	pc.Set(lineIndexKey, lines)
+	if st != nil {
+		pc.Set(lineOffsetKey, st.lineOffset)
+		pc.Set(diagramCountKey, &st.diagrams)
+		for _, ref := range st.refs {
+			pc.AddReference(ref)
+		}
+	}
+	return r.md.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+}
+
+// renderBody renders markdown to sanitized, block-wrapped HTML without the surrounding page.
+func (r *Renderer) renderBody(markdown string, docPath string, st *renderState) (string, []RenderedBlock, []TOCItem, error) {
+	source := []byte(markdown)
+	lines := newLineIndex(source)
+	doc := r.parse(source, docPath, lines, st)
+
+	// Extract TOC before rendering
+	toc := extractTOC(source, doc, st.headingIDs)
+	st.clientScripts = st.clientScripts || needsClientScripts(source, doc)
+
+	// Render each top-level block on its own so the preview can patch changed blocks in place.
+	var blocks []RenderedBlock
+	var body strings.Builder
+	prevEnd := 0
+	for _, group := range blockGroups(doc, source) {
+		var buf bytes.Buffer
+		for _, n := range group {
+			if err := r.md.Renderer().Render(&buf, source, n); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		raw := buf.String()
+		blockHTML := raw
+		if st.policy != nil {
+			blockHTML = st.policy.Sanitize(raw)
+		}
+		sanitized := blockHTML
+		for _, n := range group {
+			blockHTML = injectDiagrams(blockHTML, n)
+		}
+		first, last := groupLines(group, lines, prevEnd)
+		prevEnd = last
+		block := RenderedBlock{HTML: blockHTML, Line: first + st.lineOffset, EndLine: last + st.lineOffset}
+		block.ID = blockID(blockHTML, block.Line, st.blockIDs)
+		if sanitized != raw {
+			st.removed.add(block.ID, raw, sanitized)
+		}
+		blocks = append(blocks, block)
+		body.WriteString(wrapBlock(block))
+	}
+	return body.String(), blocks, toc, nil
+}
+
+// renderPage wraps a rendered body in the preview page with its styles, its Content Security
+// Policy and, when st says they are needed, its scripts. overrideCSS follows the palette.
+func (r *Renderer) renderPage(body string, st *renderState, layoutCSS string, pMode paletteMode, fontScale int, overrideCSS string) (string, error) {
+	css := fmt.Sprintf(baseCSSFormat, fontScale) + admonitionCSS + diagramCSS + blockCSS + layoutCSS + paletteCSSByMode(pMode) + overrideCSS
+
+	var nonce string
+	if st.clientScripts {
+		var err error
+		if nonce, err = newScriptNonce(); err != nil {
+			return "", err
+		}
+	}
+
+	var out bytes.Buffer
+	if err := r.page.Execute(&out, map[string]any{
+		"CSP":     contentSecurityPolicy(nonce, st.policy == nil),
+		"CSS":     template.CSS(css),
+		"Scripts": st.clientScripts,
+		"Nonce":   nonce,
+		"Palette": string(pMode),
+		"Body":    template.HTML(body),
+	}); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func RenderMarkdownToHTMLDocument(markdown string, themeName string, palette string, fontScale int) (string, error) {
+	output, err := RenderMarkdownWithTOC(markdown, themeName, palette, fontScale)
+	return output.HTML, err
+}
+
+const baseCSSFormat = "body{margin:0}img{max-width:100%%}pre{overflow:auto}#wrapper{font-size:%d%% !important;padding:32px;max-width:900px;margin:0 auto;font-family:-apple-system,BlinkMacSystemFont,Segoe UI,Roboto,Oxygen,Ubuntu,Cantarell,Helvetica Neue,Arial,sans-serif;line-height:1.55}pre{padding:12px;border-radius:8px}code{padding:2px 4px;border-radius:6px}blockquote{margin:0 0 16px 0;padding:0 0 0 14px}table{width:100%%}.mermaid{text-align:center;margin:16px 0}.wikilink-missing{color:#cf222e;border-bottom:1px dashed currentColor;cursor:help}"
+
+// mermaidScript loads the Mermaid.js library and renders diagrams in the preview.
+// Goldmark renders fenced blocks as: <pre><code class="language-mermaid">...</code></pre>
+// Mermaid expects diagram text inside an element with class="mermaid".
+// So we rewrite those code blocks into <div class="mermaid">...</div> and then render.
+const mermaidScript = `<script nonce="{{.Nonce}}" src='https://cdn.jsdelivr.net/npm/mermaid@11/dist/mermaid.min.js'></script>
+<script nonce="{{.Nonce}}">
 (function() {
   function renderMermaid() {
     try {
@@ -267,6 +522,11 @@ func RenderMarkdownWithTOC(markdown string, themeName string, palette string, fo
         } catch (_) {
           mermaidTheme = 'default';
         }
+        // A theme package may name the Mermaid theme that suits it.
+        try {
+          var themed = getComputedStyle(document.documentElement).getPropertyValue('--mdr-mermaid-theme').trim();
+          if (themed) mermaidTheme = themed;
+        } catch (_) {}
       }
 
       mermaid.initialize({
@@ -287,6 +547,9 @@ func RenderMarkdownWithTOC(markdown string, themeName string, palette string, fo
     }
   }
 
+  // Called by the app after patching blocks into the page.
+  window.mdrRenderMermaid = renderMermaid;
+
   if (document.readyState === 'loading') {
     document.addEventListener('DOMContentLoaded', renderMermaid);
   } else {
@@ -295,33 +558,5 @@ func RenderMarkdownWithTOC(markdown string, themeName string, palette string, fo
 })();
 </script>`
 
-	page := fmt.Sprintf("<!DOCTYPE html><html><head><meta charset=\"utf-8\"/><meta name=\"viewport\" content=\"width=device-width,initial-scale=1\"/><style>%s%s%s</style>%s</head><body class=\"palette-%s\"><div id=\"wrapper\">{{.Body}}</div></body></html>", baseCSS, layoutCSS, palCSS, mermaidScript, pMode)
-	if updated, err := applyCSP(page); err == nil {
-		page = updated
-	}
-
-	tmpl, err := template.New("page").Parse(page)
-	if err != nil {
-		return RenderOutput{}, err
-	}
-
-	var out bytes.Buffer
-	bodyHTML := buf.String()
-	if !allowUnsafeHTML() {
-		bodyHTML = sanitizer().Sanitize(bodyHTML)
-	}
-
-	if err := tmpl.Execute(&out, map[string]any{"Body": template.HTML(bodyHTML)}); err != nil {
-		return RenderOutput{}, err
-	}
-
-	return RenderOutput{
-		HTML: out.String(),
-		TOC:  toc,
-	}, nil
-}
-
-func RenderMarkdownToHTMLDocument(markdown string, themeName string, palette string, fontScale int) (string, error) {
-	output, err := RenderMarkdownWithTOC(markdown, themeName, palette, fontScale)
-	return output.HTML, err
-}
+// pageTemplate wraps the rendered body; the CSP, CSS, scripts and palette class vary per render.
+const pageTemplate = `<!DOCTYPE html><html><head><meta http-equiv="Content-Security-Policy" content="{{.CSP}}"><meta charset="utf-8"/><meta name="viewport" content="width=device-width,initial-scale=1"/><style>{{.CSS}}</style>{{if .Scripts}}` + mermaidScript + `{{end}}</head><body class="palette-{{.Palette}}"><div id="wrapper">{{.Body}}</div></body></html>`
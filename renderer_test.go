@@ -1,8 +1,22 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 func TestRenderMarkdownWithTOCDedupAndSanitize(t *testing.T) {
@@ -25,3 +39,1456 @@ func TestRenderMarkdownWithTOCDedupAndSanitize(t *testing.T) {
 		t.Fatalf("HTML should have been sanitized, got: %s", out.HTML)
 	}
 }
+
+func TestRenderMarkdownWithTOCAdmonitions(t *testing.T) {
+	md := "> [!WARNING]\n> Mind the *gap*.\n\n> [!BOGUS]\n> Plain quote.\n"
+	out, err := RenderMarkdownWithTOC(md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+
+	if !strings.Contains(out.HTML, `<div class="markdown-alert markdown-alert-warning">`) {
+		t.Fatalf("expected warning callout, got: %s", out.HTML)
+	}
+	if !strings.Contains(out.HTML, `<p class="markdown-alert-title">Warning</p>`) {
+		t.Fatalf("expected callout title, got: %s", out.HTML)
+	}
+	if strings.Contains(out.HTML, "[!WARNING]") {
+		t.Fatalf("marker text should be removed, got: %s", out.HTML)
+	}
+	if !strings.Contains(out.HTML, "<em>gap</em>") {
+		t.Fatalf("callout body should be rendered, got: %s", out.HTML)
+	}
+	if !strings.Contains(out.HTML, "[!BOGUS]") || !strings.Contains(out.HTML, "<blockquote data-source-line=") {
+		t.Fatalf("unknown markers should stay plain blockquotes, got: %s", out.HTML)
+	}
+}
+
+func TestRenderDocumentWithTOCEmojiAndRepoRefs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gitConfig := "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = git@github.com:acme/widgets.git\n"
+	if err := os.WriteFile(filepath.Join(repo, ".git", "config"), []byte(gitConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	docPath := filepath.Join(repo, "docs", "README.md")
+
+	md := "Ship it :rocket: :not_an_emoji:\n\nFixed #42 with @octo-cat in 1a2b3c4d5e6f, see `#7` and a@b.io.\n"
+	out, err := RenderDocumentWithTOC(md, docPath, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		"Ship it 🚀 :not_an_emoji:",
+		`<a href="https://github.com/acme/widgets/issues/42" class="issue-link" rel="nofollow">#42</a>`,
+		`<a href="https://github.com/octo-cat" class="user-mention" rel="nofollow">@octo-cat</a>`,
+		`<a href="https://github.com/acme/widgets/commit/1a2b3c4d5e6f" class="commit-link" rel="nofollow">1a2b3c4</a>`,
+		"<code>#7</code>",
+	} {
+		if !strings.Contains(out.HTML, want) {
+			t.Fatalf("expected %q in output, got: %s", want, out.HTML)
+		}
+	}
+
+	// Without a repository, references stay plain text.
+	out, err = RenderDocumentWithTOC(md, filepath.Join(t.TempDir(), "x.md"), "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	if strings.Contains(out.HTML, "issue-link") {
+		t.Fatalf("did not expect issue links without a repository, got: %s", out.HTML)
+	}
+}
+
+func TestRemoteWebURL(t *testing.T) {
+	cases := map[string]string{
+		"git@github.com:acme/widgets.git":            "https://github.com/acme/widgets",
+		"https://github.com/acme/widgets.git":        "https://github.com/acme/widgets",
+		"ssh://git@gitlab.example.com/team/repo.git": "https://gitlab.example.com/team/repo",
+		"https://user@github.com/acme/widgets/":      "https://github.com/acme/widgets",
+		"/srv/git/widgets.git":                       "",
+	}
+	for in, want := range cases {
+		if got := remoteWebURL(in); got != want {
+			t.Errorf("remoteWebURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderDocumentWithTOCWikiLinksAndBacklinks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	notes := t.TempDir()
+	write := func(rel, content string) string {
+		p := filepath.Join(notes, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	write(".obsidian/app.json", "{}")
+	index := write("index.md", "See [[Other Note]], [[Other Note#Next Steps|the plan]] and [[Nowhere]].\n")
+	other := write("sub/Other Note.md", "# Next Steps\n")
+	write("journal.md", "Back to [index](index.md).\n\nNothing here.\n")
+
+	md, _ := os.ReadFile(index)
+	out, err := RenderDocumentWithTOC(string(md), index, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	for _, want := range []string{
+		`<a class="wikilink" href="sub/Other%20Note.md" rel="nofollow">Other Note</a>`,
+		`<a class="wikilink" href="sub/Other%20Note.md#next-steps" rel="nofollow">the plan</a>`,
+		`<span class="wikilink wikilink-missing" title="No note named &#34;Nowhere&#34;">Nowhere</span>`,
+	} {
+		if !strings.Contains(out.HTML, want) {
+			t.Fatalf("expected %q in output, got: %s", want, out.HTML)
+		}
+	}
+
+	links := findBacklinks(other)
+	if len(links) != 1 || links[0].Path != index || links[0].Line != 1 {
+		t.Fatalf("unexpected backlinks for other note: %+v", links)
+	}
+	links = findBacklinks(index)
+	if len(links) != 1 || links[0].Title != "journal" || links[0].Context != "Back to [index](index.md)." {
+		t.Fatalf("unexpected backlinks for index: %+v", links)
+	}
+
+	// The index is cached until the watcher reports a note coming or going.
+	before := cachedNoteIndex(notes)
+	nowhere := write("Nowhere.md", "")
+	if cachedNoteIndex(notes) != before {
+		t.Fatalf("expected the cached index to be reused")
+	}
+	invalidateNoteIndexes(nowhere)
+	after := cachedNoteIndex(notes)
+	if after.resolve("Nowhere", notes) != nowhere || after.version == before.version {
+		t.Fatalf("expected a rebuilt index with a new version to find the new note")
+	}
+
+	// The watcher follows the vault's subfolders, so a note created in one is found at once.
+	a := NewApp()
+	if err := a.StartWatchingFile(index); err != nil {
+		t.Fatalf("StartWatchingFile returned error: %v", err)
+	}
+	defer a.StopWatchingFile()
+	if !containsString(a.watcher.WatchList(), filepath.Join(notes, "sub")) {
+		t.Fatalf("expected the vault's subfolders to be watched, got %v", a.watcher.WatchList())
+	}
+	later := write("sub/deeper/Later.md", "")
+	for i := 0; i < 100 && cachedNoteIndex(notes).resolve("Later", notes) != later; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if cachedNoteIndex(notes).resolve("Later", notes) != later {
+		t.Fatalf("expected a note created in a new subfolder to be indexed before the index expires")
+	}
+}
+
+func TestExpandIncludes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	main := write("spec.md", "# Spec\n\n![[chapter1]]\n\n<!-- include: chapter2.md -->\n\n```\n![[chapter1]]\n```\n")
+	ch1 := write("chapter1.md", "# Overview\n\nFirst.\n")
+	ch2 := write("chapter2.md", "# Overview\n\n![[spec.md]]\n")
+
+	src, _ := os.ReadFile(main)
+	expanded, includes := expandIncludes(string(src), main)
+	if len(includes) != 2 || includes[0] != ch1 || includes[1] != ch2 {
+		t.Fatalf("unexpected includes: %v", includes)
+	}
+	if !strings.Contains(expanded, "First.") {
+		t.Fatalf("chapter1 should be spliced in, got: %s", expanded)
+	}
+	if !strings.Contains(expanded, "Include cycle") {
+		t.Fatalf("expected cycle to be reported, got: %s", expanded)
+	}
+	if !strings.Contains(expanded, "```\n![[chapter1]]\n```") {
+		t.Fatalf("directives inside code fences must be left alone, got: %s", expanded)
+	}
+
+	out, err := RenderDocumentWithTOC(expanded, main, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	if len(out.TOC) != 3 || out.TOC[1].ID != "overview" || out.TOC[2].ID != "overview-2" {
+		t.Fatalf("included headings should be merged into the TOC: %+v", out.TOC)
+	}
+	if !strings.Contains(out.HTML, `markdown-alert-caution`) {
+		t.Fatalf("include errors should render as a callout, got: %s", out.HTML)
+	}
+
+	// Only Markdown files at relative paths can be included.
+	write("notes.txt", "secret\n")
+	for _, target := range []string{"/etc/passwd", "~/.ssh/id_rsa", filepath.Join(dir, "chapter1.md"), "notes.txt"} {
+		expanded, includes := expandIncludes("<!-- include: "+target+" -->\n", main)
+		if len(includes) != 0 || strings.Contains(expanded, "secret") || !strings.Contains(expanded, "only Markdown files") {
+			t.Fatalf("expected the include of %s to be rejected, got %v: %s", target, includes, expanded)
+		}
+	}
+
+	// A fence with an info string inside a code block does not close it.
+	fenced := "```\n```python\n![[chapter1]]\n```\n"
+	if expanded, _ := expandIncludes(fenced, main); expanded != fenced {
+		t.Fatalf("directives after an inner opening fence must be left alone, got: %s", expanded)
+	}
+
+	// Including the same chapter many times stops at the file size limit.
+	write("leaf.md", strings.Repeat("x", 64*1024)+"\n")
+	write("mid.md", strings.Repeat("![[leaf]]\n\n", 10))
+	fan := write("fan.md", strings.Repeat("![[mid]]\n\n", 10))
+	src, _ = os.ReadFile(fan)
+	expanded, _ = expandIncludes(string(src), fan)
+	if int64(len(expanded)) > getMaxFileBytesFromConfig()+4096 || !strings.Contains(expanded, "would exceed the file size limit") {
+		t.Fatalf("expected the expansion to stop at the size limit, got %d bytes", len(expanded))
+	}
+}
+
+type fakeDiagramRenderer struct {
+	available bool
+	svg       string
+}
+
+func (r *fakeDiagramRenderer) Name() string                         { return "fake engine" }
+func (r *fakeDiagramRenderer) Available() bool                      { return r.available }
+func (r *fakeDiagramRenderer) Render(source []byte) ([]byte, error) { return []byte(r.svg), nil }
+
+func TestRenderMarkdownWithTOCDiagrams(t *testing.T) {
+	registerDiagramRenderer(&fakeDiagramRenderer{
+		available: true,
+		svg:       `<?xml version="1.0"?><svg viewBox="0 0 10 10" onload="alert(1)"><script>alert(2)</script><rect width="10" height="10"/></svg>`,
+	}, "fake-ok")
+	registerDiagramRenderer(&fakeDiagramRenderer{}, "fake-missing")
+	defer delete(diagramRenderers, "fake-ok")
+	defer delete(diagramRenderers, "fake-missing")
+
+	md := "```fake-ok\nA -> B\n```\n\n```fake-missing\nA -> <B>\n```\n\n```chart\ntype: pie\ntitle: Share\nGo: 3\nJS: 1\n```\n"
+	out, err := RenderMarkdownWithTOC(md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+
+	if !strings.Contains(out.HTML, `<div class="diagram diagram-fake-ok" id="mdr-diagram-0"><svg viewbox="0 0 10 10"><rect width="10" height="10"/></svg></div>`) {
+		t.Fatalf("expected sanitized inline SVG, got: %s", out.HTML)
+	}
+	if strings.Contains(out.HTML, "alert(1)") || strings.Contains(out.HTML, "alert(2)") {
+		t.Fatalf("diagram SVG should be sanitized, got: %s", out.HTML)
+	}
+	if !strings.Contains(out.HTML, "Cannot render fake-missing diagram: fake engine is not installed or not on PATH.") ||
+		!strings.Contains(out.HTML, "A -&gt; &lt;B&gt;") {
+		t.Fatalf("expected an error block with the diagram source, got: %s", out.HTML)
+	}
+	if !strings.Contains(out.HTML, `<div class="diagram diagram-chart" id="mdr-diagram-2"><svg`) || !strings.Contains(out.HTML, "Go (75%)") {
+		t.Fatalf("expected built-in chart SVG, got: %s", out.HTML)
+	}
+	// Diagram blocks span their fences, like the code blocks they replace.
+	out, err = RenderMarkdownWithTOC("Intro\n\n```chart\nA: 1\n```\n\nAfter\n", "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	if b := out.Blocks[1]; b.Line != 3 || b.EndLine != 5 || out.Blocks[2].Line != 7 {
+		t.Fatalf("expected the chart on lines 3-5, got %+v", out.Blocks)
+	}
+
+	// Raw HTML copying a placeholder can't take a diagram's SVG.
+	t.Setenv("MDR_UNSAFE_HTML", "1")
+	spoof := `<div class="diagram diagram-chart" id="mdr-diagram-0"></div>`
+	out, err = RenderMarkdownWithTOC("> "+spoof+"\n>\n> ```chart\n> A: 1\n> ```\n", "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	if !strings.Contains(out.HTML, spoof) || strings.Count(out.HTML, "<svg") != 1 || strings.Index(out.HTML, "<svg") < strings.Index(out.HTML, spoof) {
+		t.Fatalf("expected the SVG in the real placeholder only:\n%s", out.HTML)
+	}
+
+	for _, v := range []string{"NaN", "Inf", "-inf"} {
+		if _, err := parseChart([]byte("A: 1\nB: " + v + "\n")); err == nil || !strings.Contains(err.Error(), "line 2:") {
+			t.Fatalf("expected %s to be rejected on line 2, got %v", v, err)
+		}
+	}
+}
+
+func TestRenderDocumentWithTOCCache(t *testing.T) {
+	md := "# Cached\n\nSome *text*.\n"
+	before := sharedRenderer().CacheStats()
+
+	first, err := RenderMarkdownWithTOC(md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	first.TOC[0].Text = "mutated"
+	second, err := RenderMarkdownWithTOC(md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	if second.HTML != first.HTML || second.TOC[0].Text != "Cached" {
+		t.Fatalf("cached render should match and be unaffected by callers: %+v", second.TOC)
+	}
+	dark, err := RenderMarkdownWithTOC(md, "default", "dark", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	if dark.HTML == first.HTML || !strings.Contains(dark.HTML, "palette-dark") {
+		t.Fatalf("a cached body should still get the page for the new palette")
+	}
+
+	after := sharedRenderer().CacheStats()
+	if after.Hits-before.Hits != 2 || after.Misses-before.Misses != 1 {
+		t.Fatalf("unexpected cache counters: before %+v, after %+v", before, after)
+	}
+
+	c := newRenderLRU(2)
+	keys := []renderCacheKey{{notes: 1}, {notes: 2}, {notes: 3}}
+	c.put(keys[0], renderedDocument{body: "a"})
+	c.put(keys[1], renderedDocument{body: "b"})
+	c.get(keys[0])
+	c.put(keys[2], renderedDocument{body: "c"})
+	if _, ok := c.get(keys[1]); ok {
+		t.Fatalf("least recently used entry should have been evicted")
+	}
+	if _, ok := c.get(keys[0]); !ok {
+		t.Fatalf("recently used entry should have been kept")
+	}
+
+	// A note created after the first render turns its missing link into a link.
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "doc.md")
+	missing, err := RenderDocumentWithTOC("See [[Later]].\n", doc, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	later := filepath.Join(dir, "Later.md")
+	if err := os.WriteFile(later, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalidateNoteIndexes(later)
+	found, err := RenderDocumentWithTOC("See [[Later]].\n", doc, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	if !strings.Contains(missing.HTML, `class="wikilink wikilink-missing"`) || !strings.Contains(found.HTML, `<a class="wikilink" href="Later.md"`) {
+		t.Fatalf("expected the new note to invalidate the cached render:\n%s", found.HTML)
+	}
+
+	// Engines and sanitizer profiles are looked up once, until the config or a watched
+	// folder changes.
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	keyInputs.invalidate()
+	defer keyInputs.invalidate()
+	engines := keyInputs.engines()
+	if err := os.WriteFile(filepath.Join(bin, "vl2svg"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if keyInputs.engines() != engines {
+		t.Fatalf("engines should not be searched for again on every render")
+	}
+	keyInputs.invalidate()
+	if after := keyInputs.engines(); !strings.Contains(after, "vega-lite") || strings.Contains(engines, "vega-lite") {
+		t.Fatalf("expected a new engine after invalidating, got %q then %q", engines, after)
+	}
+	if p := keyInputs.profile(doc); p.Name != htmlProfileStandard {
+		t.Fatalf("expected the standard profile, got %+v", p)
+	}
+	conf := filepath.Join(os.Getenv("HOME"), ".config", "mdr", "mdr.conf")
+	if err := os.MkdirAll(filepath.Dir(conf), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("htmlPolicy=strict\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p := keyInputs.profile(doc); p.Name != htmlProfileStrict {
+		t.Fatalf("a config change should be picked up, got %+v", p)
+	}
+}
+
+func TestRenderFilePatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "doc.md")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# Title\n\nFirst.\n\n<details>\n\nHidden *text*.\n\n</details>\n\nLast.\n")
+
+	a := NewApp()
+	first, err := a.RenderFilePatch(path, "default", "light")
+	if err != nil {
+		t.Fatalf("RenderFilePatch returned error: %v", err)
+	}
+	if !first.Full || !strings.Contains(first.HTML, `<div class="mdr-block" data-block="`) {
+		t.Fatalf("first render should be a full page with block wrappers, got: %+v", first)
+	}
+	if len(first.Blocks) != 0 {
+		t.Fatalf("full renders should not carry blocks: %+v", first.Blocks)
+	}
+
+	write("# Title\n\nFirst, edited.\n\n<details>\n\nHidden *text*.\n\n</details>\n\nLast.\n")
+	second, err := a.RenderFilePatch(path, "default", "light")
+	if err != nil {
+		t.Fatalf("RenderFilePatch returned error: %v", err)
+	}
+	if second.Full || len(second.Blocks) != 4 {
+		t.Fatalf("expected a 4-block patch (raw <details> grouped), got: %+v", second)
+	}
+	var changed []string
+	for _, b := range second.Blocks {
+		if b.HTML != "" {
+			changed = append(changed, b.HTML)
+		}
+	}
+	if len(changed) != 1 || !strings.Contains(changed[0], "First, edited.") {
+		t.Fatalf("only the edited paragraph should be sent, got: %q", changed)
+	}
+	if len(first.Changed) != 0 || len(second.Changed) != 1 || second.Changed[0].Kind != "modified" || second.Changed[0].BlockID != second.Blocks[1].ID {
+		t.Fatalf("the edited paragraph should be reported as modified, got %+v then %+v", first.Changed, second.Changed)
+	}
+
+	third, err := a.RenderFilePatch(path, "default", "dark")
+	if err != nil {
+		t.Fatalf("RenderFilePatch returned error: %v", err)
+	}
+	if !third.Full || len(third.Changed) != 0 {
+		t.Fatalf("a palette change should send the full page with nothing changed")
+	}
+
+	write("# Title\n\nFirst, edited.\n\nInserted.\n\n<details>\n\nHidden *text*.\n\n</details>\n\nLast.\n")
+	fourth, err := a.RenderFilePatch(path, "default", "dark")
+	if err != nil {
+		t.Fatalf("RenderFilePatch returned error: %v", err)
+	}
+	if len(fourth.Changed) != 1 || fourth.Changed[0].Kind != "inserted" || fourth.Changed[0].BlockID != fourth.Blocks[2].ID {
+		t.Fatalf("the new paragraph should be reported as inserted, got %+v", fourth.Changed)
+	}
+}
+
+func TestRendererConcurrentUse(t *testing.T) {
+	r := NewRenderer()
+	md := "# Heading\n\nSome **bold** text and a [link](https://example.com).\n\n<script>alert('x')</script>\n"
+	page, err := r.Render(md, "", "default", "dark", 110)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if !strings.Contains(page.HTML, "font-size:110% !important") || strings.Contains(page.HTML, "alert('x')") {
+		t.Fatalf("unexpected page: %s", page.HTML)
+	}
+	profile := htmlProfile{Name: htmlProfileStandard, Base: htmlProfileStandard}
+	want, _, _, err := r.renderBody(md, "", r.newRenderState(profile))
+	if err != nil {
+		t.Fatalf("renderBody returned error: %v", err)
+	}
+
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for j := 0; j < 20; j++ {
+				// Render bodies directly, so every call parses instead of hitting the cache.
+				got, _, _, err := r.renderBody(md, "", r.newRenderState(profile))
+				if err == nil && got != want {
+					err = fmt.Errorf("concurrent render differs")
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func benchmarkRender(b *testing.B, md string) {
+	r := NewRenderer()
+	profile := htmlProfile{Name: htmlProfileStandard, Base: htmlProfileStandard}
+	b.SetBytes(int64(len(md)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Bypass the cache so every iteration parses and renders.
+		if _, _, _, err := r.renderBody(md, "", r.newRenderState(profile)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderSmall(b *testing.B) {
+	benchmarkRender(b, "# Notes\n\nA short paragraph with *emphasis*, `code` and a [link](https://example.com).\n\n- one\n- two\n- three\n")
+}
+
+func BenchmarkRenderLarge(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&sb, "## Section %d\n\nParagraph %d with **bold**, _italic_, ~~struck~~ text, :tada: and a [link](https://example.com/%d).\n\n", i, i, i)
+		sb.WriteString("> [!NOTE]\n> A callout.\n\n- [x] done\n- [ ] todo\n\n```go\nfunc main() {}\n```\n\n")
+	}
+	benchmarkRender(b, sb.String())
+}
+
+func BenchmarkRenderTables(b *testing.B) {
+	var sb strings.Builder
+	for t := 0; t < 20; t++ {
+		fmt.Fprintf(&sb, "### Table %d\n\n| Name | Count | Share | Notes |\n|:-----|------:|:-----:|-------|\n", t)
+		for row := 0; row < 50; row++ {
+			fmt.Fprintf(&sb, "| item-%d | %d | %d%% | *note* `%d` |\n", row, row*t, row%100, row)
+		}
+		sb.WriteString("\n")
+	}
+	benchmarkRender(b, sb.String())
+}
+
+func TestRenderProgressive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "intro.md"), []byte("Included\n\nintro\n\ntext.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	sb.WriteString("<!-- include: intro.md -->\n\n")
+	for i := 0; i < 60; i++ {
+		fmt.Fprintf(&sb, "## Release\n\n```\n## not a heading %d\n```\n\nSee [1.%d].\n\n```chart\ntype: pie\nA: 1\n```\n\n%s\n\n", i, i, strings.Repeat("Change entry. ", 400))
+	}
+	// Keep a Changelog puts the version links at the very end.
+	for i := 0; i < 60; i++ {
+		fmt.Fprintf(&sb, "[1.%d]: https://example.com/1.%d\n", i, i)
+	}
+	path := filepath.Join(dir, "CHANGELOG.md")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expanded, _ := expandIncludes(sb.String(), path)
+
+	a := NewApp()
+	chunks := make(chan RenderChunk, 100)
+	res, err := a.renderProgressive(path, "default", "light", a.nextRenderGeneration(), func(c RenderChunk) { chunks <- c })
+	if err != nil {
+		t.Fatalf("renderProgressive returned error: %v", err)
+	}
+	if !res.Partial || len(res.TOC) == 0 || len(res.TOC) >= 60 {
+		t.Fatalf("expected a partial first page, got %d headings (partial=%v)", len(res.TOC), res.Partial)
+	}
+	if !strings.Contains(res.HTML, `<div id="wrapper">`) {
+		t.Fatalf("first chunk should be a full page")
+	}
+
+	toc := res.TOC
+	html := res.HTML
+	for c := range chunks {
+		if c.Error != "" {
+			t.Fatalf("chunk error: %s", c.Error)
+		}
+		toc = append(toc, c.TOC...)
+		for _, b := range c.Blocks {
+			html += wrapBlock(b)
+		}
+		if c.Done {
+			if c.CharCount != len(expanded) {
+				t.Fatalf("expected %d chars in total, got %d", len(expanded), c.CharCount)
+			}
+			break
+		}
+	}
+	if len(toc) != 60 || toc[0].ID != "release" || toc[59].ID != "release-60" {
+		t.Fatalf("headings should be unique across chunks: %d items, last %+v", len(toc), toc[len(toc)-1])
+	}
+	if a.currentDocument != expanded {
+		t.Fatalf("search should cover the whole document once streaming is done")
+	}
+	full, err := RenderDocumentWithTOC(expanded, path, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	sourceLine := regexp.MustCompile(`data-source-line="\d+"`)
+	if got, want := sourceLine.FindAllString(html, -1), sourceLine.FindAllString(full.HTML, -1); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("chunks should carry the source lines of a full render:\n%v\n%v", got, want)
+	}
+	if !strings.Contains(html, `<a href="https://example.com/1.0"`) || !strings.Contains(html, `<a href="https://example.com/1.59"`) {
+		t.Fatalf("link references at the end should resolve in every chunk")
+	}
+	if !strings.Contains(html, `id="mdr-diagram-59"`) || strings.Count(html, `id="mdr-diagram-0"`) != 1 {
+		t.Fatalf("diagrams should be numbered across chunks")
+	}
+
+	// Reloads of a file this large stream in again instead of being patched.
+	conf := filepath.Join(os.Getenv("HOME"), ".config", "mdr", "mdr.conf")
+	if err := os.MkdirAll(filepath.Dir(conf), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("progressiveRenderKB=64\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	patch, err := a.RenderFilePatch(path, "default", "light")
+	if err != nil || !patch.Progressive || patch.Full || len(patch.Blocks) != 0 {
+		t.Fatalf("expected a progressive reload instead of a patch, got %+v (%v)", patch.Progressive, err)
+	}
+}
+
+func TestHTMLProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("MDR_UNSAFE_HTML", "")
+	conf := strings.Join([]string{
+		"htmlPolicy=strict",
+		"htmlPolicyDirs=~/team|trusted,~/team/inbox|standard,~/notes|notes",
+		"htmlPolicy.notes.base=strict",
+		"htmlPolicy.notes.elements=kbd",
+		"htmlPolicy.notes.attrs=lang align@p",
+	}, "\n")
+	if err := os.MkdirAll(filepath.Join(home, ".config", "mdr"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".config", "mdr", "mdr.conf"), []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	md := "| a |\n|:-:|\n| 1 |\n\n- [x] done\n\n<details><summary>More</summary>Body</details>\n\n" +
+		"<p align=\"center\" lang=\"en\" style=\"color:red\" onclick=\"x()\">Styled <kbd>Ctrl</kbd></p>\n\n" +
+		"<script>alert('x')</script>\n\n[bad](javascript:alert(1))\n"
+	render := func(rel string) string {
+		t.Helper()
+		out, err := RenderDocumentWithTOC(md, filepath.Join(home, filepath.FromSlash(rel)), "default", "light", 100)
+		if err != nil {
+			t.Fatalf("RenderDocumentWithTOC(%s) returned error: %v", rel, err)
+		}
+		return out.HTML
+	}
+	check := func(name, html string, want, reject []string) {
+		t.Helper()
+		for _, w := range want {
+			if !strings.Contains(html, w) {
+				t.Errorf("%s: expected %q in output", name, w)
+			}
+		}
+		for _, r := range reject {
+			if strings.Contains(html, r) {
+				t.Errorf("%s: %q should have been stripped", name, r)
+			}
+		}
+	}
+
+	// Markdown's own output survives every profile.
+	common := []string{`<th style="text-align: center">a</th>`, `<input checked="" disabled="" type="checkbox"`}
+	unsafe := []string{"alert('x')", `onclick=`, `javascript:`}
+
+	check("strict", render("misc/doc.md"), common,
+		append([]string{"<details>", "<kbd>", `style="color:red"`, `align="center"`}, unsafe...))
+	check("standard", render("team/inbox/doc.md"), append([]string{"<details>", "<summary>", `<p lang="en">Styled Ctrl</p>`}, common...),
+		append([]string{`style="color`}, unsafe...))
+	check("trusted", render("team/doc.md"), []string{"<script>alert('x')</script>", `onclick="x()"`, `<th style="text-align:center">a</th>`}, nil)
+	check("custom", render("notes/doc.md"), append([]string{`<p align="center" lang="en">`, "<kbd>Ctrl</kbd>"}, common...),
+		append([]string{"<details>", `style="color`}, unsafe...))
+
+	t.Setenv("MDR_UNSAFE_HTML", "true")
+	check("env override", render("misc/doc.md"), []string{"<script>alert('x')</script>"}, nil)
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("MDR_UNSAFE_HTML", "")
+	cspPattern := regexp.MustCompile(`<meta http-equiv="Content-Security-Policy" content="([^"]*)">`)
+	policyOf := func(t *testing.T, html string) string {
+		t.Helper()
+		m := cspPattern.FindStringSubmatch(html)
+		if m == nil {
+			t.Fatalf("page has no CSP meta tag: %s", html)
+		}
+		return strings.ReplaceAll(m[1], "&#39;", "'")
+	}
+	render := func(t *testing.T, md, docPath string) string {
+		t.Helper()
+		out, err := RenderDocumentWithTOC(md, docPath, "default", "light", 100)
+		if err != nil {
+			t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+		}
+		return out.HTML
+	}
+
+	t.Run("no scripts", func(t *testing.T) {
+		html := render(t, "# Plain\n\nJust text.\n\n```go\nfmt.Println()\n```\n", "")
+		csp := policyOf(t, html)
+		if strings.Contains(csp, "script-src") || !strings.Contains(csp, "default-src 'none'") {
+			t.Fatalf("expected no script-src under default-src 'none', got %q", csp)
+		}
+		if strings.Contains(html, "<script") {
+			t.Fatalf("page without diagrams should carry no scripts")
+		}
+	})
+
+	t.Run("mermaid", func(t *testing.T) {
+		html := render(t, "```mermaid\ngraph TD\n  A --> B\n```\n", "")
+		csp := policyOf(t, html)
+		m := regexp.MustCompile(`script-src 'nonce-([A-Za-z0-9_-]+)'(;|$)`).FindStringSubmatch(csp)
+		if m == nil {
+			t.Fatalf("expected a nonce-only script-src, got %q", csp)
+		}
+		if strings.Contains(csp, "unsafe-inline' https") || strings.Contains(csp, "script-src 'unsafe-inline'") {
+			t.Fatalf("script-src must not allow unsafe-inline, got %q", csp)
+		}
+		scripts := strings.Count(html, "<script")
+		if scripts != 2 || strings.Count(html, `<script nonce="`+m[1]+`"`) != scripts {
+			t.Fatalf("every script tag should carry the nonce %q", m[1])
+		}
+
+		other := policyOf(t, render(t, "```mermaid\ngraph LR\n  C --> D\n```\n", ""))
+		if other == csp {
+			t.Fatalf("different pages should get different nonces")
+		}
+		// The same document again comes from the render cache but still gets a new nonce.
+		if again := policyOf(t, render(t, "```mermaid\ngraph TD\n  A --> B\n```\n", "")); again == csp {
+			t.Fatalf("a cached render should get a fresh nonce")
+		}
+	})
+
+	t.Run("injected script", func(t *testing.T) {
+		html := render(t, "```mermaid\ngraph TD\n```\n\n<script nonce=\"guess\">alert(1)</script>\n", "")
+		if strings.Contains(html, "alert(1)") {
+			t.Fatalf("document scripts must still be sanitized")
+		}
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		conf := "htmlPolicyDirs=" + filepath.Join(home, "trusted") + "|trusted\n"
+		if err := os.MkdirAll(filepath.Join(home, ".config", "mdr"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, ".config", "mdr", "mdr.conf"), []byte(conf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		csp := policyOf(t, render(t, "<script>console.log(1)</script>\n", filepath.Join(home, "trusted", "doc.md")))
+		if !strings.Contains(csp, "script-src 'unsafe-inline'") {
+			t.Fatalf("trusted documents keep inline scripts working, got %q", csp)
+		}
+	})
+}
+
+func TestRenderReportsRemovedContent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("MDR_UNSAFE_HTML", "")
+
+	md := "# Doc\n\nA [link](https://example.com), a table and a task:\n\n| a |\n|:-:|\n| 1 |\n\n- [x] done\n\n" +
+		"<script>alert(1)</script>\n\n<script>alert(2)</script>\n\n" +
+		"<p onclick=\"x()\">Click <a href=\" JavaScript:alert(3)\">here</a> <iframe src=\"https://example.com\"></iframe></p>\n"
+	out, err := RenderDocumentWithTOC(md, "", "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	got := map[string]int{}
+	for _, r := range out.Removed {
+		got[r.Kind+" "+r.Name] = r.Count
+	}
+	want := map[string]int{"element script": 2, "element iframe": 1, "attribute onclick": 1, "url javascript": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Removed = %v, want %v", got, want)
+	}
+	if len(out.Sanitized) != 3 {
+		t.Fatalf("expected the 3 changed blocks in Sanitized, got %d", len(out.Sanitized))
+	}
+	for _, b := range out.Sanitized {
+		if !strings.Contains(out.HTML, `data-block="`+b.BlockID+`"`) {
+			t.Errorf("sanitized block %s is not in the page", b.BlockID)
+		}
+		if b.Before == b.After {
+			t.Errorf("sanitized block %s should differ before and after", b.BlockID)
+		}
+	}
+	if !strings.HasPrefix(describeRemoved(out.Removed), "Sanitizer removed 2× <script>") {
+		t.Errorf("unexpected summary %q", describeRemoved(out.Removed))
+	}
+
+	clean, err := RenderDocumentWithTOC("# Doc\n\nA [link](https://example.com).\n\n| a |\n|:-:|\n| 1 |\n\n- [x] done\n", "", "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderDocumentWithTOC returned error: %v", err)
+	}
+	if len(clean.Removed) != 0 || len(clean.Sanitized) != 0 {
+		t.Fatalf("plain Markdown should report nothing removed, got %v", clean.Removed)
+	}
+}
+
+func TestBlockSourceLines(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	md := "# Title\n\nPara one\ncontinues\n\n---\n\n```go\nx := 1\n```\n\n- a\n- b\n\nSetext\n======\n\nEnd\n"
+	out, err := RenderMarkdownWithTOC(md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	want := [][2]int{{1, 1}, {3, 4}, {6, 6}, {8, 10}, {12, 13}, {15, 16}, {18, 18}}
+	if len(out.Blocks) != len(want) {
+		t.Fatalf("expected %d blocks, got %d", len(want), len(out.Blocks))
+	}
+	for i, b := range out.Blocks {
+		if b.Line != want[i][0] || b.EndLine != want[i][1] {
+			t.Errorf("block %d spans lines %d-%d, want %d-%d", i, b.Line, b.EndLine, want[i][0], want[i][1])
+		}
+	}
+	if !strings.Contains(out.HTML, `data-source-line="8" data-source-end="10"`) {
+		t.Fatalf("block wrappers should carry their source lines")
+	}
+
+	dir := t.TempDir()
+	doc := filepath.Join(dir, "doc.md")
+	if err := os.WriteFile(filepath.Join(dir, "part.md"), []byte("Included\n\ntext\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(doc, []byte("# Doc\n\n![[part]]\n\nAfter\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewApp().GetSource(doc)
+	if err != nil {
+		t.Fatalf("GetSource returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(src.Markdown, "\n"), "\n")
+	if len(src.FileLines) != len(lines) {
+		t.Fatalf("expected a file line for each of the %d source lines, got %v", len(lines), src.FileLines)
+	}
+	for i, line := range lines {
+		if line == "After" && src.FileLines[i] != 5 {
+			t.Errorf("line after the include should map to file line 5, got %d", src.FileLines[i])
+		}
+		if line == "text" && src.FileLines[i] != 3 {
+			t.Errorf("included lines should map to the directive's line 3, got %d", src.FileLines[i])
+		}
+	}
+}
+
+func TestSourceLineAnchors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	md := "# Title\n\n- one\n- two\n\n> quote\n"
+	out, err := RenderMarkdownWithTOC(md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	for _, want := range []string{`<h1 id="title" data-source-line="1">`, `<li data-source-line="4">`, `<blockquote data-source-line="6">`} {
+		if !strings.Contains(out.HTML, want) {
+			t.Errorf("expected %q in output", want)
+		}
+	}
+
+	// Moving blocks down keeps their IDs, so the preview can patch them.
+	shifted, err := RenderMarkdownWithTOC("Intro\n\n\n"+md, "default", "light", 100)
+	if err != nil {
+		t.Fatalf("RenderMarkdownWithTOC returned error: %v", err)
+	}
+	for i, b := range out.Blocks {
+		if got := shifted.Blocks[i+1]; got.ID != b.ID || got.Line != b.Line+3 {
+			t.Errorf("block %d: got ID %s at line %d, want %s at line %d", i, got.ID, got.Line, b.ID, b.Line+3)
+		}
+	}
+}
+
+func TestLaunchArgsAndIPC(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	doc := filepath.Join(dir, "doc.md")
+
+	files, target, err := parseLaunchArgs([]string{"-psn_0_1", "other.md", "--goto", doc + ":120"})
+	if err != nil || target == nil || target.Path != doc || target.Line != 120 {
+		t.Fatalf("unexpected goto target %+v (err %v)", target, err)
+	}
+	if len(files) != 2 || files[0] != doc {
+		t.Fatalf("the goto file should be opened first, got %v", files)
+	}
+	if _, _, err := parseLaunchArgs([]string{"--goto=doc.md"}); err == nil {
+		t.Fatalf("expected an error for a goto target without a line")
+	}
+
+	t.Setenv("MDR_SOCKET", filepath.Join(dir, "mdr.sock"))
+	if err := sendIPC(ipcRequest{Command: "goto", Path: doc, Line: 1}); err == nil {
+		t.Fatalf("sendIPC should fail when no instance is listening")
+	}
+	a := NewApp()
+	if err := a.listenIPC(); err != nil {
+		t.Fatalf("listenIPC returned error: %v", err)
+	}
+	defer a.closeIPC()
+	if err := NewApp().listenIPC(); err == nil {
+		t.Fatalf("a second instance must not take over the socket")
+	}
+	if err := sendIPC(ipcRequest{Command: "goto", Path: doc, Line: 3}); err != nil {
+		t.Fatalf("sendIPC returned error: %v", err)
+	}
+	if err := sendIPC(ipcRequest{Command: "open", Paths: []string{doc}}); err != nil {
+		t.Fatalf("sendIPC open returned error: %v", err)
+	}
+	if args := a.GetLaunchArgs(); len(args) != 1 || args[0] != doc {
+		t.Fatalf("forwarded files should be opened, got %v", args)
+	}
+	big := strings.Repeat("Piped text that is well past the scanner's default line limit.\n", 4096)
+	if err := sendIPC(ipcRequest{Command: "open", Paths: []string{stdinDocPath}, Stdin: big, Dir: dir}); err != nil {
+		t.Fatalf("sendIPC with large stdin returned error: %v", err)
+	}
+	if err := sendIPC(ipcRequest{Command: "explode"}); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("expected an unknown command error, got %v", err)
+	}
+}
+
+func TestVirtualDocuments(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	doc := filepath.Join(dir, "api.md")
+
+	files, _, err := parseLaunchArgs([]string{"-", "--rev", "main", doc})
+	if err != nil || len(files) != 2 || files[0] != stdinDocPath || files[1] != gitDocPath("main", doc) {
+		t.Fatalf("unexpected launch files %v (err %v)", files, err)
+	}
+	if normalizePath(files[1]) != files[1] {
+		t.Fatalf("virtual paths must survive normalizePath")
+	}
+
+	a := NewApp()
+	setStdinDocument("# Piped\n\n[api](api.md)\n", dir)
+	res, err := a.RenderFileWithPaletteAndTOC(stdinDocPath, "default", "light")
+	if err != nil {
+		t.Fatalf("rendering stdin returned error: %v", err)
+	}
+	if !res.ReadOnly || res.Title != "stdin" || len(res.TOC) != 1 || res.TOC[0].Text != "Piped" {
+		t.Fatalf("unexpected stdin render %+v", res)
+	}
+	if p, err := a.ResolveLink(stdinDocPath, "api.md"); err == nil {
+		t.Fatalf("api.md does not exist yet, resolved %q", p)
+	}
+	if err := a.StartWatchingFile(stdinDocPath); err != nil {
+		t.Fatalf("watching a virtual document should be a no-op, got %v", err)
+	}
+	if err := addRecentFile(stdinDocPath); err != nil || len(getRecentFilesFromConfig()) != 0 {
+		t.Fatalf("virtual documents must not be added to the recent files")
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@t", "-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	os.WriteFile(doc, []byte("# Old\n"), 0o644)
+	git("init", "-q", "-b", "main")
+	git("add", "api.md")
+	git("commit", "-q", "-m", "old")
+	os.WriteFile(doc, []byte("# New\n"), 0o644)
+
+	res, err = a.RenderFileWithPaletteAndTOC(gitDocPath("main", doc), "default", "light")
+	if err != nil {
+		t.Fatalf("rendering a revision returned error: %v", err)
+	}
+	if res.Title != "api.md @ main" || len(res.TOC) != 1 || res.TOC[0].Text != "Old" {
+		t.Fatalf("unexpected revision render %+v", res)
+	}
+	if p, err := a.ResolveLink(gitDocPath("main", doc), "api.md"); err != nil || p != doc {
+		t.Fatalf("links in a revision should resolve next to the file, got %q (err %v)", p, err)
+	}
+	if _, err := a.RenderFileWithPaletteAndTOC(gitDocPath("nope", doc), "default", "light"); err == nil {
+		t.Fatalf("expected an error for an unknown revision")
+	}
+	out := filepath.Join(dir, "written")
+	if _, err := a.RenderFileWithPaletteAndTOC(gitDocPath("--output="+out, doc), "default", "light"); err == nil {
+		t.Fatalf("expected an error for a revision that looks like an option")
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Fatalf("an option-like revision reached git")
+	}
+}
+
+func TestRenderDiff(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	oldPath := filepath.Join(dir, "old.md")
+	newPath := filepath.Join(dir, "new.md")
+	os.WriteFile(oldPath, []byte("# Title\n\nKept paragraph.\n\nChanged paragraph.\n\nDropped paragraph.\n\nTail.\n"), 0o644)
+	os.WriteFile(newPath, []byte("# Title\n\nKept paragraph.\n\nChanged paragraph, now longer.\n\nTail.\n\nAdded <b>at</b> the end.\n"), 0o644)
+
+	res, err := NewApp().RenderDiff(oldPath, newPath)
+	if err != nil {
+		t.Fatalf("RenderDiff returned error: %v", err)
+	}
+	var kinds []string
+	for _, c := range res.Changes {
+		kinds = append(kinds, c.Kind+":"+c.Text)
+		if !strings.Contains(res.HTML, `id="`+c.ID+`"`) {
+			t.Fatalf("change %s has no anchor in the page", c.ID)
+		}
+	}
+	want := []string{"modified:Changed paragraph, now longer.", "deleted:Dropped paragraph.", "inserted:Added at the end."}
+	if strings.Join(kinds, "|") != strings.Join(want, "|") {
+		t.Fatalf("unexpected changes %q", kinds)
+	}
+	if res.Changes[0].OldLine != 5 || res.Changes[0].NewLine != 5 || res.Changes[2].OldLine != 0 {
+		t.Fatalf("unexpected change lines %+v", res.Changes)
+	}
+	if strings.Count(res.HTML, `class="diff-row diff-unchanged"`) != 3 {
+		t.Fatalf("expected three unchanged rows in the page")
+	}
+}
+
+func TestDiffBlocks(t *testing.T) {
+	blocks := func(ids string) []RenderedBlock {
+		var out []RenderedBlock
+		for _, id := range strings.Split(ids, " ") {
+			out = append(out, RenderedBlock{ID: id})
+		}
+		return out
+	}
+	kinds := func(rows []diffRow) string {
+		var out []string
+		for _, r := range rows {
+			out = append(out, r.kind[:1])
+		}
+		return strings.Join(out, "")
+	}
+
+	// The first and last blocks changed, so the whole list is aligned.
+	if got := kinds(diffBlocks(blocks("a b c d e f"), blocks("x b c e f y z"))); got != "muuduuii" {
+		t.Fatalf("unexpected alignment %q", got)
+	}
+	if got := changedBlocks([]string{"a", "b"}, blocks("b c")); len(got) != 1 || got[0].BlockID != "c" || got[0].Kind != "inserted" {
+		t.Fatalf("unexpected changed blocks %+v", got)
+	}
+
+	// Two large, unrelated documents fall back to one run of modified blocks.
+	var old, cur []string
+	for i := 0; i < 20000; i++ {
+		old = append(old, fmt.Sprintf("o%d", i))
+		cur = append(cur, fmt.Sprintf("n%d", i))
+	}
+	rows := diffBlocks(blocks(strings.Join(old, " ")), blocks(strings.Join(cur, " ")+" extra"))
+	if len(rows) != 20001 || rows[0].kind != "modified" || rows[20000].kind != "inserted" {
+		t.Fatalf("expected the whole middle to be modified, got %d rows", len(rows))
+	}
+	if got := changedBlocks(old, blocks(strings.Join(cur, " "))); len(got) != 20000 || got[0].Kind != "modified" {
+		t.Fatalf("expected a rewritten file to mark every block as changed, got %d", len(got))
+	}
+}
+
+func TestRenderSlides(t *testing.T) {
+	md := "# Talk\n\nIntro.\n<!-- say hello -->\n\n---\n\n## Part one\n\nSetext\n---\n\n```yaml\n---\n```\n\n<!--\nslow down\n-->\n\n---\n\n## Part two\n\nEnd.\n"
+
+	slides := splitSlides(md, 0)
+	if len(slides) != 3 {
+		t.Fatalf("expected 3 slides split at ---, got %d: %+v", len(slides), slides)
+	}
+	if slides[0].notes[0] != "say hello" || slides[1].notes[0] != "slow down" || slides[1].line != 6 {
+		t.Fatalf("unexpected notes or lines: %+v", slides)
+	}
+	if strings.Contains(slides[0].markdown, "say hello") || strings.Count(slides[0].markdown, "\n") != 5 {
+		t.Fatalf("notes should be blanked out of the slide, keeping its lines: %q", slides[0].markdown)
+	}
+	if got := len(splitSlides("# A\n\ntext\n\n## B\n\n### C\n\n## D\n", 2)); got != 3 {
+		t.Fatalf("expected 3 slides split at level-2 headings, got %d", got)
+	}
+
+	page, deck, err := NewRenderer().RenderSlides(md, "", "default", "light", 100, 0)
+	if err != nil {
+		t.Fatalf("RenderSlides returned error: %v", err)
+	}
+	if strings.Count(page, `<section class="mdr-slide"`) != 3 || strings.Contains(page, "slow down") {
+		t.Fatalf("expected three slide sections without notes")
+	}
+	if deck[1].Title != "Part one" || deck[1].Line != 7 || deck[2].Notes != "" {
+		t.Fatalf("unexpected slides %+v", deck)
+	}
+	if !strings.Contains(page, `<h2 id="part-one" data-source-line="8">`) {
+		t.Fatalf("slide blocks should keep the document's line numbers")
+	}
+}
+
+func TestRenderPrint(t *testing.T) {
+	theme := "body{color:red}@media print{body{color:black}pre{border:0}}@media screen{p{margin:0}}"
+	if got := mediaPrintRules(theme); got != "@media print{body{color:black}pre{border:0}}" {
+		t.Fatalf("unexpected print rules %q", got)
+	}
+	// Lower-casing "İ" makes it longer, which must not shift the blocks found.
+	if got := mediaPrintRules(`h1::before{content:"İİİİ"}@MEDIA PRINT{a{color:black}}`); got != "@MEDIA PRINT{a{color:black}}" {
+		t.Fatalf("unexpected print rules %q", got)
+	}
+
+	md := "See [the docs](https://example.com/docs).\n"
+	page, err := NewRenderer().RenderPrint(md, "", "default", PrintOptions{LinkURLs: true, FontScale: 100})
+	if err != nil {
+		t.Fatalf("RenderPrint returned error: %v", err)
+	}
+	if !strings.Contains(page, "break-inside:avoid") || !strings.Contains(page, `content:" (" attr(href) ")"`) {
+		t.Fatalf("expected the print stylesheet with link URLs")
+	}
+	page, err = NewRenderer().RenderPrint(md, "", "default", PrintOptions{FontScale: 100})
+	if err != nil {
+		t.Fatalf("RenderPrint returned error: %v", err)
+	}
+	if strings.Contains(page, "attr(href)") {
+		t.Fatalf("link URLs should be left out unless asked for")
+	}
+}
+
+func TestRenderEPUB(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pic.png"), []byte("\x89PNG\r\n\x1a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	md := "Preface<br>\n\n# One\n\n![pic](pic.png) ![remote](https://example.com/x.png)\n\n## Two\n\nBack to [one](#one), [elsewhere](other.md).\n\n### Deeper\n\n---\n"
+	book, err := NewRenderer().RenderEPUB(md, filepath.Join(dir, "book.md"), "", "default")
+	if err != nil {
+		t.Fatalf("RenderEPUB returned error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(book), int64(len(book)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	if f := zr.File[0]; f.Name != "mimetype" || f.Method != zip.Store {
+		t.Fatalf("the first entry must be an uncompressed mimetype, got %s", f.Name)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+		if strings.HasSuffix(f.Name, ".xhtml") || strings.HasSuffix(f.Name, ".opf") || strings.HasSuffix(f.Name, ".xml") {
+			d := xml.NewDecoder(strings.NewReader(string(data)))
+			for {
+				if _, err := d.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed XML: %v", f.Name, err)
+				}
+			}
+		}
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/style.css", "OEBPS/chapter-3.xhtml", "OEBPS/images/image-1.png"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("missing %s", name)
+		}
+	}
+	if _, ok := files["OEBPS/chapter-4.xhtml"]; ok {
+		t.Fatalf("H3s should not start chapters")
+	}
+	if !strings.Contains(files["OEBPS/content.opf"], "<dc:title>One</dc:title>") {
+		t.Fatalf("the title should default to the first heading")
+	}
+	if !strings.Contains(files["OEBPS/chapter-2.xhtml"], `src="images/image-1.png"`) || strings.Contains(files["OEBPS/chapter-2.xhtml"], "example.com") {
+		t.Fatalf("expected the local image embedded and the remote one dropped: %s", files["OEBPS/chapter-2.xhtml"])
+	}
+	chapter := files["OEBPS/chapter-3.xhtml"]
+	if !strings.Contains(chapter, `href="chapter-2.xhtml#one"`) || strings.Contains(chapter, "other.md") {
+		t.Fatalf("expected links rewritten for the book: %s", chapter)
+	}
+	if !strings.Contains(files["OEBPS/nav.xhtml"], `<li><a href="chapter-3.xhtml#two">Two</a><ol><li><a href="chapter-3.xhtml#deeper">Deeper</a></li></ol></li>`) {
+		t.Fatalf("expected a nested navigation document: %s", files["OEBPS/nav.xhtml"])
+	}
+}
+
+func TestRenderDOCX(t *testing.T) {
+	dir := t.TempDir()
+	var pic bytes.Buffer
+	if err := png.Encode(&pic, image.NewRGBA(image.Rect(0, 0, 1200, 300))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pic.png"), pic.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	md := "# Report\n\nSome **bold**, *italic* and `code` with [a link](https://example.com/?a=1&b=2) and [back](#report).\n\n" +
+		"3. third\n4. fourth\n   - nested\n\n| Left | Right |\n|:-----|------:|\n| a < b | 2 |\n\n```go\nfunc main() {\n\tprintln()\n}\n```\n\n> quoted from www.example.org\n\n![chart](pic.png)\n"
+	out, err := NewRenderer().RenderDOCX(md, filepath.Join(dir, "report.md"), "")
+	if err != nil {
+		t.Fatalf("RenderDOCX returned error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+		if strings.HasSuffix(f.Name, ".xml") || strings.HasSuffix(f.Name, ".rels") {
+			d := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				if _, err := d.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed XML: %v", f.Name, err)
+				}
+			}
+		}
+	}
+	if _, ok := files["word/media/image1.png"]; !ok {
+		t.Fatalf("expected the local image to be embedded")
+	}
+	doc := files["word/document.xml"]
+	for _, want := range []string{
+		`<w:pStyle w:val="Heading1"/></w:pPr><w:bookmarkStart w:id="1" w:name="report"/>`,
+		`<w:rPr><w:b/></w:rPr><w:t xml:space="preserve">bold</w:t>`,
+		`<w:rPr><w:rStyle w:val="CodeChar"/></w:rPr><w:t xml:space="preserve">code</w:t>`,
+		`<w:hyperlink r:id="rId3" w:history="1">`,
+		`<w:hyperlink w:anchor="report">`,
+		`<w:numPr><w:ilvl w:val="1"/>`,
+		`<w:tblHeader/>`,
+		`<w:jc w:val="right"/>`,
+		`a &lt;</w:t>`,
+		`<w:pStyle w:val="Code"/>`,
+		`<w:br/><w:tab/>`,
+		`<w:pStyle w:val="Quote"/>`,
+		`<wp:extent cx="5486400" cy="1371600"/>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("document.xml is missing %s:\n%s", want, doc)
+		}
+	}
+	if !strings.Contains(files["word/_rels/document.xml.rels"], `Target="https://example.com/?a=1&amp;b=2" TargetMode="External"`) {
+		t.Fatalf("expected an external hyperlink relationship")
+	}
+	if !strings.Contains(files["word/_rels/document.xml.rels"], `Target="http://www.example.org" TargetMode="External"`) {
+		t.Fatalf("expected www. autolinks to get a scheme")
+	}
+
+	// Long headings that start alike get their own bookmarks, and only web and mail links
+	// become hyperlinks.
+	long := strings.Repeat("Configuring the server ", 3)
+	md = "# " + long + "A\n\n# " + long + "B\n\n[to B](#" + strings.Repeat("configuring-the-server-", 3) + "b) [run](javascript:alert(1)) [local](file:///etc/passwd)\n"
+	out, err = NewRenderer().RenderDOCX(md, filepath.Join(dir, "long.md"), "")
+	if err != nil {
+		t.Fatalf("RenderDOCX returned error: %v", err)
+	}
+	zr, err = zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body, rels string
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		switch f.Name {
+		case "word/document.xml":
+			body = string(data)
+		case "word/_rels/document.xml.rels":
+			rels = string(data)
+		}
+	}
+	names := regexp.MustCompile(`w:name="([^"]+)"`).FindAllStringSubmatch(body, -1)
+	if len(names) != 2 || names[0][1] == names[1][1] || len(names[1][1]) > 40 {
+		t.Fatalf("expected two distinct bookmarks, got %v", names)
+	}
+	if !strings.Contains(body, `<w:hyperlink w:anchor="`+names[1][1]+`">`) {
+		t.Fatalf("the link should point at the second heading's bookmark:\n%s", body)
+	}
+	if strings.Contains(rels, "javascript:") || strings.Contains(rels, "file:") {
+		t.Fatalf("only http, https and mailto links should become hyperlinks:\n%s", rels)
+	}
+	if !strings.Contains(files["word/numbering.xml"], `<w:startOverride w:val="3"/>`) {
+		t.Fatalf("ordered lists should keep their start number")
+	}
+	if !strings.Contains(files["docProps/core.xml"], "<dc:title>Report</dc:title>") {
+		t.Fatalf("the title should default to the first heading")
+	}
+}
+
+func TestPandocArgs(t *testing.T) {
+	if got := pandocExtension("markdown_strict+pipe_tables"); got != "md" {
+		t.Fatalf("expected md, got %s", got)
+	}
+	if got := pandocExtension("odt"); got != "odt" {
+		t.Fatalf("expected odt, got %s", got)
+	}
+
+	args, cleanup, err := pandocArgs("html5", "/tmp/out.html", "/docs", "Notes", "body{color:red}")
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("pandocArgs returned error: %v", err)
+	}
+	header := ""
+	for _, a := range args {
+		if f, ok := strings.CutPrefix(a, "--include-in-header="); ok {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header = string(data)
+		}
+	}
+	if !strings.Contains(header, "<style>\nbody{color:red}") || !strings.Contains(strings.Join(args, " "), "--to=html5 --standalone --resource-path=/docs") {
+		t.Fatalf("expected the theme inlined into HTML output: %v", args)
+	}
+
+	args, cleanup, err = pandocArgs("docx", "/tmp/out.docx", "/docs", "Notes", "body{color:red}")
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("pandocArgs returned error: %v", err)
+	}
+	if strings.Contains(strings.Join(args, " "), "--css") || strings.Contains(strings.Join(args, " "), "--include-in-header") {
+		t.Fatalf("formats without stylesheets should not get the theme: %v", args)
+	}
+}
+
+func TestSectionContent(t *testing.T) {
+	md := "# Guide\n\nIntro.\n\n## Install\n\nRun **this**:\n\n```sh\nmake  install\n```\n\n1. one\n2. two\n\n### Notes\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n## Usage\n\nLater.\n"
+	r := NewRenderer()
+
+	got, err := r.SectionContent(md, "", "install", "markdown")
+	if err != nil {
+		t.Fatalf("SectionContent returned error: %v", err)
+	}
+	if want := md[strings.Index(md, "## Install") : strings.Index(md, "## Usage")-1]; got.Text != want {
+		t.Fatalf("expected the section's exact source up to the next ##:\n%q\ngot\n%q", want, got.Text)
+	}
+
+	got, err = r.SectionContent(md, "", "install", "text")
+	if err != nil {
+		t.Fatalf("SectionContent returned error: %v", err)
+	}
+	if want := "Install\n\nRun this:\n\nmake  install\n\n1. one\n2. two\n\nNotes\n\na\tb\n1\t2\n"; got.Text != want {
+		t.Fatalf("unexpected plain text:\n%q", got.Text)
+	}
+
+	got, err = r.SectionContent(md, "", "notes", "html")
+	if err != nil {
+		t.Fatalf("SectionContent returned error: %v", err)
+	}
+	if !strings.Contains(got.HTML, `<td style="border:1px solid #d0d7de;padding:6px 10px">1</td>`) || strings.Contains(got.HTML, "data-source-line") || strings.Contains(got.HTML, "Usage") {
+		t.Fatalf("expected the section with inline styles only:\n%s", got.HTML)
+	}
+
+	if _, err := r.SectionContent(md, "", "missing", "text"); err == nil {
+		t.Fatalf("expected an error for an unknown heading")
+	}
+}
+
+func TestThemePackage(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".config", "mdr", "mdthemes")
+	pkg := filepath.Join(dir, "nord")
+	for name, content := range map[string]string{
+		"theme.json":           `{"name": "Nord", "author": "Jane", "variants": {"light": "light.css", "dark": "dark.css"}, "fonts": [{"family": "Inter", "src": "fonts/inter.woff2"}], "mermaid": "neutral"}`,
+		"theme.css":            `body{background:url("img/bg.png")}`,
+		"light.css":            `.light{}`,
+		"dark.css":             `.dark{}`,
+		"fonts/inter.woff2":    "font",
+		"img/bg.png":           "png",
+		"../plain.css":         `.plain{}`,
+		"../broken/theme.json": `{"name": "Broken", "stylesheet": "../plain.css", "mermaid": "rainbow", "colour": "red"}`,
+	} {
+		p := filepath.Join(pkg, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	css := themeCSSByName("nord", paletteDark)
+	for _, want := range []string{`@font-face{font-family:"Inter";src:url("data:font/woff2;base64,`, `url("data:image/png;base64,cG5n")`, ".dark{}"} {
+		if !strings.Contains(css, want) {
+			t.Fatalf("expected %q in the dark CSS:\n%s", want, css)
+		}
+	}
+	if strings.Contains(css, ".light{}") || strings.Contains(css, "--mdr-mermaid-theme") {
+		t.Fatalf("expected only the dark variant without a Mermaid override:\n%s", css)
+	}
+	css = themeCSSByName("nord", paletteTheme)
+	if !strings.Contains(css, "@media (prefers-color-scheme: dark){.dark{}}") || !strings.Contains(css, ":root{--mdr-mermaid-theme:neutral}") {
+		t.Fatalf("expected both variants and the Mermaid theme for the theme palette:\n%s", css)
+	}
+	os.WriteFile(filepath.Join(pkg, "dark.css"), []byte(`.dark2{}`), 0o644)
+	if css := themeCSSByName("nord", paletteDark); !strings.Contains(css, ".dark{}") {
+		t.Fatalf("expected the package CSS to be cached until the watcher reports a change")
+	}
+	invalidateThemePackageCSS(pkg)
+	if css := themeCSSByName("nord", paletteDark); !strings.Contains(css, ".dark2{}") {
+		t.Fatalf("expected the package CSS to be rebuilt after a change:\n%s", css)
+	}
+	if got, want := cssString(`My "Font"</style>`), `"My \22 Font\22 \3c /style>"`; got != want {
+		t.Fatalf("expected font families escaped for CSS, got %s want %s", got, want)
+	}
+	if css := themeCSSByName("plain", paletteLight); css != `.plain{}` {
+		t.Fatalf("expected loose CSS themes to still load, got %q", css)
+	}
+	if css := themeCSSByName("broken", paletteLight); css != "" {
+		t.Fatalf("expected an invalid package to be ignored, got %q", css)
+	}
+
+	themes, err := (&App{}).ListThemes()
+	if err != nil {
+		t.Fatalf("ListThemes returned error: %v", err)
+	}
+	var ids []string
+	for _, th := range themes {
+		ids = append(ids, th.ID)
+	}
+	if fmt.Sprint(ids) != "[default broken nord plain]" {
+		t.Fatalf("unexpected themes: %v", ids)
+	}
+	if nord := themes[2]; nord.Name != "Nord" || !nord.Package || fmt.Sprint(nord.Variants, nord.Fonts) != "[light dark] [Inter]" || len(nord.Problems) != 0 {
+		t.Fatalf("unexpected package info: %+v", nord)
+	}
+	if broken := themes[1]; len(broken.Problems) != 1 || !strings.Contains(broken.Problems[0], `unknown field "colour"`) {
+		t.Fatalf("expected unknown manifest fields to be rejected: %+v", broken)
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken", "theme.json"), []byte(`{"stylesheet": "../plain.css", "mermaid": "rainbow"}`), 0o644)
+	_, problems := loadThemeManifest(filepath.Join(dir, "broken"))
+	if len(problems) != 2 || !strings.Contains(problems[0], "mermaid") || !strings.Contains(problems[1], "inside the theme folder") {
+		t.Fatalf("expected the Mermaid theme and the stylesheet path to be rejected: %v", problems)
+	}
+
+	secret := filepath.Join(home, "secret.txt")
+	os.WriteFile(secret, []byte("secret"), 0o644)
+	if err := os.Symlink(secret, filepath.Join(pkg, "img", "leak.png")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	os.Symlink("bg.png", filepath.Join(pkg, "img", "alias.png"))
+	if _, ok := themeAssetURL(pkg, "img/leak.png"); ok {
+		t.Fatalf("a symlink out of the package must not be inlined")
+	}
+	if err := checkThemeAsset(pkg, "img/leak.png"); err == nil || !strings.Contains(err.Error(), "inside the theme folder") {
+		t.Fatalf("expected a symlink out of the package to be rejected, got %v", err)
+	}
+	if src, ok := themeAssetURL(pkg, "img/alias.png"); !ok || !strings.Contains(src, "cG5n") {
+		t.Fatalf("a symlink within the package should be inlined, got %q", src)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	a := &App{watcher: watcher}
+	a.refreshThemeWatch("nord")
+	for _, sub := range []string{"fonts", "img"} {
+		if !containsString(watcher.WatchList(), filepath.Join(pkg, sub)) {
+			t.Fatalf("expected %s of the package to be watched, got %v", sub, watcher.WatchList())
+		}
+	}
+	a.refreshThemeWatch("plain")
+	if list := watcher.WatchList(); len(list) != 1 || list[0] != filepath.Join(dir, "plain.css") {
+		t.Fatalf("switching themes should drop the package folders, got %v", list)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Built-in HTML sanitisation profiles.
+const (
+	// htmlProfileStrict keeps only the markup Markdown itself produces.
+	htmlProfileStrict = "strict"
+	// htmlProfileStandard also allows common user-generated HTML such as <details>,
+	// <sub> and <img>. It is the default.
+	htmlProfileStandard = "standard"
+	// htmlProfileTrusted passes raw HTML through untouched.
+	htmlProfileTrusted = "trusted"
+)
+
+// htmlProfile describes how raw HTML in a document is sanitised. Custom profiles extend a
+// built-in base with extra elements and attributes.
+type htmlProfile struct {
+	Name     string
+	Base     string
+	Elements []string
+	Attrs    []htmlAttrRule
+}
+
+// htmlAttrRule allows an attribute on the listed elements, or on all elements when none
+// are listed.
+type htmlAttrRule struct {
+	Attr     string
+	Elements []string
+}
+
+// key identifies everything that affects the profile's policy.
+func (p htmlProfile) key() string {
+	parts := []string{p.Name, p.Base, strings.Join(p.Elements, ",")}
+	for _, a := range p.Attrs {
+		parts = append(parts, a.Attr+"@"+strings.Join(a.Elements, ","))
+	}
+	return strings.Join(parts, "|")
+}
+
+func allowUnsafeHTML() bool {
+	env := strings.ToLower(strings.TrimSpace(os.Getenv("MDR_UNSAFE_HTML")))
+	return env == "1" || env == "true" || env == "yes"
+}
+
+// htmlProfileForPath picks the sanitisation profile for a document: the profile of the
+// deepest matching `htmlPolicyDirs` entry, else `htmlPolicy`, else standard. Setting
+// MDR_UNSAFE_HTML still forces the trusted profile.
+func htmlProfileForPath(docPath string) htmlProfile {
+	if allowUnsafeHTML() {
+		return htmlProfile{Name: htmlProfileTrusted, Base: htmlProfileTrusted}
+	}
+	settings := getHTMLPolicySettingsFromConfig()
+
+	name := settings.Default
+	best := -1
+	if docPath != "" {
+		docPath = filepath.Clean(docPath)
+		for dir, profile := range settings.Dirs {
+			if len(dir) > best && pathWithin(docPath, dir) {
+				name, best = profile, len(dir)
+			}
+		}
+	}
+	return resolveHTMLProfile(name, settings.Custom)
+}
+
+// resolveHTMLProfile looks up a built-in or custom profile by name. Unknown names fall back
+// to the standard profile.
+func resolveHTMLProfile(name string, custom map[string]htmlProfile) htmlProfile {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case htmlProfileStrict, htmlProfileStandard, htmlProfileTrusted:
+		return htmlProfile{Name: name, Base: name}
+	}
+	if p, ok := custom[name]; ok {
+		return p
+	}
+	return htmlProfile{Name: htmlProfileStandard, Base: htmlProfileStandard}
+}
+
+// pathWithin reports whether p is dir or lies beneath it.
+func pathWithin(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// sanitizer is the standard profile's policy.
+func sanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowStyling()
+	allowMarkdownOutput(p)
+	return p
+}
+
+// allowMarkdownOutput permits the attributes goldmark and mdr's extensions put on their own
+// markup: IDs, classes and titles, source lines, table cell alignment and task list checkboxes.
+func allowMarkdownOutput(p *bluemonday.Policy) {
+	p.AllowAttrs("id", "class", "title").Globally()
+	p.AllowAttrs(sourceLineAttr).Matching(bluemonday.Integer).Globally()
+	p.AllowStyles("text-align").MatchingEnum("left", "right", "center").OnElements("th", "td")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^(|checked|disabled)$`)).OnElements("input")
+}
+
+// strictPolicy allows the elements goldmark and mdr's extensions generate, and nothing else.
+func strictPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowStandardURLs()
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireNoFollowOnLinks(true)
+
+	p.AllowElements("p", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "pre", "code",
+		"em", "strong", "del", "hr", "br", "ul", "ol", "li", "div", "span",
+		"table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("src", "alt").OnElements("img")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	allowMarkdownOutput(p)
+	return p
+}
+
+// buildPolicy returns the policy for a profile, or nil when HTML is passed through.
+func buildPolicy(profile htmlProfile) *bluemonday.Policy {
+	var p *bluemonday.Policy
+	switch profile.Base {
+	case htmlProfileTrusted:
+		return nil
+	case htmlProfileStrict:
+		p = strictPolicy()
+	default:
+		p = sanitizer()
+	}
+	if len(profile.Elements) > 0 {
+		p.AllowElements(profile.Elements...)
+	}
+	for _, a := range profile.Attrs {
+		if len(a.Elements) == 0 {
+			p.AllowAttrs(a.Attr).Globally()
+		} else {
+			p.AllowAttrs(a.Attr).OnElements(a.Elements...)
+		}
+	}
+	return p
+}
+
+// policyCache keeps built policies by profile key; bluemonday policies are safe to share
+// once configured.
+type policyCache struct {
+	mu       sync.Mutex
+	policies map[string]*bluemonday.Policy
+}
+
+func (c *policyCache) get(profile htmlProfile) *bluemonday.Policy {
+	key := profile.key()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.policies[key]; ok {
+		return p
+	}
+	if c.policies == nil {
+		c.policies = map[string]*bluemonday.Policy{}
+	}
+	p := buildPolicy(profile)
+	c.policies[key] = p
+	return p
+}
+
+// parseHTMLAttrRules reads a custom profile's attrs setting: space-separated entries of
+// `attr` (allowed everywhere) or `attr@el1,el2`.
+func parseHTMLAttrRules(v string) []htmlAttrRule {
+	var rules []htmlAttrRule
+	for _, entry := range strings.Fields(v) {
+		attr, els, _ := strings.Cut(entry, "@")
+		attr = strings.ToLower(strings.TrimSpace(attr))
+		if attr == "" {
+			continue
+		}
+		rules = append(rules, htmlAttrRule{Attr: attr, Elements: splitList(els)})
+	}
+	return rules
+}
+
+// splitList splits a comma-separated list, dropping blanks, lower-cased and sorted.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxSanitizedBlocks caps how many before/after pairs are kept for the "show what was
+// removed" view; the counts in RemovedContent always cover the whole document.
+const maxSanitizedBlocks = 100
+
+// RemovedContent is one kind of markup the sanitizer dropped from a document.
+type RemovedContent struct {
+	// Kind is "element", "attribute" or "url".
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// SanitizedBlock holds a block's HTML before and after sanitizing, for blocks that lost
+// content.
+type SanitizedBlock struct {
+	BlockID string `json:"blockId"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+}
+
+// removalReport accumulates what the sanitizer removed across the pieces of a document.
+type removalReport struct {
+	counts map[string]int
+	blocks []SanitizedBlock
+}
+
+// markupKey identifies a counted piece of markup: "element\x00script",
+// "attribute\x00a\x00onclick" or "url\x00javascript".
+func markupKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// urlAttrs are the attributes whose values are checked for script URLs.
+var urlAttrs = map[string]bool{"href": true, "src": true, "action": true, "formaction": true, "xlink:href": true}
+
+// scriptURLSchemes are the URL schemes that run code when followed.
+var scriptURLSchemes = []string{"javascript", "vbscript"}
+
+// countMarkup tallies the elements, attributes and script URLs in an HTML fragment.
+// A script URL is counted instead of the attribute carrying it.
+func countMarkup(fragment string) map[string]int {
+	counts := map[string]int{}
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return counts
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tok := z.Token()
+		counts[markupKey("element", tok.Data)]++
+		for _, attr := range tok.Attr {
+			name := attr.Key
+			if attr.Namespace != "" {
+				name = attr.Namespace + ":" + name
+			}
+			if scheme := scriptURLScheme(attr.Val); urlAttrs[name] && scheme != "" {
+				counts[markupKey("url", scheme)]++
+				continue
+			}
+			counts[markupKey("attribute", tok.Data, name)]++
+		}
+	}
+}
+
+// scriptURLScheme returns the scheme of a javascript: or vbscript: URL, ignoring the
+// whitespace and control characters browsers skip, or "" for any other URL.
+func scriptURLScheme(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(v))
+	for _, scheme := range scriptURLSchemes {
+		if strings.HasPrefix(v, scheme+":") {
+			return scheme
+		}
+	}
+	return ""
+}
+
+// add records what sanitizing removed from one block.
+func (r *removalReport) add(blockID, before, after string) {
+	removed := false
+	afterCounts := countMarkup(after)
+	for key, n := range countMarkup(before) {
+		if lost := n - afterCounts[key]; lost > 0 {
+			if r.counts == nil {
+				r.counts = map[string]int{}
+			}
+			r.counts[key] += lost
+			removed = true
+		}
+	}
+	if removed && len(r.blocks) < maxSanitizedBlocks {
+		r.blocks = append(r.blocks, SanitizedBlock{BlockID: blockID, Before: before, After: after})
+	}
+}
+
+// items summarises the report, largest counts first. Attributes lost along with their
+// element are not listed separately, nor are links dropped because their URL was.
+func (r *removalReport) items() []RemovedContent {
+	elements := map[string]int{}
+	urls := 0
+	for key, n := range r.counts {
+		parts := strings.Split(key, "\x00")
+		switch parts[0] {
+		case "element":
+			elements[parts[1]] = n
+		case "url":
+			urls += n
+		}
+	}
+	elements["a"] = max(elements["a"]-urls, 0)
+
+	var items []RemovedContent
+	attrs := map[string]int{}
+	for key, n := range r.counts {
+		parts := strings.Split(key, "\x00")
+		switch parts[0] {
+		case "element":
+			if n = elements[parts[1]]; n > 0 {
+				items = append(items, RemovedContent{Kind: "element", Name: parts[1], Label: "<" + parts[1] + ">", Count: n})
+			}
+		case "url":
+			items = append(items, RemovedContent{Kind: "url", Name: parts[1], Label: parts[1] + ": link", Count: n})
+		case "attribute":
+			if n -= elements[parts[1]]; n > 0 {
+				attrs[parts[2]] += n
+			}
+		}
+	}
+	for name, n := range attrs {
+		items = append(items, RemovedContent{Kind: "attribute", Name: name, Label: name + " attribute", Count: n})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+// describeRemoved formats a removal summary for the status bar.
+func describeRemoved(items []RemovedContent) string {
+	parts := make([]string, len(items))
+	for i, it := range items {
+		parts[i] = fmt.Sprintf("%d× %s", it.Count, it.Label)
+	}
+	return "Sanitizer removed " + strings.Join(parts, ", ")
+}
+
+// reportRemoved keeps the blocks the sanitizer changed for GetRemovedContent and warns in the
+// status bar when anything was removed.
+func (a *App) reportRemoved(removed []RemovedContent, blocks []SanitizedBlock) {
+	a.mu.Lock()
+	a.sanitized = append([]SanitizedBlock(nil), blocks...)
+	a.mu.Unlock()
+	if len(removed) > 0 {
+		a.emitStatus("warning", "content-removed", describeRemoved(removed))
+	}
+}
+
+// GetRemovedContent returns the blocks of the last rendered document that the sanitizer
+// changed, with their HTML before and after, for the "show what was removed" view.
+func (a *App) GetRemovedContent() []SanitizedBlock {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]SanitizedBlock(nil), a.sanitized...)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// slideBreak matches a `---` rule, which separates slides when it follows a blank line
+	// (right after text it would be a setext heading underline instead).
+	slideBreak = regexp.MustCompile(`^ {0,3}-{3,}[ \t]*$`)
+	// atxHeadingLevel captures the `#`s of an ATX heading.
+	atxHeadingLevel = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]|$)`)
+	// commentOpen starts an HTML comment block, which holds presenter notes in slides mode.
+	commentOpen = regexp.MustCompile(`^ {0,3}<!--`)
+)
+
+// slidesCSS shows one slide at a time, or all of them as a grid of thumbnails in overview.
+const slidesCSS = `body #wrapper{max-width:1100px}` +
+	`.mdr-slide{display:none}` +
+	`.mdr-slide.current{display:flex;flex-direction:column;justify-content:center;min-height:calc(100vh - 64px);font-size:140%}` +
+	`body.mdr-overview #wrapper{max-width:none;display:grid;grid-template-columns:repeat(auto-fill,minmax(240px,1fr));gap:16px}` +
+	`body.mdr-overview .mdr-slide{display:block;height:180px;min-height:0;overflow:hidden;padding:8px 12px;font-size:45%;border:1px solid rgba(128,128,128,.4);border-radius:6px;cursor:pointer}` +
+	`body.mdr-overview .mdr-slide.current{outline:3px solid rgba(56,139,253,.8)}`
+
+// Slide describes one slide of a deck. Line is where it starts in the document and Notes
+// holds its presenter notes, taken from HTML comments.
+type Slide struct {
+	Title string `json:"title"`
+	Line  int    `json:"line"`
+	Notes string `json:"notes"`
+}
+
+// SlideDeck is a document rendered as slides: a page holding every slide as a
+// <section class="mdr-slide">, of which the preview shows one at a time.
+type SlideDeck struct {
+	Path   string  `json:"path"`
+	HTML   string  `json:"html"`
+	Split  string  `json:"split"`
+	Slides []Slide `json:"slides"`
+}
+
+// slideSource is the Markdown of one slide; line is the document line before its first.
+type slideSource struct {
+	markdown string
+	line     int
+	notes    []string
+}
+
+// splitSlides cuts markdown into slides at `---` rules and, when level is above 0, before
+// every heading of that level or higher. HTML comments become the slides' notes and are
+// blanked out of their Markdown so line numbers still match the document.
+func splitSlides(markdown string, level int) []slideSource {
+	var slides []slideSource
+	cur := slideSource{}
+	var b strings.Builder
+	hasContent := false
+	flush := func(next int) {
+		cur.markdown = b.String()
+		if hasContent || len(cur.notes) > 0 {
+			slides = append(slides, cur)
+		}
+		cur = slideSource{line: next}
+		b.Reset()
+		hasContent = false
+	}
+
+	lines := strings.SplitAfter(markdown, "\n")
+	fence := ""
+	prevBlank := true
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case fence != "":
+			if closesFence(trimmed, fence) {
+				fence = ""
+			}
+		case fenceOpen.MatchString(trimmed):
+			fence = fenceOpen.FindStringSubmatch(trimmed)[1]
+		case commentOpen.MatchString(trimmed):
+			var note strings.Builder
+			for ; i < len(lines); i++ {
+				text := lines[i]
+				if i == len(lines)-1 && text == "" {
+					break
+				}
+				done := strings.Contains(text, "-->")
+				if done {
+					text, _, _ = strings.Cut(text, "-->")
+				}
+				note.WriteString(text)
+				b.WriteString("\n")
+				if done {
+					break
+				}
+			}
+			text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(note.String()), "<!--"))
+			if text != "" {
+				cur.notes = append(cur.notes, text)
+			}
+			prevBlank = true
+			continue
+		case prevBlank && slideBreak.MatchString(trimmed):
+			flush(i + 1)
+			continue
+		case level > 0:
+			if m := atxHeadingLevel.FindStringSubmatch(trimmed); m != nil && len(m[1]) <= level && hasContent {
+				flush(i)
+			}
+		}
+		b.WriteString(line)
+		prevBlank = strings.TrimSpace(trimmed) == ""
+		hasContent = hasContent || !prevBlank
+	}
+	flush(len(lines))
+	return slides
+}
+
+// slideSplitLevel returns the heading level a slideSplits value cuts at, 0 for "hr".
+func slideSplitLevel(split string) int {
+	level, _ := strconv.Atoi(strings.TrimPrefix(split, "h"))
+	return level
+}
+
+// RenderSlides renders the document at path as a deck, split as set in `slideSplit`.
+func (a *App) RenderSlides(path string, theme string, palette string) (SlideDeck, error) {
+	path = normalizePath(path)
+	markdown, _, err := readDocument(path)
+	if err != nil {
+		return SlideDeck{}, err
+	}
+	split := getSlideSplitFromConfig()
+	page, slides, err := sharedRenderer().RenderSlides(markdown, documentBase(path), theme, palette, getFontScaleFromConfig(), slideSplitLevel(split))
+	if err != nil {
+		return SlideDeck{}, err
+	}
+	return SlideDeck{Path: path, HTML: page, Split: split, Slides: slides}, nil
+}
+
+// GetSlideSplit returns how slides mode splits documents: "hr", "h1", "h2" or "h3".
+func (a *App) GetSlideSplit() string {
+	return getSlideSplitFromConfig()
+}
+
+func (a *App) SetSlideSplit(split string) error {
+	return setSlideSplitInConfig(split)
+}
+
+// RenderSlides renders markdown as a deck of slides on one page, each with its title (its
+// first heading) and notes.
+func (r *Renderer) RenderSlides(markdown, docPath, themeName, palette string, fontScale int, level int) (string, []Slide, error) {
+	st := r.newRenderState(htmlProfileForPath(docPath))
+	var body strings.Builder
+	var slides []Slide
+	for i, src := range splitSlides(markdown, level) {
+		st.lineOffset = src.line
+		html, _, toc, err := r.renderBody(src.markdown, docPath, st)
+		if err != nil {
+			return "", nil, err
+		}
+		slide := Slide{Line: src.line + 1, Notes: strings.Join(src.notes, "\n\n")}
+		if len(toc) > 0 {
+			slide.Title = toc[0].Text
+		}
+		slides = append(slides, slide)
+		body.WriteString(`<section class="mdr-slide" id="slide-` + strconv.Itoa(i+1) + `" data-slide="` + strconv.Itoa(i) + `">`)
+		body.WriteString(html)
+		body.WriteString(`</section>`)
+	}
+
+	page, err := r.renderPage(body.String(), st, themeCSSByName(themeName, normalizePalette(palette))+slidesCSS, normalizePalette(palette), clampFontScale(fontScale), "")
+	if err != nil {
+		return "", nil, err
+	}
+	return page, slides, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+var (
+	// lineIndexKey carries the *lineIndex of the Markdown being parsed.
+	lineIndexKey = parser.NewContextKey()
+	// lineOffsetKey carries how many lines of the document precede the Markdown being
+	// parsed, for documents rendered in pieces.
+	lineOffsetKey = parser.NewContextKey()
+)
+
+// sourceLineAttr is set on rendered block elements to the source line they start on.
+const sourceLineAttr = "data-source-line"
+
+type sourceLineTransformer struct{}
+
+// Transform marks paragraphs, headings, quotes, lists, list items and table rows with the
+// line they start on, so editors can scroll the preview to a line.
+func (t *sourceLineTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	li, _ := pc.Get(lineIndexKey).(*lineIndex)
+	if li == nil {
+		return
+	}
+	offset, _ := pc.Get(lineOffsetKey).(int)
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindParagraph, ast.KindHeading, ast.KindBlockquote, ast.KindList, ast.KindListItem,
+			extast.KindTable, extast.KindTableHeader, extast.KindTableRow:
+			if start, _ := segmentBounds(n); start >= 0 {
+				n.SetAttributeString(sourceLineAttr, []byte(strconv.Itoa(li.line(start)+offset)))
+			}
+		case ast.KindCodeBlock, ast.KindFencedCodeBlock, ast.KindHTMLBlock:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+type sourceLineExtension struct{}
+
+// sourceLines annotates rendered blocks with their source lines.
+var sourceLines = &sourceLineExtension{}
+
+// Extend implements goldmark.Extender.
+func (e *sourceLineExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&sourceLineTransformer{}, 100),
+	))
+}
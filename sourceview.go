@@ -0,0 +1,41 @@
+package main
+
+// SourceDocument is a document's Markdown as the renderer sees it, with includes expanded,
+// so its line numbers match the data-source-line of the rendered blocks. FileLines maps each
+// line to the line of the file it came from, and is empty when nothing was included.
+type SourceDocument struct {
+	Path      string   `json:"path"`
+	Markdown  string   `json:"markdown"`
+	FileLines []int    `json:"fileLines"`
+	Includes  []string `json:"includes"`
+}
+
+// GetSource returns the Markdown behind a document for the source view.
+func (a *App) GetSource(path string) (SourceDocument, error) {
+	path = normalizePath(path)
+	data, base, err := loadDocument(path)
+	if err != nil {
+		return SourceDocument{}, err
+	}
+	markdown, includes, fileLines := expandIncludesWithLines(data, base)
+	return SourceDocument{Path: path, Markdown: markdown, FileLines: fileLines, Includes: includes}, nil
+}
+
+// renderedLine converts a line of the file at path to the line numbering of its rendered
+// blocks, which counts the lines of included documents too.
+func renderedLine(path string, fileLine int) int {
+	data, base, err := loadDocument(path)
+	if err != nil {
+		return fileLine
+	}
+	_, _, fileLines := expandIncludesWithLines(data, base)
+	for i, l := range fileLines {
+		if l >= fileLine {
+			return i + 1
+		}
+	}
+	if len(fileLines) > 0 {
+		return len(fileLines)
+	}
+	return fileLine
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A theme package is a folder in mdthemes holding a theme.json manifest, its stylesheets and
+// the fonts and images they use, so a theme can ship its own assets:
+//
+//	{
+//	  "name": "Nord",
+//	  "author": "Jane Doe",
+//	  "stylesheet": "theme.css",
+//	  "variants": {"light": "light.css", "dark": "dark.css"},
+//	  "fonts": [{"family": "Inter", "src": "fonts/Inter.woff2", "weight": "400"}],
+//	  "mermaid": "neutral",
+//	  "syntax": "nord"
+//	}
+//
+// Assets are inlined as data URLs, since the preview only loads those.
+const themeManifestName = "theme.json"
+
+// themeURL matches url() references in a package's stylesheets.
+var themeURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+
+// themePalettes are the variants a package may provide.
+var themePalettes = []string{"light", "dark"}
+
+// mermaidThemes are the themes Mermaid ships.
+var mermaidThemes = []string{"default", "dark", "forest", "neutral", "base"}
+
+// fontMediaTypes are the font formats a package may ship, with their media type and CSS
+// format() name.
+var fontMediaTypes = map[string][2]string{
+	".woff2": {"font/woff2", "woff2"},
+	".woff":  {"font/woff", "woff"},
+	".ttf":   {"font/ttf", "truetype"},
+	".otf":   {"font/otf", "opentype"},
+}
+
+// ThemeFont is a font a theme package ships.
+type ThemeFont struct {
+	Family string `json:"family"`
+	Src    string `json:"src"`
+	Weight string `json:"weight,omitempty"`
+	Style  string `json:"style,omitempty"`
+}
+
+// ThemeManifest is a theme package's theme.json.
+type ThemeManifest struct {
+	Name        string `json:"name"`
+	Author      string `json:"author,omitempty"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version,omitempty"`
+	// Stylesheet is the package's main CSS file; it defaults to theme.css.
+	Stylesheet string `json:"stylesheet,omitempty"`
+	// Variants maps "light" and "dark" to stylesheets applied on top of Stylesheet for the
+	// matching palette.
+	Variants map[string]string `json:"variants,omitempty"`
+	Fonts    []ThemeFont       `json:"fonts,omitempty"`
+	// Mermaid is the Mermaid theme diagrams use with the "theme" palette.
+	Mermaid string `json:"mermaid,omitempty"`
+	// Syntax names the code highlighting scheme the theme is designed for.
+	Syntax string `json:"syntax,omitempty"`
+}
+
+// ThemeInfo describes an installed theme for the theme menu. ID is the value to select it by.
+// Problems lists what is wrong with a package's manifest; such themes can't be applied.
+type ThemeInfo struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Author      string   `json:"author"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Package     bool     `json:"package"`
+	Variants    []string `json:"variants"`
+	Fonts       []string `json:"fonts"`
+	Mermaid     string   `json:"mermaid"`
+	Syntax      string   `json:"syntax"`
+	Problems    []string `json:"problems"`
+}
+
+// isThemePackage reports whether dir is a theme package.
+func isThemePackage(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, themeManifestName))
+	return err == nil && !info.IsDir()
+}
+
+// themePackageDir returns the folder of the theme package named themeName, if there is one.
+func themePackageDir(themeName string) (string, bool) {
+	dir, err := themesDir()
+	if err != nil {
+		return "", false
+	}
+	name := filepath.Base(strings.TrimSpace(themeName))
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", false
+	}
+	pkg := filepath.Join(dir, name)
+	if !isThemePackage(pkg) {
+		return "", false
+	}
+	return pkg, true
+}
+
+// loadThemeManifest reads and validates the manifest of the package in dir. It returns the
+// problems found; a manifest with problems must not be applied.
+func loadThemeManifest(dir string) (ThemeManifest, []string) {
+	var m ThemeManifest
+	data, err := os.ReadFile(filepath.Join(dir, themeManifestName))
+	if err != nil {
+		return m, []string{err.Error()}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return m, []string{fmt.Sprintf("%s: %v", themeManifestName, err)}
+	}
+
+	if strings.TrimSpace(m.Name) == "" {
+		m.Name = filepath.Base(dir)
+	}
+	if m.Stylesheet == "" {
+		m.Stylesheet = "theme.css"
+	}
+	var problems []string
+	checkFile := func(what, rel string) {
+		if err := checkThemeAsset(dir, rel); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", what, err))
+		}
+	}
+	checkFile("stylesheet", m.Stylesheet)
+	for variant, rel := range m.Variants {
+		if !containsString(themePalettes, variant) {
+			problems = append(problems, fmt.Sprintf("variant %q: must be light or dark", variant))
+			continue
+		}
+		checkFile("variant "+variant, rel)
+	}
+	for i, f := range m.Fonts {
+		what := fmt.Sprintf("font %d", i+1)
+		if strings.TrimSpace(f.Family) == "" {
+			problems = append(problems, what+": family is missing")
+		}
+		if _, ok := fontMediaTypes[strings.ToLower(filepath.Ext(f.Src))]; !ok {
+			problems = append(problems, what+": src must be a .woff2, .woff, .ttf or .otf file")
+			continue
+		}
+		checkFile(what, f.Src)
+	}
+	if m.Mermaid != "" && !containsString(mermaidThemes, m.Mermaid) {
+		problems = append(problems, fmt.Sprintf("mermaid: unknown theme %q (use %s)", m.Mermaid, strings.Join(mermaidThemes, ", ")))
+	}
+	sort.Strings(problems)
+	return m, problems
+}
+
+// checkThemeAsset checks that rel names a file inside the package in dir. Symlinks are
+// followed, and must not lead out of the package.
+func checkThemeAsset(dir, rel string) error {
+	if rel == "" || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return fmt.Errorf("%q must be a path inside the theme folder", rel)
+	}
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("%q not found", rel)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%q is a folder", rel)
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("%q not found", rel)
+	}
+	realPath, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return fmt.Errorf("%q not found", rel)
+	}
+	if inside, err := filepath.Rel(realDir, realPath); err != nil || !filepath.IsLocal(inside) {
+		return fmt.Errorf("%q must be a path inside the theme folder", rel)
+	}
+	return nil
+}
+
+// themePackageCache keeps the CSS built for the theme package in use, one entry per palette,
+// so renders don't read and encode its fonts and images again. The watcher clears it when a
+// file in the package changes.
+var themePackageCache = struct {
+	sync.Mutex
+	dir string
+	css map[paletteMode]string
+}{}
+
+// themePackageCSS returns the CSS of the package in dir for palette p: its fonts, its main
+// stylesheet and the variant for p. With the "theme" palette both variants apply, the dark
+// one when the system is in dark mode, and the manifest's Mermaid theme is used for diagrams.
+// It returns "" when the manifest has problems.
+func themePackageCSS(dir string, p paletteMode) string {
+	c := &themePackageCache
+	c.Lock()
+	defer c.Unlock()
+	if c.dir != dir || c.css == nil {
+		c.dir, c.css = dir, map[paletteMode]string{}
+	}
+	css, ok := c.css[p]
+	if !ok {
+		css = buildThemePackageCSS(dir, p)
+		c.css[p] = css
+	}
+	return css
+}
+
+// invalidateThemePackageCSS makes the next render rebuild the CSS of the package in dir.
+func invalidateThemePackageCSS(dir string) {
+	c := &themePackageCache
+	c.Lock()
+	defer c.Unlock()
+	if c.dir == dir {
+		c.css = nil
+	}
+}
+
+func buildThemePackageCSS(dir string, p paletteMode) string {
+	m, problems := loadThemeManifest(dir)
+	if len(problems) > 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, f := range m.Fonts {
+		src, ok := themeAssetURL(dir, f.Src)
+		if !ok {
+			continue
+		}
+		weight, style := f.Weight, f.Style
+		if weight == "" {
+			weight = "normal"
+		}
+		if style == "" {
+			style = "normal"
+		}
+		format := fontMediaTypes[strings.ToLower(filepath.Ext(f.Src))][1]
+		fmt.Fprintf(&b, `@font-face{font-family:%s;src:url(%s) format(%q);font-weight:%s;font-style:%s}`, cssString(f.Family), src, format, weight, style)
+	}
+	b.WriteString(themeStylesheet(dir, m.Stylesheet))
+	switch p {
+	case paletteLight, paletteDark:
+		if rel, ok := m.Variants[string(p)]; ok {
+			b.WriteString(themeStylesheet(dir, rel))
+		}
+	case paletteTheme:
+		if rel, ok := m.Variants["light"]; ok {
+			b.WriteString(themeStylesheet(dir, rel))
+		}
+		if rel, ok := m.Variants["dark"]; ok {
+			b.WriteString("@media (prefers-color-scheme: dark){" + themeStylesheet(dir, rel) + "}")
+		}
+		if m.Mermaid != "" {
+			b.WriteString(":root{--mdr-mermaid-theme:" + m.Mermaid + "}")
+		}
+	}
+	return b.String()
+}
+
+// cssString quotes s as a CSS string. Quotes, backslashes, control characters and `<`, which
+// could end the page's style element, are written as hex escapes.
+func cssString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' || r == '<' || r < 0x20 || r == 0x7f {
+			fmt.Fprintf(&b, `\%x `, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// themeStylesheet reads a package stylesheet, inlining the assets its url()s refer to.
+func themeStylesheet(dir, rel string) string {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return ""
+	}
+	base := path.Dir(filepath.ToSlash(rel))
+	return themeURL.ReplaceAllStringFunc(string(data), func(match string) string {
+		m := themeURL.FindStringSubmatch(match)
+		ref := m[1] + m[2] + m[3]
+		if ref == "" || strings.HasPrefix(ref, "#") || strings.Contains(ref, ":") {
+			return match
+		}
+		ref, _, _ = strings.Cut(ref, "?")
+		ref, _, _ = strings.Cut(ref, "#")
+		if src, ok := themeAssetURL(dir, path.Join(base, ref)); ok {
+			return "url(" + src + ")"
+		}
+		return match
+	})
+}
+
+// themeAssetURL returns a package file as a data URL. Files outside the package, missing
+// ones and ones over the file size limit are left out.
+func themeAssetURL(dir, rel string) (string, bool) {
+	if checkThemeAsset(dir, rel) != nil {
+		return "", false
+	}
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	if enforceFileLimit(p) != nil {
+		return "", false
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return "", false
+	}
+	ext := strings.ToLower(filepath.Ext(p))
+	mediaType := fontMediaTypes[ext][0]
+	if mediaType == "" {
+		mediaType, _, _ = strings.Cut(mime.TypeByExtension(ext), ";")
+	}
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	return `"data:` + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data) + `"`, true
+}
+
+// cssThemeInfo describes a loose .css theme, which has no metadata beyond its name.
+func cssThemeInfo(id string) ThemeInfo {
+	return ThemeInfo{ID: id, Name: id, Variants: []string{}, Fonts: []string{}, Problems: []string{}}
+}
+
+// themeInfo describes the theme package in dir, named id.
+func themeInfo(id, dir string) ThemeInfo {
+	m, problems := loadThemeManifest(dir)
+	info := ThemeInfo{
+		ID:          id,
+		Name:        m.Name,
+		Author:      m.Author,
+		Description: m.Description,
+		Version:     m.Version,
+		Package:     true,
+		Variants:    []string{},
+		Fonts:       []string{},
+		Mermaid:     m.Mermaid,
+		Syntax:      m.Syntax,
+		Problems:    problems,
+	}
+	if info.Problems == nil {
+		info.Problems = []string{}
+	}
+	if info.Name == "" {
+		info.Name = id
+	}
+	for _, v := range themePalettes {
+		if _, ok := m.Variants[v]; ok {
+			info.Variants = append(info.Variants, v)
+		}
+	}
+	for _, f := range m.Fonts {
+		if f.Family != "" && !containsString(info.Fonts, f.Family) {
+			info.Fonts = append(info.Fonts, f.Family)
+		}
+	}
+	return info
+}
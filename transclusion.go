@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth bounds how deeply included documents may themselves include others.
+const maxIncludeDepth = 8
+
+var (
+	embedDirective   = regexp.MustCompile(`^\s{0,3}!\[\[([^\[\]|#]+?)(?:\|[^\[\]]*)?\]\]\s*$`)
+	commentDirective = regexp.MustCompile(`^\s{0,3}<!--\s*include:\s*(.+?)\s*-->\s*$`)
+	fenceOpen        = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})")
+)
+
+// includeTarget returns the file named by an include directive on line, or "" if the line
+// is not a directive. `![[name]]` only counts when it names a Markdown file, so image
+// embeds such as `![[diagram.png]]` are left alone.
+func includeTarget(line string) string {
+	if m := commentDirective.FindStringSubmatch(line); m != nil {
+		return m[1]
+	}
+	if m := embedDirective.FindStringSubmatch(line); m != nil {
+		name := strings.TrimSpace(m[1])
+		if ext := filepath.Ext(name); ext != "" && !isMarkdownFile(name) {
+			return ""
+		}
+		return name
+	}
+	return ""
+}
+
+// resolveInclude maps an include target to a file relative to the including document,
+// adding a `.md` suffix when the name has no extension. Only relative paths to Markdown
+// files can be included, so a document can't pull in files such as `~/.ssh/id_rsa`; ok is
+// false for anything else.
+func resolveInclude(target, fromDir string) (p string, ok bool) {
+	target = filepath.FromSlash(strings.TrimSpace(target))
+	if target == "" || filepath.IsAbs(target) || filepath.VolumeName(target) != "" || strings.HasPrefix(target, "~") {
+		return "", false
+	}
+	target = filepath.Join(fromDir, target)
+	if filepath.Ext(target) == "" {
+		target += ".md"
+	}
+	return target, isMarkdownFile(target)
+}
+
+// closesFence reports whether line closes a code block opened with fence: a run of the same
+// character at least as long, with nothing but whitespace after it. An opening fence with an
+// info string, such as "```python", does not close a block.
+func closesFence(line, fence string) bool {
+	t := strings.TrimSpace(line)
+	rest := strings.TrimLeft(t, fence[:1])
+	return rest == "" && len(t) >= len(fence)
+}
+
+// includeError renders a failed include as a caution callout so the problem is visible in place.
+func includeError(format string, args ...any) string {
+	return "> [!CAUTION]\n> " + fmt.Sprintf(format, args...) + "\n"
+}
+
+// expandIncludes splices included Markdown files into markdown, recursively. It returns the
+// expanded text and every file that was included, in the order first encountered.
+func expandIncludes(markdown string, docPath string) (string, []string) {
+	out, included, _ := expandIncludesWithLines(markdown, docPath)
+	return out, included
+}
+
+// expandIncludesWithLines is expandIncludes that also maps each line of the expanded text
+// to the line of markdown it came from; lines of an included file map to its directive.
+// The map is nil when nothing was included and the lines are unchanged. Includes stop once
+// the expanded text would exceed the file size limit, however often each file is included.
+func expandIncludesWithLines(markdown string, docPath string) (string, []string, []int) {
+	if docPath == "" || (!strings.Contains(markdown, "![[") && !strings.Contains(markdown, "include:")) {
+		return markdown, nil, nil
+	}
+	var included []string
+	var lines []int
+	seen := map[string]bool{}
+	budget := getMaxFileBytesFromConfig() - int64(len(markdown))
+	out := expandIncludesFrom(markdown, filepath.Clean(docPath), []string{filepath.Clean(docPath)}, &included, seen, &budget, &lines)
+	if len(included) == 0 {
+		return out, nil, nil
+	}
+	return out, included, lines
+}
+
+// expandIncludesFrom expands the directives in markdown. budget is how many more bytes
+// includes may add. When lineMap is not nil it is extended with the source line of every
+// output line.
+func expandIncludesFrom(markdown string, docPath string, stack []string, included *[]string, seen map[string]bool, budget *int64, lineMap *[]int) string {
+	lines := strings.SplitAfter(markdown, "\n")
+	var b strings.Builder
+	fence := ""
+	for i, line := range lines {
+		start := b.Len()
+		expandIncludeLine(&b, line, &fence, docPath, stack, included, seen, budget)
+		if lineMap != nil {
+			written := b.String()[start:]
+			for n := strings.Count(written, "\n"); n > 0; n-- {
+				*lineMap = append(*lineMap, i+1)
+			}
+			if written != "" && !strings.HasSuffix(written, "\n") {
+				*lineMap = append(*lineMap, i+1)
+			}
+		}
+	}
+	return b.String()
+}
+
+func expandIncludeLine(b *strings.Builder, line string, fence *string, docPath string, stack []string, included *[]string, seen map[string]bool, budget *int64) {
+	trimmed := strings.TrimRight(line, "\r\n")
+	if *fence != "" {
+		if closesFence(trimmed, *fence) {
+			*fence = ""
+		}
+		b.WriteString(line)
+		return
+	}
+	if m := fenceOpen.FindStringSubmatch(trimmed); m != nil {
+		*fence = m[1]
+		b.WriteString(line)
+		return
+	}
+
+	target := includeTarget(trimmed)
+	if target == "" {
+		b.WriteString(line)
+		return
+	}
+	b.WriteString(expandInclude(target, docPath, stack, included, seen, budget))
+	if strings.HasSuffix(line, "\n") {
+		b.WriteString("\n")
+	}
+}
+
+func expandInclude(target string, docPath string, stack []string, included *[]string, seen map[string]bool, budget *int64) string {
+	p, ok := resolveInclude(target, filepath.Dir(docPath))
+	if !ok {
+		return includeError("Include of `%s` skipped: only Markdown files at a path relative to this document can be included.", target)
+	}
+	for _, s := range stack {
+		if s == p {
+			return includeError("Include cycle: `%s` is already being included.", target)
+		}
+	}
+	if len(stack) > maxIncludeDepth {
+		return includeError("Include of `%s` skipped: nesting is deeper than %d levels.", target, maxIncludeDepth)
+	}
+	if err := enforceFileLimit(p); err != nil {
+		return includeError("Include of `%s` failed: %s.", target, err)
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return includeError("Include of `%s` failed: %s.", target, err)
+	}
+	if int64(len(data)) > *budget {
+		return includeError("Include of `%s` skipped: the expanded document would exceed the file size limit.", target)
+	}
+	*budget -= int64(len(data))
+	if !seen[p] {
+		seen[p] = true
+		*included = append(*included, p)
+	}
+
+	body := expandIncludesFrom(string(data), p, append(stack, p), included, seen, budget, nil)
+	// Keep the included document a separate block.
+	return "\n" + strings.TrimRight(body, "\n") + "\n"
+}
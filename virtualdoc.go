@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Virtual documents are Markdown that isn't read from a file on disk: text piped to `mdr -`,
+// or a file as it was at a git revision (`mdr --rev main docs/api.md`). They are addressed
+// by pseudo-paths that travel through the frontend like file paths, are never watched or
+// added to the recent files, and render relative to a real path so links and images resolve.
+const (
+	// stdinDocPath names the document read from standard input.
+	stdinDocPath = "stdin:"
+	// gitDocPrefix starts the path of a file at a revision: "git:<rev>:<absolute path>".
+	gitDocPrefix = "git:"
+	// gitShowTimeout bounds how long reading a file from git may take.
+	gitShowTimeout = 10 * time.Second
+)
+
+// virtualDocument is the content behind a virtual path.
+type virtualDocument struct {
+	Title    string
+	Markdown string
+	// BasePath is the file the document renders as, for resolving links, images and includes.
+	BasePath string
+}
+
+var virtualDocs = struct {
+	sync.Mutex
+	docs map[string]virtualDocument
+}{docs: map[string]virtualDocument{}}
+
+// gitDocPath returns the virtual path of path as it was at rev.
+func gitDocPath(rev, path string) string {
+	return gitDocPrefix + rev + ":" + path
+}
+
+// isVirtualPath reports whether p names a virtual document rather than a file.
+func isVirtualPath(p string) bool {
+	if p == stdinDocPath {
+		return true
+	}
+	rev, path, ok := strings.Cut(strings.TrimPrefix(p, gitDocPrefix), ":")
+	return strings.HasPrefix(p, gitDocPrefix) && ok && rev != "" && filepath.IsAbs(path)
+}
+
+// setStdinDocument makes markdown the content of the stdin document, rendered as if it were
+// a file in dir.
+func setStdinDocument(markdown, dir string) {
+	virtualDocs.Lock()
+	defer virtualDocs.Unlock()
+	virtualDocs.docs[stdinDocPath] = virtualDocument{
+		Title:    "stdin",
+		Markdown: markdown,
+		BasePath: filepath.Join(dir, "stdin.md"),
+	}
+}
+
+// readStdinDocument reads standard input, up to the file size limit.
+func readStdinDocument() (string, error) {
+	limit := getMaxFileBytesFromConfig()
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, limit+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > limit {
+		return "", fmt.Errorf("stdin too large (limit %d bytes)", limit)
+	}
+	return string(data), nil
+}
+
+// lookupVirtual returns the document behind a virtual path, reading files at a revision from
+// git the first time they are asked for. ok is false when p is an ordinary file path.
+func lookupVirtual(p string) (virtualDocument, bool, error) {
+	if !isVirtualPath(p) {
+		return virtualDocument{}, false, nil
+	}
+	virtualDocs.Lock()
+	doc, ok := virtualDocs.docs[p]
+	virtualDocs.Unlock()
+	if ok {
+		return doc, true, nil
+	}
+	if p == stdinDocPath {
+		return virtualDocument{}, true, fmt.Errorf("nothing was read from stdin")
+	}
+
+	rev, path, _ := strings.Cut(strings.TrimPrefix(p, gitDocPrefix), ":")
+	markdown, err := gitShow(rev, path)
+	if err != nil {
+		return virtualDocument{}, true, err
+	}
+	doc = virtualDocument{
+		Title:    filepath.Base(path) + " @ " + rev,
+		Markdown: markdown,
+		BasePath: path,
+	}
+	virtualDocs.Lock()
+	virtualDocs.docs[p] = doc
+	virtualDocs.Unlock()
+	return doc, true, nil
+}
+
+// gitShow reads path as it was at rev with the local git binary. Revisions come from the
+// command line, IPC and the frontend alike, so one that git would read as an option is
+// refused here.
+func gitShow(rev, path string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid git revision %q", rev)
+	}
+	bin := findTool("git")
+	if bin == "" {
+		return "", fmt.Errorf("git not found")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitShowTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "show", rev+":./"+filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git show %s: %s", rev, msg)
+	}
+	if limit := getMaxFileBytesFromConfig(); int64(stdout.Len()) > limit {
+		return "", fmt.Errorf("file too large: %d bytes (limit %d)", stdout.Len(), limit)
+	}
+	return stdout.String(), nil
+}
+
+// loadDocument returns the raw Markdown at path, a file or a virtual document, and the path
+// it renders as.
+func loadDocument(path string) (string, string, error) {
+	if doc, ok, err := lookupVirtual(path); ok {
+		return doc.Markdown, doc.BasePath, err
+	}
+	if err := enforceFileLimit(path); err != nil {
+		return "", "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), path, nil
+}
+
+// documentBase returns the path a document renders as: the path itself for files, the real
+// file behind a virtual document otherwise.
+func documentBase(path string) string {
+	if doc, ok, err := lookupVirtual(path); ok && err == nil {
+		return doc.BasePath
+	}
+	return path
+}
+
+// documentTitle returns the title shown for a virtual document, or "" for a file.
+func documentTitle(path string) string {
+	if doc, ok, err := lookupVirtual(path); ok && err == nil {
+		return doc.Title
+	}
+	return ""
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	// maxNoteFiles bounds how many Markdown files are indexed when resolving wikilinks.
+	maxNoteFiles = 5000
+	// maxNoteDirs and noteIndexTimeout bound the walk itself, for documents outside a vault
+	// whose folder holds a large tree, such as the home folder.
+	maxNoteDirs      = 2000
+	noteIndexTimeout = 2 * time.Second
+	// noteIndexMaxAge is how long an index is reused. The file watcher drops it sooner when
+	// notes anywhere in the watched vault come or go.
+	noteIndexMaxAge = time.Minute
+	// maxNoteWatchDirs bounds how many folders of a vault the file watcher follows.
+	maxNoteWatchDirs = 500
+)
+
+// wikiResolverKey carries the *wikiResolver for the document being parsed.
+var wikiResolverKey = parser.NewContextKey()
+
+var (
+	wikiLinkPattern     = regexp.MustCompile(`!?\[\[([^\[\]|#\n]*)(#[^\[\]|\n]*)?(?:\|[^\[\]\n]*)?\]\]`)
+	markdownLinkPattern = regexp.MustCompile(`\]\(<?([^)\s>]+\.(?:md|markdown))(?:#[^)\s>]*)?>?(?:\s+"[^"]*")?\)`)
+)
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// noteKey normalises a note name or relative path for case-insensitive lookup.
+func noteKey(name string) string {
+	name = filepath.ToSlash(strings.TrimSpace(name))
+	if isMarkdownFile(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return strings.ToLower(strings.Trim(name, "/"))
+}
+
+// notesRoot returns the folder tree wikilinks are resolved against: the nearest ancestor
+// holding an Obsidian vault (`.obsidian`), or else the document's own folder.
+func notesRoot(docPath string) string {
+	docDir := filepath.Dir(docPath)
+	for dir := docDir; ; {
+		if info, err := os.Stat(filepath.Join(dir, ".obsidian")); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return docDir
+		}
+		dir = parent
+	}
+}
+
+// noteIndex maps note names and root-relative paths to Markdown files under root. version
+// changes whenever a rebuilt index lists different files. dirs are the folders walked.
+type noteIndex struct {
+	root    string
+	byName  map[string][]string
+	byRel   map[string]string
+	files   []string
+	dirs    []string
+	built   time.Time
+	version int
+}
+
+// noteIndexes caches the index of each notes folder, so wikilinks and backlinks don't walk
+// the tree on every render.
+var noteIndexes = struct {
+	sync.Mutex
+	byRoot  map[string]*noteIndex
+	version int
+}{byRoot: map[string]*noteIndex{}}
+
+// cachedNoteIndex returns the index of root, rebuilding it when it is missing or stale.
+func cachedNoteIndex(root string) *noteIndex {
+	noteIndexes.Lock()
+	old := noteIndexes.byRoot[root]
+	fresh := old != nil && time.Since(old.built) < noteIndexMaxAge
+	noteIndexes.Unlock()
+	if fresh {
+		return old
+	}
+
+	ix := buildNoteIndex(root)
+	noteIndexes.Lock()
+	defer noteIndexes.Unlock()
+	if old != nil && slices.Equal(old.files, ix.files) {
+		ix.version = old.version
+	} else {
+		noteIndexes.version++
+		ix.version = noteIndexes.version
+	}
+	noteIndexes.byRoot[root] = ix
+	return ix
+}
+
+// invalidateNoteIndexes marks the indexes of folders containing path as stale.
+func invalidateNoteIndexes(path string) {
+	noteIndexes.Lock()
+	defer noteIndexes.Unlock()
+	for root, ix := range noteIndexes.byRoot {
+		if rel, err := filepath.Rel(root, path); err == nil && filepath.IsLocal(rel) {
+			ix.built = time.Time{}
+		}
+	}
+}
+
+// noteDirsUnder lists dir and the folders below it that an index of notes would walk.
+func noteDirsUnder(dir string) []string {
+	var dirs []string
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if p != dir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+		if len(dirs) >= maxNoteWatchDirs {
+			return filepath.SkipAll
+		}
+		dirs = append(dirs, p)
+		return nil
+	})
+	return dirs
+}
+
+// noteWatchDirs returns the folders of the notes folder of docPath, for the file watcher, if
+// its wikilinks or backlinks have been looked up.
+func noteWatchDirs(docPath string) []string {
+	root := notesRoot(docPath)
+	noteIndexes.Lock()
+	defer noteIndexes.Unlock()
+	if ix := noteIndexes.byRoot[root]; ix != nil {
+		return ix.dirs[:min(len(ix.dirs), maxNoteWatchDirs)]
+	}
+	return nil
+}
+
+func buildNoteIndex(root string) *noteIndex {
+	ix := &noteIndex{
+		root:   root,
+		byName: map[string][]string{},
+		byRel:  map[string]string{},
+		built:  time.Now(),
+	}
+	deadline := ix.built.Add(noteIndexTimeout)
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			if len(ix.dirs) >= maxNoteDirs || time.Now().After(deadline) {
+				return filepath.SkipAll
+			}
+			ix.dirs = append(ix.dirs, p)
+			return nil
+		}
+		if !isMarkdownFile(d.Name()) {
+			return nil
+		}
+		if len(ix.files) >= maxNoteFiles {
+			return filepath.SkipAll
+		}
+		ix.files = append(ix.files, p)
+		if rel, err := filepath.Rel(root, p); err == nil {
+			ix.byRel[noteKey(rel)] = p
+		}
+		base := noteKey(filepath.Base(p))
+		ix.byName[base] = append(ix.byName[base], p)
+		return nil
+	})
+	return ix
+}
+
+// resolve finds the file a wikilink target refers to, preferring notes closest to fromDir.
+// It returns "" when no note matches.
+func (ix *noteIndex) resolve(target string, fromDir string) string {
+	key := noteKey(target)
+	if key == "" {
+		return ""
+	}
+	if strings.Contains(key, "/") {
+		if rel, err := filepath.Rel(ix.root, filepath.Join(fromDir, filepath.FromSlash(key))); err == nil {
+			if p, ok := ix.byRel[noteKey(rel)]; ok {
+				return p
+			}
+		}
+		if p, ok := ix.byRel[key]; ok {
+			return p
+		}
+		key = key[strings.LastIndex(key, "/")+1:]
+	}
+
+	candidates := ix.byName[key]
+	if len(candidates) == 0 {
+		return ""
+	}
+	best := candidates[0]
+	bestDist := -1
+	for _, c := range candidates {
+		rel, err := filepath.Rel(fromDir, c)
+		if err != nil {
+			continue
+		}
+		dist := strings.Count(filepath.ToSlash(rel), "/")
+		if strings.HasPrefix(rel, "..") {
+			dist += 1000
+		}
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = c, dist
+		}
+	}
+	return best
+}
+
+// wikiResolver looks up the notes folder's index the first time a wikilink is parsed.
+type wikiResolver struct {
+	docPath string
+	once    sync.Once
+	index   *noteIndex
+}
+
+func newWikiResolver(docPath string) *wikiResolver {
+	return &wikiResolver{docPath: docPath}
+}
+
+// resolve returns the target file and its href relative to the current document.
+func (r *wikiResolver) resolve(target string) (string, string) {
+	if r == nil || r.docPath == "" {
+		return "", ""
+	}
+	r.once.Do(func() {
+		r.index = cachedNoteIndex(notesRoot(r.docPath))
+	})
+	docDir := filepath.Dir(r.docPath)
+	p := r.index.resolve(target, docDir)
+	if p == "" {
+		return "", ""
+	}
+	rel, err := filepath.Rel(docDir, p)
+	if err != nil {
+		return "", ""
+	}
+	return p, (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath()
+}
+
+// KindWikiLink is the node kind for `[[Note]]` links.
+var KindWikiLink = ast.NewNodeKind("WikiLink")
+
+// WikiLink is an Obsidian-style `[[Target#Fragment|Label]]` link. Destination is empty when
+// the target could not be found.
+type WikiLink struct {
+	ast.BaseInline
+	Target      string
+	Fragment    string
+	Destination string
+}
+
+// Kind implements ast.Node.
+func (n *WikiLink) Kind() ast.NodeKind {
+	return KindWikiLink
+}
+
+// Dump implements ast.Node.
+func (n *WikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Target":      n.Target,
+		"Fragment":    n.Fragment,
+		"Destination": n.Destination,
+	}, nil)
+}
+
+type wikiLinkParser struct{}
+
+// Trigger implements parser.InlineParser. '!' catches `![[Note]]` embeds that were not
+// expanded as includes (e.g. mid-paragraph); they render as ordinary wikilinks.
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'[', '!'}
+}
+
+// Parse implements parser.InlineParser.
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	m := wikiLinkPattern.FindSubmatchIndex(line)
+	if m == nil || m[0] != 0 {
+		return nil
+	}
+	target := strings.TrimSpace(string(line[m[2]:m[3]]))
+	if target == "" {
+		return nil
+	}
+	if line[0] == '!' && filepath.Ext(target) != "" && !isMarkdownFile(target) {
+		return nil
+	}
+	var fragment string
+	if m[4] >= 0 {
+		fragment = strings.TrimSpace(string(line[m[4]+1 : m[5]]))
+	}
+	label := target
+	if fragment != "" {
+		label += " › " + fragment
+	}
+	if bar := strings.IndexByte(string(line[:m[1]]), '|'); bar >= 0 {
+		if l := strings.TrimSpace(string(line[bar+1 : m[1]-2])); l != "" {
+			label = l
+		}
+	}
+
+	node := &WikiLink{Target: target, Fragment: fragment}
+	resolver, _ := pc.Get(wikiResolverKey).(*wikiResolver)
+	if _, href := resolver.resolve(target); href != "" {
+		node.Destination = href
+		if fragment != "" {
+			node.Destination += "#" + generateID(fragment)
+		}
+	}
+	node.AppendChild(node, ast.NewString([]byte(label)))
+	block.Advance(m[1])
+	return node
+}
+
+type wikiLinkRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.
+func (r *wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindWikiLink, r.renderWikiLink)
+}
+
+func (r *wikiLinkRenderer) renderWikiLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*WikiLink)
+	if n.Destination == "" {
+		if entering {
+			_, _ = w.WriteString(`<span class="wikilink wikilink-missing" title="No note named &quot;`)
+			_, _ = w.Write(util.EscapeHTML([]byte(n.Target)))
+			_, _ = w.WriteString(`&quot;">`)
+		} else {
+			_, _ = w.WriteString("</span>")
+		}
+		return ast.WalkContinue, nil
+	}
+	if entering {
+		_, _ = w.WriteString(`<a class="wikilink" href="`)
+		_, _ = w.Write(util.EscapeHTML(util.URLEscape([]byte(n.Destination), true)))
+		_, _ = w.WriteString(`">`)
+	} else {
+		_, _ = w.WriteString("</a>")
+	}
+	return ast.WalkContinue, nil
+}
+
+type wikiLinkExtension struct{}
+
+// wikiLinks resolves `[[Note]]` and `[[Note|label]]` against the notes folder.
+var wikiLinks = &wikiLinkExtension{}
+
+// Extend implements goldmark.Extender.
+func (e *wikiLinkExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		// Ahead of the standard link parser, which also triggers on '['.
+		util.Prioritized(&wikiLinkParser{}, 199),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&wikiLinkRenderer{}, 500),
+	))
+}
+
+// findBacklinks scans the notes folder around target for wikilinks and relative Markdown
+// links that point at it.
+func findBacklinks(target string) []Backlink {
+	target = filepath.Clean(target)
+	ix := cachedNoteIndex(notesRoot(target))
+	var out []Backlink
+	for _, file := range ix.files {
+		if file == target {
+			continue
+		}
+		out = append(out, fileBacklinks(ix, file, target)...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+func fileBacklinks(ix *noteIndex, file, target string) []Backlink {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(file)
+	var out []Backlink
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for s.Scan() {
+		lineNo++
+		line := s.Text()
+		if !strings.Contains(line, "[[") && !strings.Contains(line, "](") {
+			continue
+		}
+		hit := false
+		for _, m := range wikiLinkPattern.FindAllStringSubmatch(line, -1) {
+			if ix.resolve(m[1], dir) == target {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			for _, m := range markdownLinkPattern.FindAllStringSubmatch(line, -1) {
+				dest, err := url.PathUnescape(m[1])
+				if err != nil || strings.Contains(dest, "://") {
+					continue
+				}
+				if filepath.Clean(filepath.Join(dir, filepath.FromSlash(dest))) == target {
+					hit = true
+					break
+				}
+			}
+		}
+		if !hit {
+			continue
+		}
+		context := strings.TrimSpace(line)
+		if r := []rune(context); len(r) > 160 {
+			context = string(r[:157]) + "..."
+		}
+		out = append(out, Backlink{
+			Path:    file,
+			Title:   strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+			Line:    lineNo,
+			Context: context,
+		})
+	}
+	return out
+}